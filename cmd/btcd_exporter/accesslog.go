@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var webAccessLog = kingpin.Flag(
+	"web.access-log",
+	"Log every HTTP request served, with the address of the client, the path, the status and the duration, at the info level.",
+).Envar("BTCD_EXPORTER_WEB_ACCESS_LOG").Bool()
+
+// statusRecorder records the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// accessLog logs the requests served by next once answered, when enabled by
+// --web.access-log.
+func accessLog(next http.Handler) http.Handler {
+	if !*webAccessLog {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		args := []any{
+			"client", client,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"size", recorder.size,
+			"duration", time.Since(start),
+			"user_agent", r.UserAgent(),
+		}
+		// The exporter may sit behind a reverse proxy.
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			args = append(args, "forwarded_for", forwarded)
+		}
+		slog.Info("request served", args...)
+	})
+}
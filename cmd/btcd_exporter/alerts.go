@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+var alertsEvaluationInterval = kingpin.Flag(
+	"alerts.evaluation-interval",
+	"How often to evaluate the alerts of the configuration.",
+).Envar("BTCD_EXPORTER_ALERTS_EVALUATION_INTERVAL").Default("1m").Duration()
+
+// AlertConfig is a threshold alert evaluated by the exporter itself, for
+// sites without Prometheus rules and Alertmanager.
+type AlertConfig struct {
+	Name string `yaml:"name"`
+	// Expr compares a metric, named without the namespace, with a
+	// threshold, as in peers < 4.
+	Expr string `yaml:"expr"`
+	// For is how long the comparison has to hold before the alert fires.
+	For model.Duration `yaml:"for"`
+}
+
+// secondsSinceLastBlock is the age of the latest block, computed from the
+// latest_block_timestamp metric, which alerts can compare like a metric.
+const secondsSinceLastBlock = "seconds_since_last_block"
+
+var alertExprRegexp = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+
+// alertExpr is a parsed AlertConfig.Expr.
+type alertExpr struct {
+	metric    string
+	op        string
+	threshold float64
+}
+
+func parseAlertExpr(expr string) (alertExpr, error) {
+	match := alertExprRegexp.FindStringSubmatch(expr)
+	if match == nil {
+		return alertExpr{}, fmt.Errorf("invalid expression %q, expected <metric> <operator> <threshold>", expr)
+	}
+	threshold, err := strconv.ParseFloat(match[3], 64)
+	if err != nil {
+		return alertExpr{}, fmt.Errorf("invalid threshold in expression %q: %w", expr, err)
+	}
+	return alertExpr{metric: match[1], op: match[2], threshold: threshold}, nil
+}
+
+// holds reports whether value satisfies the comparison.
+func (e alertExpr) holds(value float64) bool {
+	switch e.op {
+	case "<":
+		return value < e.threshold
+	case "<=":
+		return value <= e.threshold
+	case ">":
+		return value > e.threshold
+	case ">=":
+		return value >= e.threshold
+	case "==":
+		return value == e.threshold
+	default:
+		return value != e.threshold
+	}
+}
+
+// familyName returns the name of the metric family the expression compares,
+// in namespace.
+func (e alertExpr) familyName(namespace string) string {
+	if e.metric == secondsSinceLastBlock {
+		return namespace + "_latest_block_timestamp"
+	}
+	return namespace + "_" + e.metric
+}
+
+// validateAlerts checks the alerts of the configuration.
+func (c *Config) validateAlerts() error {
+	names := make(map[string]bool, len(c.Alerts))
+	for _, alert := range c.Alerts {
+		if alert.Name == "" {
+			return fmt.Errorf("alert with expression %q has no name", alert.Expr)
+		}
+		if names[alert.Name] {
+			return fmt.Errorf("alert %q is defined twice", alert.Name)
+		}
+		names[alert.Name] = true
+		if _, err := parseAlertExpr(alert.Expr); err != nil {
+			return fmt.Errorf("alert %q: %w", alert.Name, err)
+		}
+		if alert.For < 0 {
+			return fmt.Errorf("alert %q: for cannot be negative", alert.Name)
+		}
+	}
+	return nil
+}
+
+// alertState is an alert whose expression holds for a series of its metric.
+type alertState struct {
+	Alert  string            `json:"alert"`
+	Expr   string            `json:"expr"`
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+	// State is pending until the expression held for the for duration of
+	// the alert, and firing from then on.
+	State    string    `json:"state"`
+	ActiveAt time.Time `json:"active_at"`
+}
+
+// key identifies the alert of a series.
+func (a *alertState) key() string {
+	names := make([]string, 0, len(a.Labels))
+	for name := range a.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(a.Alert)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\xff%s=%s", name, a.Labels[name])
+	}
+	return b.String()
+}
+
+// alerter evaluates the alerts of the configuration, keeping the active ones.
+// It exports them as an unchecked collector, their labels being those of the
+// series they were evaluated on.
+type alerter struct {
+	namespace   string
+	mtx         sync.Mutex
+	active      map[string]*alertState
+	evaluatedAt time.Time
+}
+
+func newAlerter(namespace string) *alerter {
+	return &alerter{namespace: namespace, active: make(map[string]*alertState)}
+}
+
+// evaluate compares the series of families with the thresholds of alerts at
+// now, and replaces the active alerts with the result.
+func (a *alerter) evaluate(alerts []AlertConfig, families []*dto.MetricFamily, now time.Time) {
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	active := make(map[string]*alertState)
+	for _, alert := range alerts {
+		expr, err := parseAlertExpr(alert.Expr)
+		if err != nil {
+			// Validated with the configuration.
+			continue
+		}
+		family := byName[expr.familyName(a.namespace)]
+		for _, m := range family.GetMetric() {
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			if expr.metric == secondsSinceLastBlock {
+				value = float64(now.UnixNano())/float64(time.Second) - value
+			}
+			if math.IsNaN(value) || !expr.holds(value) {
+				continue
+			}
+			state := &alertState{
+				Alert:    alert.Name,
+				Expr:     alert.Expr,
+				Labels:   make(map[string]string, len(m.GetLabel())),
+				Value:    value,
+				State:    "pending",
+				ActiveAt: now,
+			}
+			for _, label := range m.GetLabel() {
+				state.Labels[label.GetName()] = label.GetValue()
+			}
+			key := state.key()
+			if previous, ok := a.active[key]; ok {
+				state.ActiveAt = previous.ActiveAt
+			}
+			if now.Sub(state.ActiveAt) >= time.Duration(alert.For) {
+				state.State = "firing"
+				if previous, ok := a.active[key]; !ok || previous.State != "firing" {
+					slog.Warn("alert firing", "alert", alert.Name, "expr", alert.Expr, "value", value, "labels", state.Labels)
+				}
+			}
+			active[key] = state
+		}
+	}
+	for key, previous := range a.active {
+		if _, ok := active[key]; !ok && previous.State == "firing" {
+			slog.Info("alert resolved", "alert", previous.Alert, "labels", previous.Labels)
+		}
+	}
+	a.active, a.evaluatedAt = active, now
+}
+
+// snapshot returns the active alerts, sorted by alert and labels, and when
+// they were evaluated.
+func (a *alerter) snapshot() ([]*alertState, time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	keys := make([]string, 0, len(a.active))
+	for key := range a.active {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	alerts := make([]*alertState, len(keys))
+	for i, key := range keys {
+		copied := *a.active[key]
+		alerts[i] = &copied
+	}
+	return alerts, a.evaluatedAt
+}
+
+func (a *alerter) Describe(chan<- *prometheus.Desc) {}
+
+func (a *alerter) Collect(ch chan<- prometheus.Metric) {
+	alerts, _ := a.snapshot()
+	for _, alert := range alerts {
+		labels := prometheus.Labels{"alert": alert.Alert}
+		for name, value := range alert.Labels {
+			if name != "alert" {
+				labels[name] = value
+			}
+		}
+		desc := prometheus.NewDesc(
+			prometheus.BuildFQName(a.namespace, "alert", "firing"),
+			"Whether an alert of the configuration is firing, 0 while pending.",
+			nil, labels,
+		)
+		firing := 0.0
+		if alert.State == "firing" {
+			firing = 1
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, firing)
+	}
+}
+
+// runAlerts evaluates the alerts of the configuration of s every
+// --alerts.evaluation-interval until ctx is done. The nodes are queried as
+// for a scrape, without the metric filter.
+func runAlerts(ctx context.Context, s *server) {
+	runPeriodically(ctx, *alertsEvaluationInterval, func(ctx context.Context) {
+		config, _, targets := s.current()
+		if len(config.Alerts) == 0 {
+			s.alerter.evaluate(nil, nil, time.Now())
+			return
+		}
+		families, err := nodesGatherer(ctx, config, targets, s.options.Namespace).Gather()
+		if err != nil {
+			slog.Warn("error gathering metrics for alerts", "err", err)
+		}
+		s.alerter.evaluate(config.Alerts, families, time.Now())
+	})
+}
+
+// alertsResponse is served by /alerts.
+type alertsResponse struct {
+	EvaluatedAt time.Time     `json:"evaluated_at"`
+	Alerts      []*alertState `json:"alerts"`
+}
+
+// alertsHandler serves the pending and firing alerts as JSON.
+func alertsHandler(s *server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alerts, evaluatedAt := s.alerter.snapshot()
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		// Expressions compare with < and >.
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(alertsResponse{EvaluatedAt: evaluatedAt, Alerts: alerts}); err != nil {
+			slog.Error("error encoding alerts", "err", err)
+		}
+	})
+}
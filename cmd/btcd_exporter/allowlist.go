@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var webAllowCIDRs = kingpin.Flag(
+	"web.allow-cidr",
+	"Network, as CIDR, or address allowed to read metrics, for example 10.0.0.0/8. Can be repeated. Defaults to any.",
+).Envar("BTCD_EXPORTER_WEB_ALLOW_CIDR").Strings()
+
+// ipAllowlist restricts the clients allowed to read metrics to networks.
+type ipAllowlist []netip.Prefix
+
+// newIPAllowlist parses the networks given by --web.allow-cidr. A single
+// address stands for itself. It returns nil when there are none, allowing
+// any client.
+func newIPAllowlist(cidrs []string) (ipAllowlist, error) {
+	var allowlist ipAllowlist
+	for _, cidr := range cidrs {
+		// The environment variable holds them separated by commas.
+		for _, cidr := range strings.Split(cidr, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if cidr == "" {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(cidr)
+				if addrErr != nil {
+					return nil, fmt.Errorf("invalid --web.allow-cidr %q: %w", cidr, err)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			allowlist = append(allowlist, prefix.Masked())
+		}
+	}
+	return allowlist, nil
+}
+
+// wrap answers 403 to the requests of clients outside the allowed networks.
+// The client is the peer of the connection, X-Forwarded-For is not trusted.
+func (l ipAllowlist) wrap(next http.Handler) http.Handler {
+	if len(l) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.allowed(r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
+
+func (l ipAllowlist) allowed(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range l {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPAllowlist(t *testing.T) {
+	allowlist, err := newIPAllowlist([]string{
+		"10.0.0.0/8",
+		"192.0.2.1",
+		// The environment variable holds them separated by commas.
+		"198.51.100.0/24, 2001:db8::1,",
+		"2001:db8:1::/48",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		remoteAddr string
+		allowed    bool
+	}{
+		{"10.1.2.3:40000", true},
+		{"11.0.0.1:40000", false},
+		// A bare address only allows itself.
+		{"192.0.2.1:40000", true},
+		{"192.0.2.2:40000", false},
+		{"198.51.100.7:40000", true},
+		{"[2001:db8::1]:40000", true},
+		{"[2001:db8::2]:40000", false},
+		{"[2001:db8:1:2::3]:40000", true},
+		// IPv4 clients of a dual-stack listener appear as IPv4-mapped
+		// IPv6 addresses.
+		{"[::ffff:10.1.2.3]:40000", true},
+		{"[::ffff:11.0.0.1]:40000", false},
+		{"unix-socket", false},
+	} {
+		if got := allowlist.allowed(tc.remoteAddr); got != tc.allowed {
+			t.Errorf("%s: got allowed %v, want %v", tc.remoteAddr, got, tc.allowed)
+		}
+	}
+}
+
+func TestIPAllowlistInvalid(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/33", "example.com", "10.0.0.1,nope"} {
+		if _, err := newIPAllowlist([]string{cidr}); err == nil {
+			t.Errorf("%s: got no error", cidr)
+		}
+	}
+}
+
+func TestIPAllowlistEmpty(t *testing.T) {
+	allowlist, err := newIPAllowlist([]string{"", " , "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowlist != nil {
+		t.Errorf("got allowlist %v, want none", allowlist)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.RemoteAddr = "203.0.113.1:40000"
+	w := httptest.NewRecorder()
+	allowlist.wrap(next).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d without allowlist, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestIPAllowlistWrap(t *testing.T) {
+	allowlist, err := newIPAllowlist([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := allowlist.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	}))
+	for _, tc := range []struct {
+		remoteAddr string
+		status     int
+	}{
+		{"10.0.0.1:40000", http.StatusOK},
+		{"[::ffff:10.0.0.1]:40000", http.StatusOK},
+		{"203.0.113.1:40000", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d", tc.remoteAddr, w.Code, tc.status)
+		}
+		if w.Code == http.StatusForbidden && w.Body.String() == "metrics" {
+			t.Errorf("%s: served the wrapped handler", tc.remoteAddr)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/common/version"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+func main() {
+	var (
+		configFile = kingpin.Flag(
+			"config.file",
+			"Path to the YAML configuration file. Flags and environment variables take precedence over it.",
+		).Envar("BTCD_EXPORTER_CONFIG_FILE").String()
+		listenAddress = kingpin.Flag(
+			"web.listen-address",
+			"Address on which to expose metrics and web interface, for example 127.0.0.1:9101 to only listen on localhost, or unix:///run/btcd_exporter.sock for a unix socket. Empty to only push metrics.",
+		).Default(":9101").Envar("BTCD_EXPORTER_WEB_LISTEN_ADDRESS").String()
+		metricsPath = kingpin.Flag(
+			"web.telemetry-path",
+			"Path under which to expose metrics.",
+		).Default("/metrics").Envar("BTCD_EXPORTER_WEB_TELEMETRY_PATH").String()
+		shutdownTimeout = kingpin.Flag(
+			"web.shutdown-timeout",
+			"Maximum time to wait on shutdown for the scrapes in progress to finish.",
+		).Default("30s").Duration()
+		certCheckInterval = kingpin.Flag(
+			"rpc.cert-check-interval",
+			"How often to check the RPC TLS certificates and the credentials from secret stores for changes, recreating the clients when they do. 0 only checks on reload.",
+		).Default("1m").Duration()
+		runtimeMetrics = kingpin.Flag(
+			"metrics.runtime",
+			"Export the go_* and process_* metrics of the exporter itself. Use --no-metrics.runtime to leave them out.",
+		).Default("true").Envar("BTCD_EXPORTER_METRICS_RUNTIME").Bool()
+		pollInterval = kingpin.Flag(
+			"scrape.poll-interval",
+			"Poll btcd in the background at this interval and serve the cached values, instead of querying btcd on every scrape. 0 disables polling.",
+		).Default("0s").Duration()
+	)
+	flagConfig := configFlags(kingpin.CommandLine)
+	kingpin.Command("serve", "Serve the metrics of the nodes, the default.").Default()
+	checkCommand := kingpin.Command("check", "Check that the nodes can be scraped: certificates, connection, authentication and the RPC calls of the enabled collectors, printing a report.")
+	validateCommand := kingpin.Command("validate", "Check the configuration file and flags, without starting the exporter.")
+	validateConnect := validateCommand.Flag("connect", "Also check that every node accepts connections.").Bool()
+	healthcheckCommand := kingpin.Command("healthcheck", "Check that the exporter running on this host is healthy, exiting with status 0 or 1. Meant for Docker HEALTHCHECK and similar checks.")
+	healthcheckURLFlag := healthcheckCommand.Flag("url", "URL of the health check to request. Defaults to /healthz on --web.listen-address.").String()
+	healthcheckRPC := healthcheckCommand.Flag("rpc", "Call the nodes instead of requesting the exporter.").Bool()
+	versionCommand := kingpin.Command("version", "Show the version of the exporter and how it was built.")
+	kingpin.Version(version.Print("btcd_exporter"))
+	kingpin.HelpFlag.Short('h')
+	command := kingpin.Parse()
+	if command == versionCommand.FullCommand() {
+		fmt.Println(version.Print("btcd_exporter"))
+		return
+	}
+
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if command == validateCommand.FullCommand() {
+		if err := validateConfig(*configFile, flagConfig, *listenAddress, *metricsPath, *validateConnect); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("configuration is valid")
+		return
+	}
+	if command == healthcheckCommand.FullCommand() {
+		if err := runHealthcheck(*configFile, flagConfig, *listenAddress, *healthcheckURLFlag, *healthcheckRPC); err != nil {
+			fmt.Fprintln(os.Stderr, "unhealthy:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *dryRun {
+		*once = true
+		*outputFile = "-"
+	}
+	slog.Info("starting btcd_exporter", "version", version.Info())
+	slog.Info("build context", "context", version.BuildContext())
+
+	config, err := resolveConfig(*configFile, flagConfig)
+	if err != nil {
+		fatal("error loading configuration", "err", err)
+	}
+	options := newOptions(config)
+	options.RPCMetrics = collector.NewRPCMetrics(options)
+	registry.MustRegister(options.RPCMetrics)
+	if command == checkCommand.FullCommand() {
+		if !runCheck(os.Stdout, config, options) {
+			os.Exit(1)
+		}
+		return
+	}
+	registry.MustRegister(version.NewCollector(options.Namespace + "_exporter"))
+	// The node exporter reading a --once textfile serves its own go_* and
+	// process_* metrics.
+	if *runtimeMetrics && !*once {
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	if *once {
+		*pollInterval = 0
+	}
+	if err := validateScrapeConcurrency(); err != nil {
+		fatal("invalid scrape concurrency", "err", err)
+	}
+	if options.MaxAge > 0 && options.MaxAge <= *pollInterval {
+		fatal("--scrape.max-age must be longer than --scrape.poll-interval")
+	}
+	s := newServer(*configFile, flagConfig, *pollInterval, options)
+	registry.MustRegister(s.alerter)
+	if err := s.reload(); err != nil {
+		fatal("error loading configuration", "err", err)
+	}
+	defer s.shutdown()
+	if *once {
+		if err := collectOnce(s, *outputFile); err != nil {
+			fatal("error writing metrics", "file", *outputFile, "err", err)
+		}
+		if *dryRun {
+			if err := scrapeErrors(s); err != nil {
+				fatal("dry run failed", "err", err)
+			}
+		}
+		return
+	}
+	if *certCheckInterval > 0 {
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+		go s.watchClients(*certCheckInterval, stopWatching)
+	}
+
+	if err := validateTelemetryPath(*metricsPath); err != nil {
+		fatal("invalid telemetry path", "err", err)
+	}
+	if err := validateTimeouts(); err != nil {
+		fatal("invalid web timeouts", "err", err)
+	}
+	listeners, err := webListeners(*listenAddress)
+	if err != nil {
+		fatal("error loading web configuration", "err", err)
+	}
+	if err := validateRPCDebug(listeners); err != nil {
+		fatal("invalid RPC debugging", "err", err)
+	}
+	if err := validateLifecycle(listeners); err != nil {
+		fatal("invalid lifecycle endpoint", "err", err)
+	}
+	if err := validatePush(); err != nil {
+		fatal("invalid push configuration", "err", err)
+	}
+	if err := validateRules(); err != nil {
+		fatal("invalid alerting rules", "err", err)
+	}
+	if err := validateWebhooks(); err != nil {
+		fatal("invalid webhook configuration", "err", err)
+	}
+	if err := validateConsul(*listenAddress); err != nil {
+		fatal("invalid Consul configuration", "err", err)
+	}
+	// Every listener serves the same endpoints, the scrapes in progress
+	// being limited across them.
+	limiter := newScrapeLimiter(*maxRequests, options.Namespace)
+	newMux := func(listener *webListener) *http.ServeMux {
+		protect := listener.protect
+		mux := http.NewServeMux()
+		mux.Handle(*metricsPath, protect(limiter.wrap(metricsHandler(s))))
+		mux.Handle("/probe", protect(limiter.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			config, filter, _ := s.current()
+			probeHandler(w, r, config, filter, options)
+		}))))
+		mux.Handle("/api/v1/status", protect(limiter.wrap(statusHandler(s))))
+		mux.Handle("/sd", protect(sdHandler(s, *metricsPath)))
+		mux.Handle("/-/config", protect(configHandler(s)))
+		mux.Handle("/dashboard.json", dashboardHandler(s))
+		mux.Handle("/rules.yml", rulesHandler(s))
+		mux.Handle("/alerts", protect(alertsHandler(s)))
+		mux.HandleFunc("/healthz", healthHandler)
+		mux.Handle("/readyz", readyHandler(s))
+		if *enableLifecycle {
+			mux.Handle("/-/reload", listener.protectReload(s.reloadHandler(*reloadToken), *reloadToken))
+		}
+		handlePprof(mux, protect)
+		if options.RPCDebug {
+			mux.Handle("/debug/rpc", protect(rpcDebugHandler(s)))
+		}
+		mux.Handle("/", protect(landingHandler(s, *metricsPath)))
+		return mux
+	}
+	if pprofServer := servePprof(); pprofServer != nil {
+		defer pprofServer.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			notifySystemd(daemon.SdNotifyReloading)
+			err := s.reload()
+			notifySystemd(daemon.SdNotifyReady)
+			if err != nil {
+				slog.Error("error reloading configuration", "err", err)
+				continue
+			}
+			slog.Info("configuration reloaded")
+		}
+	}()
+	httpServers := make([]*http.Server, 0, len(listeners))
+	serveErr := make(chan error, len(listeners))
+	// Every listener is opened before any is served, so that systemd is
+	// told the exporter is ready once all of them accept connections.
+	netListeners := make([]net.Listener, 0, len(listeners))
+	for _, listener := range listeners {
+		l, err := listen(listener.address)
+		if err != nil {
+			fatal("error listening", "address", listener.address, "err", err)
+		}
+		netListeners = append(netListeners, l)
+	}
+	for i, listener := range listeners {
+		httpServer := &http.Server{
+			Addr:         listener.address,
+			Handler:      accessLog(newMux(listener)),
+			ReadTimeout:  *webReadTimeout,
+			WriteTimeout: *webWriteTimeout,
+			IdleTimeout:  *webIdleTimeout,
+		}
+		httpServers = append(httpServers, httpServer)
+		l, listener := netListeners[i], listener
+		go func() {
+			serveErr <- serve(httpServer, l, listener)
+		}()
+	}
+	if len(listeners) == 0 {
+		if !pushEnabled() {
+			fatal("--web.listen-address is empty and no push destination is set")
+		}
+		slog.Info("--web.listen-address is empty, only pushing metrics")
+	}
+	pushDone := make(chan struct{})
+	go func() {
+		runPushers(ctx, s)
+		close(pushDone)
+	}()
+	if *consulRegister {
+		// The listener of --web.listen-address comes first.
+		tls := *listenAddress != "" && listeners[0].config.tls
+		deregister, err := registerConsul(ctx, *listenAddress, tls)
+		if err != nil {
+			fatal("error registering with Consul", "err", err)
+		}
+		defer deregister()
+	}
+	go s.runFailover(ctx)
+	go runAlerts(ctx, s)
+	go runWebhooks(ctx, s)
+	notifyReady(ctx, s)
+	go runWatchdog(ctx, s)
+	select {
+	case err := <-serveErr:
+		fatal("error serving HTTP", "err", err)
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down")
+	notifySystemd(daemon.SdNotifyStopping)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("error shutting down server", "address", httpServer.Addr, "err", err)
+		}
+	}
+	<-pushDone
+	// The deferred call stops the pollers and shuts the RPC clients down.
+}
+
+// configFlags defines on app the flags and environment variables of the
+// settings which can also be given in the configuration file, returning the
+// configuration they make up once parsed.
+func configFlags(app *kingpin.Application) *Config {
+	flagConfig := &Config{Labels: map[string]string{}, given: map[*bool]bool{}}
+	app.Flag(
+		"backend",
+		"Node implementation to scrape: btcd or bitcoind for Bitcoin Core. Defaults to btcd.",
+	).Envar("BTCD_EXPORTER_BACKEND").EnumVar(&flagConfig.RPC.Backend, collector.BackendBtcd, collector.BackendBitcoind)
+	app.Flag(
+		"rpc.mode",
+		"How to talk to the btcd RPC server: ws for a websocket connection, http for plain HTTP POST requests. Defaults to ws, bitcoind only supports http.",
+	).Envar("BTCD_EXPORTER_RPC_MODE").EnumVar(&flagConfig.RPC.Mode, collector.RPCModeWebsocket, collector.RPCModeHTTP)
+	app.Flag(
+		"rpc.host",
+		"Host and port of the btcd RPC server.",
+	).Envar("BTCD_EXPORTER_HOST").StringVar(&flagConfig.RPC.Host)
+	app.Flag(
+		"rpc.username",
+		"Username for the btcd RPC server.",
+	).Envar("BTCD_EXPORTER_USERNAME").StringVar(&flagConfig.RPC.Username)
+	app.Flag(
+		"rpc.password",
+		"Password for the btcd RPC server.",
+	).Envar("BTCD_EXPORTER_PASSWORD").StringVar(&flagConfig.RPC.Password)
+	app.Flag(
+		"rpc.username-file",
+		"Path to a file holding the username for the btcd RPC server, used when no username is set.",
+	).Envar("BTCD_EXPORTER_USERNAME_FILE").StringVar(&flagConfig.RPC.UsernameFile)
+	app.Flag(
+		"rpc.password-file",
+		"Path to a file holding the password for the btcd RPC server, used when no password is set.",
+	).Envar("BTCD_EXPORTER_PASSWORD_FILE").StringVar(&flagConfig.RPC.PasswordFile)
+	app.Flag(
+		"rpc.cookie-file",
+		"Path to the cookie file holding the credentials of a bitcoind RPC server, used when no password is set.",
+	).Envar("BTCD_EXPORTER_COOKIE_FILE").StringVar(&flagConfig.RPC.CookieFile)
+	app.Flag(
+		"rpc.cert",
+		"Path to the RPC TLS certificate. Defaults to rpc.cert in the btcd home directory for btcd, and to no TLS for bitcoind.",
+	).Envar("BTCD_EXPORTER_CERT_PATH").StringVar(&flagConfig.RPC.TLS.CertFile)
+	app.Flag(
+		"rpc.btcd-config-file",
+		"Path to the configuration file of a btcd running on the same host, from which the host, credentials and certificate are taken unless set, for example "+collector.DefaultBtcdConfigFile+".",
+	).Envar("BTCD_EXPORTER_BTCD_CONFIG_FILE").StringVar(&flagConfig.RPC.BtcdConfigFile)
+	app.Flag(
+		"rpc.proxy",
+		"URL of a SOCKS5 proxy to connect to the RPC server through, for example socks5://127.0.0.1:9050 to reach onion services through Tor.",
+	).Envar("BTCD_EXPORTER_PROXY").StringVar(&flagConfig.RPC.Proxy)
+	app.Flag(
+		"rpc.tls-server-name",
+		"Name the RPC TLS certificate is verified against. Defaults to the host of --rpc.host.",
+	).Envar("BTCD_EXPORTER_TLS_SERVER_NAME").StringVar(&flagConfig.RPC.TLS.ServerName)
+	app.Flag(
+		"rpc.tls-skip-verify",
+		"Do not verify the RPC TLS certificate. Insecure, only meant for testing.",
+	).Envar("BTCD_EXPORTER_TLS_SKIP_VERIFY").SetValue(flagConfig.boolFlag(&flagConfig.RPC.TLS.InsecureSkipVerify))
+	app.Flag(
+		"rpc.legacy-getinfo",
+		"Query the deprecated getinfo instead of getblockchaininfo and getconnectioncount, for btcd releases without the latter.",
+	).Envar("BTCD_EXPORTER_RPC_LEGACY_GETINFO").SetValue(flagConfig.boolFlag(&flagConfig.RPC.LegacyGetInfo))
+	app.Flag(
+		"rpc.batch",
+		"Send the calls of a scrape as a single JSON-RPC batch, cutting the round trips to the node. Needs --rpc.mode=http, websocket calls are pipelined already.",
+	).Envar("BTCD_EXPORTER_RPC_BATCH").SetValue(flagConfig.boolFlag(&flagConfig.RPC.Batch))
+	app.Flag(
+		"wallet.host",
+		"Host and port of the btcwallet RPC server queried by the wallet collector.",
+	).Envar("BTCD_EXPORTER_WALLET_HOST").StringVar(&flagConfig.Wallet.Host)
+	app.Flag(
+		"wallet.username",
+		"Username for the btcwallet RPC server.",
+	).Envar("BTCD_EXPORTER_WALLET_USERNAME").StringVar(&flagConfig.Wallet.Username)
+	app.Flag(
+		"wallet.password",
+		"Password for the btcwallet RPC server.",
+	).Envar("BTCD_EXPORTER_WALLET_PASSWORD").StringVar(&flagConfig.Wallet.Password)
+	app.Flag(
+		"wallet.cert",
+		"Path to the btcwallet RPC TLS certificate. Defaults to rpc.cert in the btcwallet home directory.",
+	).Envar("BTCD_EXPORTER_WALLET_CERT_PATH").StringVar(&flagConfig.Wallet.TLS.CertFile)
+	app.Flag(
+		"wallet.account",
+		"Wallet account reported on by the wallet collector. Defaults to default.",
+	).Envar("BTCD_EXPORTER_WALLET_ACCOUNT").StringVar(&flagConfig.Wallet.Account)
+	app.Flag(
+		"metrics.namespace",
+		"Prefix of every metric name, for example bitcoin or bitcoin_node. Defaults to btcd.",
+	).Envar("BTCD_EXPORTER_METRICS_NAMESPACE").StringVar(&flagConfig.Metrics.Namespace)
+	app.Flag(
+		"metrics.include",
+		"Regular expression matching the names of the metrics to expose. Defaults to all.",
+	).Envar("BTCD_EXPORTER_METRICS_INCLUDE").StringVar(&flagConfig.Metrics.Include)
+	app.Flag(
+		"metrics.exclude",
+		"Regular expression matching the names of the metrics not to expose, applied after --metrics.include.",
+	).Envar("BTCD_EXPORTER_METRICS_EXCLUDE").StringVar(&flagConfig.Metrics.Exclude)
+	app.Flag(
+		"metrics.legacy",
+		"Also export the block height and network traffic under their former names and types, btcd_blocks_total, btcd_sent_bytes and btcd_received_bytes, while dashboards and alerts migrate.",
+	).Envar("BTCD_EXPORTER_METRICS_LEGACY").SetValue(flagConfig.boolFlag(&flagConfig.Metrics.Legacy))
+	app.Flag(
+		"label",
+		"Constant label attached to every btcd metric, as name=value. Can be repeated.",
+	).PlaceHolder("NAME=VALUE").StringMapVar(&flagConfig.Labels)
+	return flagConfig
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+// checkReport prints the outcome of the checks of the check command.
+type checkReport struct {
+	w      io.Writer
+	failed bool
+}
+
+func (r *checkReport) ok(check, format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "  [ok]   %-15s %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (r *checkReport) fail(check string, err error, hint string) {
+	r.failed = true
+	fmt.Fprintf(r.w, "  [FAIL] %-15s %v\n", check, err)
+	if hint != "" {
+		fmt.Fprintf(r.w, "         %-15s %s\n", "", hint)
+	}
+}
+
+// runCheck checks that every node of config can be scraped: that its
+// certificate loads, that the exporter can connect and authenticate, and that
+// every enabled collector is allowed to run its RPC calls, with the clients
+// and exporters created with options. It writes a report to w and reports
+// whether every check passed.
+func runCheck(w io.Writer, config *Config, options collector.Options) bool {
+	report := &checkReport{w: w}
+	nodes, err := config.NodeConfigs()
+	if err != nil {
+		fmt.Fprintln(w, "configuration")
+		report.fail("configuration", err, "")
+		return false
+	}
+	if err := applyCollectorConfig(config); err != nil {
+		fmt.Fprintln(w, "configuration")
+		report.fail("configuration", err, "")
+		return false
+	}
+	if len(nodes) == 0 {
+		fmt.Fprintln(w, "no node configured, nothing to check")
+		return true
+	}
+	for i, node := range nodes {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		checkNode(report, config, node, options)
+	}
+	return !report.failed
+}
+
+func checkNode(report *checkReport, config *Config, node NodeConfig, options collector.Options) {
+	backend := node.Backend
+	if backend == "" {
+		backend = collector.BackendBtcd
+	}
+	fmt.Fprintf(report.w, "node %s (%s at %s)\n", node.Name, backend, node.Host)
+
+	if err := node.Validate(); err != nil {
+		report.fail("configuration", err, "")
+		return
+	}
+	if certFile := node.CertFile(); certFile == "" {
+		report.ok("certificate", "none, TLS not used")
+	} else if err := checkCertificate(report, certFile); err != nil {
+		hint := "set --rpc.cert to the rpc.cert of the node"
+		if node.TLS.InsecureSkipVerify {
+			hint = ""
+		}
+		report.fail("certificate", err, hint)
+		if !node.TLS.InsecureSkipVerify {
+			return
+		}
+	}
+
+	client, err := collector.NewClient(node.RPCConfig, false, options)
+	if err != nil {
+		report.fail("connection", err, "check --rpc.host and that the RPC server of the node is listening")
+		return
+	}
+	defer client.Shutdown()
+	if client.HTTPPostMode() {
+		report.ok("connection", "HTTP POST, a connection per call")
+	} else {
+		report.ok("connection", "websocket connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *scrapeTimeout)
+	defer cancel()
+	hash, err := collector.Call(ctx, "getbestblockhash", client.GetBestBlockHashAsync)
+	if err != nil {
+		hint := ""
+		if strings.Contains(err.Error(), "401") {
+			hint = "check the RPC username and password"
+		}
+		report.fail("authentication", err, hint)
+		return
+	}
+	report.ok("authentication", "best block %s", hash)
+
+	exporter, err := collector.NewExporter(client, config.collectorConfig(node), options)
+	if err != nil {
+		report.fail("collectors", err, "")
+		return
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		exporter.CollectContext(ctx, ch)
+		close(ch)
+	}()
+	for range ch {
+	}
+	status := exporter.Status()
+	names := make([]string, 0, len(status.Collectors))
+	for name := range status.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := status.Collectors[name]
+		if c.Err == nil {
+			report.ok(name+" collector", "took %s", c.Duration.Round(time.Millisecond))
+			continue
+		}
+		hint := ""
+		if strings.Contains(c.Err.Error(), "limited user") {
+			hint = "the RPC user is limited, use the admin user or disable the collector"
+		} else if strings.Contains(c.Err.Error(), "Method not found") {
+			hint = "the node does not support the collector, disable it with --no-collector." + name
+		}
+		report.fail(name+" collector", c.Err, hint)
+	}
+}
+
+// checkCertificate reports the certificate in certFile, failing if it cannot
+// be read or has expired.
+func checkCertificate(report *checkReport, certFile string) error {
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s holds no PEM certificate", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", certFile, err)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return fmt.Errorf("%s expired on %s", certFile, cert.NotAfter.Format(time.RFC3339))
+	}
+	report.ok("certificate", "%s, valid until %s", certFile, cert.NotAfter.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/model"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+var (
+	rpcTimeout = kingpin.Flag(
+		"rpc.timeout",
+		"Maximum duration of a single RPC call. 0 only bounds calls by the scrape timeout.",
+	).Default("5s").Duration()
+	rpcRetries = kingpin.Flag(
+		"rpc.retries",
+		"How many times an RPC call failing because of a connection error is retried.",
+	).Default("2").Int()
+	rpcRetryBackoff = kingpin.Flag(
+		"rpc.retry-backoff",
+		"Delay before the first retry of an RPC call, doubled on every further retry and randomized by ±50%.",
+	).Default("100ms").Duration()
+	rpcClassicBuckets = kingpin.Flag(
+		"rpc.duration-classic-buckets",
+		"Keep the classic buckets of the RPC duration histogram next to its native buckets, for scrapers without native histograms. --no-rpc.duration-classic-buckets only exposes the native buckets.",
+	).Default("true").Envar("BTCD_EXPORTER_RPC_DURATION_CLASSIC_BUCKETS").Bool()
+	blockCacheSize = kingpin.Flag(
+		"rpc.block-cache-size",
+		"How many blocks the headers of are cached by every client, so that the header of the best block is fetched once rather than on every scrape. 0 disables the cache.",
+	).Default("128").Envar("BTCD_EXPORTER_RPC_BLOCK_CACHE_SIZE").Int()
+	circuitBreakerFailures = kingpin.Flag(
+		"rpc.circuit-breaker-failures",
+		"Number of failed scrapes in a row after which a node is no longer queried for --rpc.circuit-breaker-cooldown, its scrapes only reporting it down. 0 disables the circuit breaker.",
+	).Default("3").Envar("BTCD_EXPORTER_CIRCUIT_BREAKER_FAILURES").Int()
+	circuitBreakerCooldown = kingpin.Flag(
+		"rpc.circuit-breaker-cooldown",
+		"How long a node is left alone once its circuit breaker opened. The next scrape then queries it again, closing the circuit if it succeeds and opening it again otherwise.",
+	).Default("30s").Envar("BTCD_EXPORTER_CIRCUIT_BREAKER_COOLDOWN").Duration()
+	scrapeConcurrency = kingpin.Flag(
+		"scrape.concurrency",
+		"Maximum number of collectors querying btcd concurrently during a scrape.",
+	).Default("4").Int()
+	scrapeMaxAge = kingpin.Flag(
+		"scrape.max-age",
+		"Maximum age of the values served from the background polls of --scrape.poll-interval and from the collectors with an interval. Older values are withheld, only reporting the node or collector down. 0 serves them however old.",
+	).Default("0s").Envar("BTCD_EXPORTER_SCRAPE_MAX_AGE").Duration()
+)
+
+// newOptions returns the settings of the clients and exporters, from the
+// flags and the metrics section of config. Their RPC metrics are left to
+// the caller to create and register.
+func newOptions(config *Config) collector.Options {
+	options := collector.DefaultOptions()
+	if config.Metrics.Namespace != "" {
+		options.Namespace = config.Metrics.Namespace
+	}
+	options.LegacyMetrics = config.Metrics.Legacy
+	options.ScrapeConcurrency = *scrapeConcurrency
+	options.MaxAge = *scrapeMaxAge
+	options.RPCTimeout = *rpcTimeout
+	options.RPCRetries = *rpcRetries
+	options.RPCRetryBackoff = *rpcRetryBackoff
+	options.RPCDebug = *enableRPCDebug
+	options.RPCClassicBuckets = *rpcClassicBuckets
+	options.BlockCacheSize = *blockCacheSize
+	options.CircuitBreakerFailures = *circuitBreakerFailures
+	options.CircuitBreakerCooldown = *circuitBreakerCooldown
+	return options
+}
+
+func init() {
+	for _, name := range collector.Names() {
+		flags := collectorFlags{}
+		helpDefaultState := "disabled"
+		if collector.DefaultEnabled(name) {
+			helpDefaultState = "enabled"
+		}
+		flags.enabled = kingpin.Flag(
+			"collector."+name,
+			fmt.Sprintf("Enable the %s collector (default: %s).", name, helpDefaultState),
+		).Default(fmt.Sprintf("%v", collector.DefaultEnabled(name))).IsSetByUser(&flags.enabledSet).Bool()
+		flags.interval = kingpin.Flag(
+			"collector."+name+".interval",
+			fmt.Sprintf("Refresh the metrics of the %s collector at most once per interval, serving the previous values in between. 0 refreshes them on every scrape.", name),
+		).Default("0s").IsSetByUser(&flags.intervalSet).Duration()
+		collectorFlagsByName[name] = &flags
+	}
+}
+
+// collectorFlags holds the --collector.<name> and --collector.<name>.interval
+// flags of a collector.
+type collectorFlags struct {
+	enabled     *bool
+	enabledSet  bool
+	interval    *time.Duration
+	intervalSet bool
+}
+
+var collectorFlagsByName = make(map[string]*collectorFlags)
+
+// applyCollectorConfig applies the collector flags that were passed over the
+// settings of the collectors in config, then checks them.
+func applyCollectorConfig(config *Config) error {
+	collectors := make(map[string]collector.CollectorConfig, len(config.Collectors))
+	for name, collectorConfig := range config.Collectors {
+		collectors[name] = collectorConfig
+	}
+	for name, flags := range collectorFlagsByName {
+		collectorConfig := collectors[name]
+		if flags.enabledSet {
+			enabled := *flags.enabled
+			collectorConfig.Enabled = &enabled
+		}
+		if flags.intervalSet {
+			collectorConfig.Interval = model.Duration(*flags.interval)
+		}
+		if flags.enabledSet || flags.intervalSet {
+			collectors[name] = collectorConfig
+		}
+	}
+	config.Collectors = collectors
+	return config.Validate()
+}
+
+// validateScrapeConcurrency checks that every scrape can run its collectors.
+func validateScrapeConcurrency() error {
+	if *scrapeConcurrency < 1 {
+		return fmt.Errorf("--scrape.concurrency must be at least 1, got %d", *scrapeConcurrency)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+// Config is the exporter configuration. It is assembled from the YAML file
+// given by --config.file, then overridden by environment variables and
+// finally by command-line flags.
+type Config struct {
+	// Config holds the collectors, addresses and wallet sections.
+	collector.Config `yaml:",inline"`
+
+	RPC     collector.RPCConfig            `yaml:"rpc"`
+	Nodes   []NodeConfig                   `yaml:"nodes"`
+	Modules map[string]collector.RPCConfig `yaml:"modules"`
+	Labels  map[string]string              `yaml:"labels"`
+	Metrics MetricsConfig                  `yaml:"metrics"`
+	// KubernetesSD, DNSSD and ConsulSD discover nodes, which are added to Nodes.
+	KubernetesSD []KubernetesSDConfig `yaml:"kubernetes_sd_configs"`
+	DNSSD        []DNSSDConfig        `yaml:"dns_sd_configs"`
+	ConsulSD     []ConsulSDConfig     `yaml:"consul_sd_configs"`
+	// Alerts are evaluated by the exporter itself.
+	Alerts []AlertConfig `yaml:"alerts"`
+
+	// given holds the boolean settings of a configuration made up of flags
+	// and environment variables which were given, false ones included.
+	given map[*bool]bool
+}
+
+// NodeConfig describes one of several btcd nodes scraped by the exporter.
+// Settings left empty are taken from the rpc section.
+type NodeConfig struct {
+	Name                string `yaml:"name"`
+	collector.RPCConfig `yaml:",inline"`
+	// FailoverHosts are the hosts and ports of the same node, or of
+	// equivalent ones, tried in order when Host stops answering.
+	FailoverHosts []string `yaml:"failover_hosts"`
+	// Process, Disk and Log locate a node running on the host of the
+	// exporter, for the process, disk and log collectors. The nodes without
+	// them are not measured by those collectors.
+	Process collector.ProcessConfig `yaml:"process"`
+	Disk    collector.DiskConfig    `yaml:"disk"`
+	Log     collector.LogConfig     `yaml:"log"`
+}
+
+// MetricsConfig holds the settings shaping the exported metrics.
+type MetricsConfig struct {
+	// Namespace replaces the btcd prefix of every metric name.
+	Namespace string `yaml:"namespace"`
+	// Include and Exclude are regular expressions matched against the
+	// full metric names, filtering the exposed metrics.
+	Include string `yaml:"include"`
+	Exclude string `yaml:"exclude"`
+	// Legacy also exports the renamed metrics under their former names
+	// and types.
+	Legacy bool `yaml:"legacy"`
+}
+
+// LoadConfig reads and parses the YAML configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// resolveConfig reads the configuration file, if any, and applies the
+// settings of flagConfig, taken from flags and environment variables, over
+// it.
+func resolveConfig(configFile string, flagConfig *Config) (*Config, error) {
+	config := &Config{}
+	if configFile != "" {
+		var err error
+		config, err = LoadConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	config.Override(flagConfig)
+	if err := config.Metrics.validateNamespace(); err != nil {
+		return nil, err
+	}
+	if err := config.validateLabels(); err != nil {
+		return nil, err
+	}
+	if err := config.validateDiscovery(); err != nil {
+		return nil, err
+	}
+	if err := config.validateAlerts(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Override replaces every setting of c with the corresponding setting of o
+// when the latter is set.
+func (c *Config) Override(o *Config) {
+	overrideString(&c.RPC.Backend, o.RPC.Backend)
+	overrideString(&c.RPC.Mode, o.RPC.Mode)
+	overrideString(&c.RPC.Host, o.RPC.Host)
+	overrideString(&c.RPC.Username, o.RPC.Username)
+	overrideString(&c.RPC.Password, o.RPC.Password)
+	overrideString(&c.RPC.UsernameFile, o.RPC.UsernameFile)
+	overrideString(&c.RPC.PasswordFile, o.RPC.PasswordFile)
+	overrideString(&c.RPC.CookieFile, o.RPC.CookieFile)
+	overrideString(&c.RPC.Proxy, o.RPC.Proxy)
+	overrideString(&c.RPC.BtcdConfigFile, o.RPC.BtcdConfigFile)
+	overrideString(&c.RPC.TLS.CertFile, o.RPC.TLS.CertFile)
+	overrideString(&c.RPC.TLS.ServerName, o.RPC.TLS.ServerName)
+	o.overrideBool(&c.RPC.TLS.InsecureSkipVerify, &o.RPC.TLS.InsecureSkipVerify)
+	o.overrideBool(&c.RPC.LegacyGetInfo, &o.RPC.LegacyGetInfo)
+	o.overrideBool(&c.RPC.Batch, &o.RPC.Batch)
+	overrideString(&c.Wallet.Host, o.Wallet.Host)
+	overrideString(&c.Wallet.Username, o.Wallet.Username)
+	overrideString(&c.Wallet.Password, o.Wallet.Password)
+	overrideString(&c.Wallet.TLS.CertFile, o.Wallet.TLS.CertFile)
+	overrideString(&c.Wallet.Account, o.Wallet.Account)
+	overrideString(&c.Metrics.Namespace, o.Metrics.Namespace)
+	overrideString(&c.Metrics.Include, o.Metrics.Include)
+	overrideString(&c.Metrics.Exclude, o.Metrics.Exclude)
+	o.overrideBool(&c.Metrics.Legacy, &o.Metrics.Legacy)
+	for name, value := range o.Labels {
+		if c.Labels == nil {
+			c.Labels = make(map[string]string)
+		}
+		c.Labels[name] = value
+	}
+}
+
+// validateLabels checks the names of the constant labels, which cannot be
+// those of the labels of the collectors, and that the labels of the watched
+// addresses do not collide with them.
+func (c *Config) validateLabels() error {
+	for name := range c.Labels {
+		if !model.LabelName(name).IsValid() || name == "node" {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		for _, reserved := range collector.LabelNames() {
+			if name == reserved {
+				return fmt.Errorf("label %q is already a label of the metrics of the exporter", name)
+			}
+		}
+	}
+	for _, address := range c.Addresses {
+		for name := range address.Labels {
+			if _, ok := c.Labels[name]; ok || name == "node" {
+				return fmt.Errorf("label %q of address %s is already attached to every metric", name, address.Address)
+			}
+		}
+	}
+	return nil
+}
+
+// NodeConfigs returns the nodes to scrape. Without a nodes section, the rpc
+// section describes the only node, if it has a host.
+func (c *Config) NodeConfigs() ([]NodeConfig, error) {
+	// The process, disk and log sections describe the single node of the
+	// rpc section, they would otherwise be reported for every node.
+	if len(c.Nodes) > 0 || len(c.discoverers()) > 0 {
+		if c.Process != (collector.ProcessConfig{}) {
+			return nil, errors.New("the process section only applies without nodes section or service discovery, set the process of every node running on the host of the exporter in the nodes section instead")
+		}
+		if c.Disk != (collector.DiskConfig{}) {
+			return nil, errors.New("the disk section only applies without nodes section or service discovery, set the data directory of every node running on the host of the exporter in the nodes section instead")
+		}
+		if c.Log.File != "" || len(c.Log.Categories) > 0 {
+			return nil, errors.New("the log section only applies without nodes section or service discovery, set the log file of every node running on the host of the exporter in the nodes section instead")
+		}
+	}
+	nodes := c.Nodes
+	if len(nodes) == 0 {
+		if c.RPC.Host == "" && c.RPC.BtcdConfigFile == "" {
+			return nil, nil
+		}
+		nodes = []NodeConfig{{}}
+	}
+	names := make(map[string]bool)
+	// logFiles are the nodes by log file, a file being tailed with the
+	// categories of a single node.
+	logFiles := make(map[string]string)
+	resolved := make([]NodeConfig, 0, len(nodes))
+	for _, node := range nodes {
+		rpc := c.RPC
+		overrideString(&rpc.Backend, node.Backend)
+		overrideString(&rpc.Mode, node.Mode)
+		overrideString(&rpc.Host, node.Host)
+		overrideString(&rpc.Username, node.Username)
+		overrideString(&rpc.Password, node.Password)
+		// A file given for the node replaces the inherited value.
+		if node.UsernameFile != "" && node.Username == "" {
+			rpc.Username = ""
+		}
+		if node.PasswordFile != "" && node.Password == "" {
+			rpc.Password = ""
+		}
+		// So do credentials from a secret store.
+		if node.Credentials.Provider != "" {
+			if node.Username == "" {
+				rpc.Username = ""
+			}
+			if node.Password == "" {
+				rpc.Password = ""
+			}
+			rpc.Credentials = node.Credentials
+		}
+		overrideString(&rpc.UsernameFile, node.UsernameFile)
+		overrideString(&rpc.PasswordFile, node.PasswordFile)
+		overrideString(&rpc.CookieFile, node.CookieFile)
+		overrideString(&rpc.Proxy, node.Proxy)
+		overrideString(&rpc.BtcdConfigFile, node.BtcdConfigFile)
+		overrideString(&rpc.TLS.CertFile, node.TLS.CertFile)
+		overrideString(&rpc.TLS.ServerName, node.TLS.ServerName)
+		overrideBool(&rpc.TLS.InsecureSkipVerify, node.TLS.InsecureSkipVerify)
+		overrideBool(&rpc.LegacyGetInfo, node.LegacyGetInfo)
+		overrideBool(&rpc.Batch, node.Batch)
+		node.RPCConfig = rpc
+		if err := node.ApplyBtcdConfig(); err != nil {
+			return nil, err
+		}
+		if node.Name == "" {
+			node.Name = node.Host
+		}
+		if err := node.Validate(); err != nil {
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		if err := node.Process.Validate(); err != nil {
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		if err := node.Log.Validate(); err != nil {
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		if other, ok := logFiles[node.Log.File]; ok && node.Log.File != "" {
+			return nil, fmt.Errorf("node %q: log file %s is already the one of node %q", node.Name, node.Log.File, other)
+		}
+		logFiles[node.Log.File] = node.Name
+		if err := node.ReadCredentials(); err != nil {
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		if node.Host == "" || (node.CookieFile == "" && (node.Username == "" || node.Password == "")) {
+			return nil, fmt.Errorf("host, and username and password or a cookie file must be set for node %q (--rpc.host, --rpc.username or --rpc.username-file, --rpc.password or --rpc.password-file and --rpc.cookie-file, the corresponding BTCD_EXPORTER_ environment variables, or the config file)", node.Name)
+		}
+		if names[node.Name] {
+			return nil, fmt.Errorf("duplicate node name %q", node.Name)
+		}
+		names[node.Name] = true
+		resolved = append(resolved, node)
+	}
+	return resolved, nil
+}
+
+// collectorConfig returns the settings of the collectors scraping node. The
+// process, disk and log collectors measure a node running on the host of the
+// exporter: the process, disk and log sections describe the single node
+// configured without nodes section, while each node of the nodes section has
+// its own, the collectors being left out for the nodes without them.
+func (c *Config) collectorConfig(node NodeConfig) *collector.Config {
+	config := c.Config
+	if len(c.Nodes) == 0 {
+		return &config
+	}
+	config.Process, config.Disk, config.Log = node.Process, node.Disk, node.Log
+	var elsewhere []string
+	if node.Process == (collector.ProcessConfig{}) {
+		elsewhere = append(elsewhere, "process")
+	}
+	if node.Disk == (collector.DiskConfig{}) {
+		elsewhere = append(elsewhere, "disk")
+	}
+	if node.Log.File == "" {
+		elsewhere = append(elsewhere, "log")
+	}
+	config.Collectors = withoutCollectors(config.Collectors, elsewhere...)
+	return &config
+}
+
+// probeCollectorConfig returns the settings of the collectors scraping probe
+// targets, which run elsewhere than the exporter: the process, disk and log
+// collectors are left out.
+func (c *Config) probeCollectorConfig() *collector.Config {
+	config := c.Config
+	config.Process, config.Disk, config.Log = collector.ProcessConfig{}, collector.DiskConfig{}, collector.LogConfig{}
+	config.Collectors = withoutCollectors(config.Collectors, "process", "disk", "log")
+	return &config
+}
+
+// withoutCollectors returns a copy of collectors with names disabled.
+func withoutCollectors(collectors map[string]collector.CollectorConfig, names ...string) map[string]collector.CollectorConfig {
+	without := make(map[string]collector.CollectorConfig, len(collectors)+len(names))
+	for name, collectorConfig := range collectors {
+		without[name] = collectorConfig
+	}
+	disabled := false
+	for _, name := range names {
+		collectorConfig := without[name]
+		collectorConfig.Enabled = &disabled
+		without[name] = collectorConfig
+	}
+	return without
+}
+
+// validateNamespace checks that the configured namespace makes valid metric
+// names.
+func (c *MetricsConfig) validateNamespace() error {
+	if c.Namespace != "" && !model.IsValidMetricName(model.LabelValue(c.Namespace)) {
+		return fmt.Errorf("invalid metric namespace %q", c.Namespace)
+	}
+	return nil
+}
+
+func overrideString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+func overrideBool(dst *bool, value bool) {
+	if value {
+		*dst = true
+	}
+}
+
+// overrideBool sets dst to *value, a setting of o, when it is true or was
+// given as a flag or environment variable, which overrides the
+// configuration file even when false.
+func (o *Config) overrideBool(dst, value *bool) {
+	if *value || o.given[value] {
+		*dst = *value
+	}
+}
+
+// boolFlag returns the value of a boolean flag setting dst, recording that
+// the setting was given.
+func (c *Config) boolFlag(dst *bool) kingpin.Value {
+	return &givenBool{dst: dst, given: c.given}
+}
+
+// givenBool is a boolean flag value recording in given whether it was set,
+// on the command line or by its environment variable.
+type givenBool struct {
+	dst   *bool
+	given map[*bool]bool
+}
+
+func (b *givenBool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*b.dst = v
+	b.given[b.dst] = true
+	return nil
+}
+
+func (b *givenBool) String() string { return strconv.FormatBool(*b.dst) }
+
+// IsBoolFlag lets the flag be given without a value, and negated by its
+// --no- form.
+func (b *givenBool) IsBoolFlag() bool { return true }
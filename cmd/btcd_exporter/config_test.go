@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	content := `
+rpc:
+  host: file:8334
+  tls:
+    insecure_skip_verify: true
+metrics:
+  legacy: true
+`
+	if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		host       string
+		skipVerify bool
+		legacy     bool
+	}{{
+		name:       "file",
+		host:       "file:8334",
+		skipVerify: true,
+		legacy:     true,
+	}, {
+		name:       "env over file",
+		env:        map[string]string{"BTCD_EXPORTER_HOST": "env:8334", "BTCD_EXPORTER_TLS_SKIP_VERIFY": "false"},
+		host:       "env:8334",
+		skipVerify: false,
+		legacy:     true,
+	}, {
+		name:       "flags over env",
+		args:       []string{"--rpc.host=flag:8334", "--rpc.tls-skip-verify"},
+		env:        map[string]string{"BTCD_EXPORTER_HOST": "env:8334", "BTCD_EXPORTER_TLS_SKIP_VERIFY": "false"},
+		host:       "flag:8334",
+		skipVerify: true,
+		legacy:     true,
+	}, {
+		name:       "false flags over file",
+		args:       []string{"--no-rpc.tls-skip-verify", "--no-metrics.legacy"},
+		host:       "file:8334",
+		skipVerify: false,
+		legacy:     false,
+	}, {
+		name:       "false flag over env",
+		args:       []string{"--no-metrics.legacy"},
+		env:        map[string]string{"BTCD_EXPORTER_METRICS_LEGACY": "true"},
+		host:       "file:8334",
+		skipVerify: true,
+		legacy:     false,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			app := kingpin.New("btcd_exporter", "")
+			flagConfig := configFlags(app)
+			if _, err := app.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			config, err := resolveConfig(configFile, flagConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.RPC.Host != tc.host {
+				t.Errorf("got host %q, want %q", config.RPC.Host, tc.host)
+			}
+			if config.RPC.TLS.InsecureSkipVerify != tc.skipVerify {
+				t.Errorf("got insecure_skip_verify %v, want %v", config.RPC.TLS.InsecureSkipVerify, tc.skipVerify)
+			}
+			if config.Metrics.Legacy != tc.legacy {
+				t.Errorf("got legacy %v, want %v", config.Metrics.Legacy, tc.legacy)
+			}
+		})
+	}
+}
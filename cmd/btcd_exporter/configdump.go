@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+// secretPlaceholder replaces the secrets of the dumped configuration, as
+// Prometheus does.
+const secretPlaceholder = "<secret>"
+
+// configHandler serves the configuration in use as YAML, once the command-line
+// flags, environment variables and discovered nodes were applied, with its
+// secrets redacted.
+func configHandler(s *server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config, _, _ := s.current()
+		content, err := yaml.Marshal(config.redacted())
+		if err != nil {
+			slog.Error("error marshaling configuration", "err", err)
+			http.Error(w, "failed to marshal config", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+		w.Write(content)
+	})
+}
+
+// redacted returns a copy of c whose passwords and tokens are replaced with
+// secretPlaceholder, as are the passwords of proxy URLs. The files secrets are
+// read from are kept.
+func (c *Config) redacted() *Config {
+	redacted := *c
+	redactRPC(&redacted.RPC)
+	redactRPC(&redacted.Wallet.RPCConfig)
+	redacted.Nodes = make([]NodeConfig, len(c.Nodes))
+	for i, node := range c.Nodes {
+		redactRPC(&node.RPCConfig)
+		redacted.Nodes[i] = node
+	}
+	if c.Modules != nil {
+		redacted.Modules = make(map[string]collector.RPCConfig, len(c.Modules))
+		for name, module := range c.Modules {
+			redactRPC(&module)
+			redacted.Modules[name] = module
+		}
+	}
+	redacted.ConsulSD = make([]ConsulSDConfig, len(c.ConsulSD))
+	for i, consul := range c.ConsulSD {
+		redactSecret(&consul.Token)
+		redacted.ConsulSD[i] = consul
+	}
+	return &redacted
+}
+
+func redactRPC(rpc *collector.RPCConfig) {
+	redactSecret(&rpc.Password)
+	redactURL(&rpc.Proxy)
+}
+
+// redactURL replaces the password of the URL in rawURL, if any. A URL that
+// does not parse, and could not be used anyway, is redacted entirely.
+func redactURL(rawURL *string) {
+	if *rawURL == "" {
+		return
+	}
+	u, err := url.Parse(*rawURL)
+	if err != nil {
+		*rawURL = secretPlaceholder
+		return
+	}
+	*rawURL = u.Redacted()
+}
+
+func redactSecret(secret *string) {
+	if *secret != "" {
+		*secret = secretPlaceholder
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/version"
+)
+
+const defaultConsulServer = "http://localhost:8500"
+
+var (
+	consulRegister = kingpin.Flag(
+		"consul.register",
+		"Register the exporter as a service in Consul, with a health check of /healthz, and deregister it on shutdown.",
+	).Envar("BTCD_EXPORTER_CONSUL_REGISTER").Bool()
+	consulServer = kingpin.Flag(
+		"consul.server",
+		"URL of the Consul agent to register the exporter with.",
+	).Default(defaultConsulServer).Envar("BTCD_EXPORTER_CONSUL_SERVER").String()
+	consulToken = kingpin.Flag(
+		"consul.token",
+		"Consul ACL token allowed to register the service.",
+	).Envar("BTCD_EXPORTER_CONSUL_TOKEN").String()
+	consulServiceName = kingpin.Flag(
+		"consul.service-name",
+		"Name of the service the exporter registers as.",
+	).Default("btcd-exporter").Envar("BTCD_EXPORTER_CONSUL_SERVICE_NAME").String()
+	consulServiceAddress = kingpin.Flag(
+		"consul.service-address",
+		"Host and port at which Consul and Prometheus reach the exporter. Defaults to the host name and the port of --web.listen-address.",
+	).Envar("BTCD_EXPORTER_CONSUL_SERVICE_ADDRESS").String()
+	consulTags = kingpin.Flag(
+		"consul.tag",
+		"Tag of the registered service. Can be repeated.",
+	).Strings()
+)
+
+var consulClient = &http.Client{Timeout: 30 * time.Second}
+
+// consulRequest sends a request to the Consul HTTP API of server, encoding
+// body as JSON unless nil, and decodes the response into result unless nil.
+func consulRequest(ctx context.Context, method, server, token, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(server, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	resp, err := consulClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// validateConsul checks the Consul registration flags.
+func validateConsul(listenAddress string) error {
+	if !*consulRegister {
+		return nil
+	}
+	if listenAddress == "" && *consulServiceAddress == "" {
+		return errors.New("--consul.register needs --web.listen-address or --consul.service-address")
+	}
+	if _, ok := unixSocketPath(listenAddress); ok {
+		return errors.New("--consul.register needs --web.listen-address to be a TCP address, Consul cannot reach a unix socket")
+	}
+	if _, err := url.Parse(*consulServer); err != nil {
+		return fmt.Errorf("invalid --consul.server: %w", err)
+	}
+	return nil
+}
+
+// consulService is the registration of a service with a Consul agent.
+type consulService struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   consulCheck       `json:"Check"`
+}
+
+type consulCheck struct {
+	HTTP                           string `json:"HTTP"`
+	TLSSkipVerify                  bool   `json:"TLSSkipVerify"`
+	Interval                       string `json:"Interval"`
+	Timeout                        string `json:"Timeout"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+// registerConsul registers the exporter listening on listenAddress with the
+// Consul agent of --consul.server and returns the function deregistering it.
+func registerConsul(ctx context.Context, listenAddress string, tlsEnabled bool) (func(), error) {
+	address := *consulServiceAddress
+	if address == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		_, port, err := net.SplitHostPort(listenAddress)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --web.listen-address: %w", err)
+		}
+		address = net.JoinHostPort(hostname, port)
+	}
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the service address: %w", err)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port of the service address %q", address)
+	}
+	scheme := "http"
+	if tlsEnabled {
+		scheme = "https"
+	}
+	service := consulService{
+		ID:      *consulServiceName + "-" + host + "-" + portString,
+		Name:    *consulServiceName,
+		Tags:    *consulTags,
+		Address: host,
+		Port:    port,
+		Meta:    map[string]string{"version": version.Version},
+		Check: consulCheck{
+			HTTP:          scheme + "://" + address + "/healthz",
+			TLSSkipVerify: true,
+			Interval:      "15s",
+			Timeout:       "5s",
+			// Services left behind by a killed exporter are removed
+			// eventually.
+			DeregisterCriticalServiceAfter: "30m",
+		},
+	}
+	if err := consulRequest(ctx, http.MethodPut, *consulServer, *consulToken, "/v1/agent/service/register", service, nil); err != nil {
+		return nil, err
+	}
+	slog.Info("registered with Consul", "server", *consulServer, "service", service.Name, "id", service.ID)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := consulRequest(ctx, http.MethodPut, *consulServer, *consulToken, "/v1/agent/service/deregister/"+url.PathEscape(service.ID), nil, nil); err != nil {
+			slog.Warn("error deregistering from Consul", "server", *consulServer, "err", err)
+		}
+	}, nil
+}
+
+// ConsulSDConfig discovers the btcd nodes registered as a Consul service.
+type ConsulSDConfig struct {
+	// Server defaults to the local Consul agent.
+	Server     string `yaml:"server"`
+	Token      string `yaml:"token"`
+	Datacenter string `yaml:"datacenter"`
+	Service    string `yaml:"service"`
+	// Tags the instances must all have.
+	Tags            []string       `yaml:"tags"`
+	RefreshInterval model.Duration `yaml:"refresh_interval"`
+}
+
+func (c ConsulSDConfig) validate() error {
+	if c.Service == "" {
+		return errors.New("consul_sd_configs: service must be set")
+	}
+	if c.Server != "" {
+		if _, err := url.Parse(c.Server); err != nil {
+			return fmt.Errorf("consul_sd_configs: invalid server: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c ConsulSDConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval > 0 {
+		return time.Duration(c.RefreshInterval)
+	}
+	return defaultDiscoveryRefresh
+}
+
+// consulServiceEntry holds the fields of a healthy service instance the
+// exporter uses.
+type consulServiceEntry struct {
+	Node struct {
+		Node    string `json:"Node"`
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string `json:"ID"`
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
+
+// discover lists the instances of the service passing their health checks.
+// Each becomes a node named after its Consul node, followed by the service ID
+// when a Consul node runs several instances.
+func (c ConsulSDConfig) discover(ctx context.Context) ([]NodeConfig, error) {
+	server := c.Server
+	if server == "" {
+		server = defaultConsulServer
+	}
+	query := url.Values{"passing": {"true"}}
+	if c.Datacenter != "" {
+		query.Set("dc", c.Datacenter)
+	}
+	for _, tag := range c.Tags {
+		query.Add("tag", tag)
+	}
+	var entries []consulServiceEntry
+	path := "/v1/health/service/" + url.PathEscape(c.Service) + "?" + query.Encode()
+	if err := consulRequest(ctx, http.MethodGet, server, c.Token, path, nil, &entries); err != nil {
+		return nil, fmt.Errorf("listing instances of service %s: %w", c.Service, err)
+	}
+
+	instances := map[string]int{}
+	for _, entry := range entries {
+		instances[entry.Node.Node]++
+	}
+	var nodes []NodeConfig
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		node := NodeConfig{Name: entry.Node.Node}
+		if instances[entry.Node.Node] > 1 {
+			node.Name += "/" + entry.Service.ID
+		}
+		node.Host = net.JoinHostPort(address, strconv.Itoa(entry.Service.Port))
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+// dashboardHandler serves a Grafana dashboard of the metrics of the enabled
+// collectors, generated by the running version so that it queries the metrics
+// it emits.
+func dashboardHandler(s *server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config, _, _ := s.current()
+		content, err := collector.Dashboard(s.options.Namespace, config.EnabledCollectors())
+		if err != nil {
+			slog.Error("error generating dashboard", "err", err)
+			http.Error(w, "failed to generate dashboard", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	})
+}
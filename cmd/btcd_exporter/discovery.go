@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// discoverer finds nodes to scrape, like the pods of a Kubernetes cluster.
+type discoverer interface {
+	// discover returns the nodes found, with their name and host set. The
+	// other settings are taken from the rpc section.
+	discover(ctx context.Context) ([]NodeConfig, error)
+	refreshInterval() time.Duration
+}
+
+const (
+	defaultDiscoveryRefresh = time.Minute
+	// discoveryTimeout bounds a single discovery.
+	discoveryTimeout = 30 * time.Second
+)
+
+// discoverers returns the service discoveries of the configuration.
+func (c *Config) discoverers() []discoverer {
+	var discoverers []discoverer
+	for _, sd := range c.KubernetesSD {
+		discoverers = append(discoverers, sd)
+	}
+	for _, sd := range c.DNSSD {
+		discoverers = append(discoverers, sd)
+	}
+	for _, sd := range c.ConsulSD {
+		discoverers = append(discoverers, sd)
+	}
+	return discoverers
+}
+
+// validateDiscovery checks the settings of the service discoveries.
+func (c *Config) validateDiscovery() error {
+	// The discovered nodes take the place of the single node of the rpc
+	// section, which would silently stop being scraped.
+	if len(c.discoverers()) > 0 && len(c.Nodes) == 0 && c.RPC.Host != "" {
+		return errors.New("rpc.host sets the single node scraped without nodes section or service discovery, list that node in the nodes section to scrape it next to the discovered nodes")
+	}
+	for _, sd := range c.KubernetesSD {
+		if err := sd.validate(); err != nil {
+			return err
+		}
+	}
+	for _, sd := range c.DNSSD {
+		if err := sd.validate(); err != nil {
+			return err
+		}
+	}
+	for _, sd := range c.ConsulSD {
+		if err := sd.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discoveryManager runs the service discoveries of the configuration,
+// calling onChange when the nodes they find change.
+type discoveryManager struct {
+	onChange func()
+
+	mtx         sync.Mutex
+	discoverers []discoverer
+	run         *discoveryRun
+}
+
+// discoveryRun holds the nodes found by the discoverers of a configuration,
+// until the discoverers change.
+type discoveryRun struct {
+	cancel context.CancelFunc
+	mtx    sync.Mutex
+	found  [][]NodeConfig
+}
+
+func newDiscoveryManager(onChange func()) *discoveryManager {
+	return &discoveryManager{onChange: onChange}
+}
+
+// discoveryUpdate holds the nodes found by the discoverers of a
+// configuration being loaded. They only replace the running discoverers once
+// committed, the configuration turning out to be usable.
+type discoveryUpdate struct {
+	m           *discoveryManager
+	discoverers []discoverer
+	run         *discoveryRun
+	// ctx is the context of a new run, nil if the discoverers are already
+	// running.
+	ctx context.Context
+}
+
+// prepare runs the discoverers of config once, unless they are already
+// running, so that their nodes are known before the configuration is used.
+// Nothing changes until the update is committed or discarded.
+func (m *discoveryManager) prepare(config *Config) *discoveryUpdate {
+	discoverers := config.discoverers()
+	m.mtx.Lock()
+	if reflect.DeepEqual(discoverers, m.discoverers) {
+		defer m.mtx.Unlock()
+		return &discoveryUpdate{m: m, discoverers: discoverers, run: m.run}
+	}
+	m.mtx.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &discoveryRun{cancel: cancel, found: make([][]NodeConfig, len(discoverers))}
+	for i, d := range discoverers {
+		run.refresh(ctx, i, d)
+	}
+	return &discoveryUpdate{m: m, discoverers: discoverers, run: run, ctx: ctx}
+}
+
+// nodes returns the nodes found by the discoverers of the update.
+func (u *discoveryUpdate) nodes() []NodeConfig {
+	if u.run == nil {
+		return nil
+	}
+	return u.run.nodes()
+}
+
+// commit replaces the running discoverers with those of the update, which
+// are then refreshed in the background.
+func (u *discoveryUpdate) commit() {
+	if u.ctx == nil {
+		return
+	}
+	m := u.m
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.run != nil {
+		m.run.cancel()
+	}
+	m.discoverers, m.run = u.discoverers, u.run
+	for i, d := range u.discoverers {
+		go func(i int, d discoverer) {
+			ticker := time.NewTicker(d.refreshInterval())
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+				case <-u.ctx.Done():
+					return
+				}
+				if u.run.refresh(u.ctx, i, d) {
+					m.onChange()
+				}
+			}
+		}(i, d)
+	}
+}
+
+// discard releases the discoverers of an update which is not committed.
+func (u *discoveryUpdate) discard() {
+	if u.ctx != nil {
+		u.run.cancel()
+	}
+}
+
+// refresh runs the i-th discoverer d and reports whether the nodes it found
+// changed. On error, the previous nodes are kept.
+func (r *discoveryRun) refresh(ctx context.Context, i int, d discoverer) bool {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	nodes, err := d.discover(ctx)
+	if err != nil {
+		// Errors of discoverers being stopped are not worth logging.
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			slog.Warn("error discovering nodes", "err", err)
+		}
+		return false
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if reflect.DeepEqual(nodes, r.found[i]) {
+		return false
+	}
+	slog.Info("discovered nodes changed", "nodes", len(nodes))
+	r.found[i] = nodes
+	return true
+}
+
+// nodes returns the nodes found by the discoverers of the run.
+func (r *discoveryRun) nodes() []NodeConfig {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var nodes []NodeConfig
+	for _, found := range r.found {
+		nodes = append(nodes, found...)
+	}
+	return nodes
+}
+
+// stop stops the running discoverers.
+func (m *discoveryManager) stop() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.run != nil {
+		m.run.cancel()
+	}
+	m.discoverers, m.run = nil, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// DNSSDConfig discovers nodes from DNS records.
+type DNSSDConfig struct {
+	Names []string `yaml:"names"`
+	// Type is SRV, the default, A or AAAA.
+	Type string `yaml:"type"`
+	// Port is the RPC port of the nodes found with A or AAAA records.
+	Port            int            `yaml:"port"`
+	RefreshInterval model.Duration `yaml:"refresh_interval"`
+}
+
+func (c DNSSDConfig) validate() error {
+	if len(c.Names) == 0 {
+		return errors.New("dns_sd_configs: names must be set")
+	}
+	switch strings.ToUpper(c.Type) {
+	case "", "SRV":
+	case "A", "AAAA":
+		if c.Port == 0 {
+			return fmt.Errorf("dns_sd_configs: port must be set for %s records", c.Type)
+		}
+	default:
+		return fmt.Errorf("dns_sd_configs: unknown record type %q", c.Type)
+	}
+	return nil
+}
+
+func (c DNSSDConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval > 0 {
+		return time.Duration(c.RefreshInterval)
+	}
+	return defaultDiscoveryRefresh
+}
+
+// discover resolves the names. Each target of an SRV record, or address of an
+// A or AAAA record, becomes a node named after its host and port.
+func (c DNSSDConfig) discover(ctx context.Context) ([]NodeConfig, error) {
+	var nodes []NodeConfig
+	add := func(host string, port int) {
+		node := NodeConfig{}
+		node.Host = net.JoinHostPort(host, strconv.Itoa(port))
+		node.Name = node.Host
+		nodes = append(nodes, node)
+	}
+	for _, name := range c.Names {
+		switch strings.ToUpper(c.Type) {
+		case "", "SRV":
+			_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				add(strings.TrimSuffix(record.Target, "."), int(record.Port))
+			}
+		case "A", "AAAA":
+			network := "ip4"
+			if strings.ToUpper(c.Type) == "AAAA" {
+				network = "ip6"
+			}
+			ips, err := net.DefaultResolver.LookupIP(ctx, network, name)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				add(ip.String(), c.Port)
+			}
+		}
+	}
+	return nodes, nil
+}
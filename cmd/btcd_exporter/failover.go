@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+var failoverCheckInterval = kingpin.Flag(
+	"rpc.failover-check-interval",
+	"How often to check the active RPC endpoint of the nodes with failover hosts. A node fails over to the next endpoint answering once its active one failed two checks in a row, and back to an earlier one once it answers again.",
+).Default("5s").Duration()
+
+// failoverThreshold is how many checks in a row the active endpoint of a node
+// has to fail for the node to fail over, so that a node whose connection is
+// still being established is left alone.
+const failoverThreshold = 2
+
+// failoverCheckTimeout bounds the check of a single endpoint.
+const failoverCheckTimeout = 5 * time.Second
+
+// endpoints returns the hosts of the node in order of preference.
+func (n NodeConfig) endpoints() []string {
+	return append([]string{n.Host}, n.FailoverHosts...)
+}
+
+// failover tracks the endpoint each node with failover hosts is scraped
+// through.
+type failover struct {
+	mtx sync.Mutex
+	// active maps node names to the host in use, when it is not the first.
+	active   map[string]string
+	failures map[string]int
+
+	endpointActive *prometheus.GaugeVec
+	failovers      *prometheus.CounterVec
+}
+
+func newFailover(namespace string) *failover {
+	f := &failover{
+		active:   make(map[string]string),
+		failures: make(map[string]int),
+		endpointActive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "exporter",
+				Name:      "rpc_endpoint_active",
+				Help:      "Whether the RPC endpoint is the one a node with failover hosts is scraped through.",
+			},
+			[]string{"node", "host"},
+		),
+		failovers: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "exporter",
+				Name:      "rpc_failovers_total",
+				Help:      "How many times a node switched to another RPC endpoint.",
+			},
+			[]string{"node"},
+		),
+	}
+	registry.MustRegister(f.endpointActive, f.failovers)
+	return f
+}
+
+// host returns the endpoint node is to be scraped through.
+func (f *failover) host(node NodeConfig) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	active, ok := f.active[node.Name]
+	if !ok {
+		return node.Host
+	}
+	for _, host := range node.endpoints() {
+		if host == active {
+			return active
+		}
+	}
+	// The endpoint is no longer configured.
+	delete(f.active, node.Name)
+	return node.Host
+}
+
+// update exports the active endpoints of targets.
+func (f *failover) update(targets []*target) {
+	f.endpointActive.Reset()
+	for _, t := range targets {
+		if len(t.endpoints) < 2 {
+			continue
+		}
+		for _, host := range t.endpoints {
+			active := 0.0
+			if host == t.host {
+				active = 1
+			}
+			f.endpointActive.WithLabelValues(t.node, host).Set(active)
+		}
+	}
+}
+
+// check checks the active endpoint of every node of s with failover hosts and
+// the endpoints preferred over it, and reports whether a node switched
+// endpoint.
+func (f *failover) check(ctx context.Context, s *server) bool {
+	_, _, targets := s.current()
+	changed := false
+	for _, t := range targets {
+		if len(t.endpoints) < 2 {
+			continue
+		}
+		if host, ok := f.checkTarget(ctx, s, t); ok {
+			slog.Warn("failing over to another RPC endpoint", "node", t.node, "from", t.host, "to", host)
+			f.mtx.Lock()
+			f.active[t.node] = host
+			f.failures[t.node] = 0
+			f.mtx.Unlock()
+			f.failovers.WithLabelValues(t.node).Inc()
+			changed = true
+		}
+	}
+	return changed
+}
+
+// checkTarget returns the endpoint t should switch to, if any: the first
+// answering endpoint preferred over the active one, or, once the active one
+// failed failoverThreshold checks in a row, the first answering one.
+func (f *failover) checkTarget(ctx context.Context, s *server, t *target) (string, bool) {
+	checkCtx, cancel := context.WithTimeout(ctx, failoverCheckTimeout)
+	err := t.exporter.Client().Ready(checkCtx)
+	cancel()
+	f.mtx.Lock()
+	if err == nil {
+		f.failures[t.node] = 0
+	} else {
+		f.failures[t.node]++
+	}
+	failed := f.failures[t.node] >= failoverThreshold
+	f.mtx.Unlock()
+	if err != nil {
+		slog.Debug("RPC endpoint check failed", "node", t.node, "host", t.host, "err", err)
+	}
+	for _, host := range t.endpoints {
+		if host == t.host {
+			if !failed {
+				return "", false
+			}
+			continue
+		}
+		if s.endpointReady(ctx, t, host) {
+			return host, true
+		}
+	}
+	return "", false
+}
+
+// endpointReady reports whether the node t reached through host answers.
+func (s *server) endpointReady(ctx context.Context, t *target, host string) bool {
+	rpc := t.rpc
+	rpc.Host = host
+	client, err := collector.NewClient(rpc, false, s.options)
+	if err != nil {
+		slog.Debug("RPC endpoint check failed", "node", t.node, "host", host, "err", err)
+		return false
+	}
+	defer client.Shutdown()
+	ctx, cancel := context.WithTimeout(ctx, failoverCheckTimeout)
+	defer cancel()
+	if err := client.Ready(ctx); err != nil {
+		slog.Debug("RPC endpoint check failed", "node", t.node, "host", host, "err", err)
+		return false
+	}
+	return true
+}
+
+// runFailover checks the endpoints of the nodes of s every
+// --rpc.failover-check-interval until ctx is done, reloading s when a node
+// switches endpoint.
+func (s *server) runFailover(ctx context.Context) {
+	ticker := time.NewTicker(*failoverCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if !s.failover.check(ctx, s) {
+			continue
+		}
+		if err := s.reload(); err != nil {
+			slog.Error("error applying RPC endpoint failover", "err", err)
+		}
+	}
+}
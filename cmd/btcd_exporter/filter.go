@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricFilter drops the metrics whose name is not matched by include or is
+// matched by exclude. The expressions are anchored at both ends, as in
+// Prometheus relabeling, and unset ones do not filter anything.
+type metricFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newMetricFilter(include, exclude string) (*metricFilter, error) {
+	f := &metricFilter{}
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile("^(?:" + include + ")$"); err != nil {
+			return nil, fmt.Errorf("error parsing metrics include expression: %w", err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile("^(?:" + exclude + ")$"); err != nil {
+			return nil, fmt.Errorf("error parsing metrics exclude expression: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// keep reports whether the metrics called name are exposed.
+func (f *metricFilter) keep(name string) bool {
+	if f.include != nil && !f.include.MatchString(name) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(name)
+}
+
+// gatherer returns a Gatherer serving the metrics of g which pass the filter.
+func (f *metricFilter) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if f.include == nil && f.exclude == nil {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		kept := families[:0]
+		for _, family := range families {
+			if f.keep(family.GetName()) {
+				kept = append(kept, family)
+			}
+		}
+		return kept, err
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fleetGatherer returns the metrics of nodes along with metrics comparing
+// the nodes, computed from the block height, best block and chain they
+// reported, so that a single alert tells when they diverge. The latter carry
+// labels, the constant labels of the configuration, and are named in
+// namespace like the metrics of the nodes.
+func fleetGatherer(nodes prometheus.Gatherer, labels prometheus.Labels, namespace string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := nodes.Gather()
+		reg := prometheus.NewRegistry()
+		prometheus.WrapRegistererWith(labels, reg).MustRegister(newFleetCollector(families, namespace))
+		fleet, fleetErr := reg.Gather()
+		if err == nil {
+			err = fleetErr
+		}
+		families = append(families, fleet...)
+		sort.Slice(families, func(i, j int) bool {
+			return families[i].GetName() < families[j].GetName()
+		})
+		return families, err
+	})
+}
+
+// nodeBest is the best block reported by a node.
+type nodeBest struct {
+	chain  string
+	height float64
+	hash   string
+}
+
+// fleetCollector exports the fleet metrics of the best blocks reported by
+// the nodes, per chain.
+type fleetCollector struct {
+	best map[string]*nodeBest
+
+	nodes        *prometheus.Desc
+	heightSpread *prometheus.Desc
+	hashes       *prometheus.Desc
+	consensus    *prometheus.Desc
+}
+
+func newFleetCollector(families []*dto.MetricFamily, namespace string) *fleetCollector {
+	c := &fleetCollector{
+		best: make(map[string]*nodeBest),
+		nodes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "nodes"),
+			"How many nodes reported their best block.",
+			[]string{"chain"}, nil,
+		),
+		heightSpread: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "block_height_spread"),
+			"Difference between the highest and the lowest block height reported by the nodes.",
+			[]string{"chain"}, nil,
+		),
+		hashes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "best_block_hashes"),
+			"How many different best blocks the nodes reported.",
+			[]string{"chain"}, nil,
+		),
+		consensus: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "fleet", "consensus"),
+			"Whether every node reported the same best block.",
+			[]string{"chain"}, nil,
+		),
+	}
+	// node returns what is known of the best block of the node m belongs
+	// to.
+	node := func(m *dto.Metric) *nodeBest {
+		name := labelValue(m, "node")
+		if c.best[name] == nil {
+			c.best[name] = &nodeBest{height: -1}
+		}
+		return c.best[name]
+	}
+	for _, family := range families {
+		switch family.GetName() {
+		case namespace + "_block_height":
+			for _, m := range family.GetMetric() {
+				node(m).height = m.GetGauge().GetValue()
+			}
+		case namespace + "_best_block_info":
+			for _, m := range family.GetMetric() {
+				node(m).hash = labelValue(m, "hash")
+			}
+		case namespace + "_chain_info":
+			for _, m := range family.GetMetric() {
+				node(m).chain = labelValue(m, "chain")
+			}
+		}
+	}
+	return c
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func (c *fleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.nodes
+	ch <- c.heightSpread
+	ch <- c.hashes
+	ch <- c.consensus
+}
+
+func (c *fleetCollector) Collect(ch chan<- prometheus.Metric) {
+	type chainStats struct {
+		nodes    int
+		min, max float64
+		hashes   map[string]bool
+	}
+	chains := make(map[string]*chainStats)
+	for _, best := range c.best {
+		// Nodes which are down or whose chain collector failed are left
+		// out.
+		if best.height < 0 || best.hash == "" {
+			continue
+		}
+		s, ok := chains[best.chain]
+		if !ok {
+			s = &chainStats{min: best.height, max: best.height, hashes: make(map[string]bool)}
+			chains[best.chain] = s
+		}
+		s.nodes++
+		if best.height < s.min {
+			s.min = best.height
+		}
+		if best.height > s.max {
+			s.max = best.height
+		}
+		s.hashes[best.hash] = true
+	}
+	for chain, s := range chains {
+		consensus := 0.0
+		if len(s.hashes) == 1 {
+			consensus = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.nodes, prometheus.GaugeValue, float64(s.nodes), chain)
+		ch <- prometheus.MustNewConstMetric(c.heightSpread, prometheus.GaugeValue, s.max-s.min, chain)
+		ch <- prometheus.MustNewConstMetric(c.hashes, prometheus.GaugeValue, float64(len(s.hashes)), chain)
+		ch <- prometheus.MustNewConstMetric(c.consensus, prometheus.GaugeValue, consensus, chain)
+	}
+}
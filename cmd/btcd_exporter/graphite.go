@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var (
+	graphiteAddress = kingpin.Flag(
+		"graphite.address",
+		"Host and port of a Carbon server to send the metrics to with the Graphite plaintext protocol. Disabled if empty.",
+	).Envar("BTCD_EXPORTER_GRAPHITE_ADDRESS").String()
+	graphiteInterval = kingpin.Flag(
+		"graphite.interval",
+		"How often to send the metrics to Graphite.",
+	).Default("30s").Envar("BTCD_EXPORTER_GRAPHITE_INTERVAL").Duration()
+	graphitePrefix = kingpin.Flag(
+		"graphite.prefix",
+		"Prefix of the sent metric paths, for example bitcoin.edge-1.",
+	).Envar("BTCD_EXPORTER_GRAPHITE_PREFIX").String()
+)
+
+// runGraphite sends the metrics of s to Carbon every --graphite.interval
+// until ctx is done.
+func runGraphite(ctx context.Context, s *server) {
+	slog.Info("sending metrics to Graphite", "address", *graphiteAddress, "interval", *graphiteInterval)
+	runPeriodically(ctx, *graphiteInterval, func(ctx context.Context) {
+		families, err := s.gatherer(ctx).Gather()
+		if err != nil {
+			slog.Warn("error gathering metrics", "err", err)
+		}
+		if err := sendGraphite(ctx, flatten(families, time.Now())); err != nil {
+			slog.Warn("error sending metrics to Graphite", "address", *graphiteAddress, "err", err)
+		}
+	})
+}
+
+// sendGraphite writes the samples to Carbon over a new TCP connection, one
+// "path value timestamp" line each.
+func sendGraphite(ctx context.Context, samples []sample) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", *graphiteAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	w := bufio.NewWriter(conn)
+	for _, sample := range samples {
+		w.WriteString(graphitePath(*graphitePrefix, sample))
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatInt(sample.timestamp.Unix(), 10))
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// graphitePath names a sample the way the Graphite bridge of the Prometheus
+// client does: the metric name followed by the name and value of each label,
+// separated by dots.
+func graphitePath(prefix string, s sample) string {
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(strings.TrimSuffix(prefix, "."))
+		b.WriteByte('.')
+	}
+	b.WriteString(s.name)
+	for _, l := range s.labels {
+		b.WriteByte('.')
+		b.WriteString(l.name)
+		b.WriteByte('.')
+		b.WriteString(graphiteEscape(l.value))
+	}
+	return b.String()
+}
+
+// graphiteEscape replaces the characters of a label value which have a
+// meaning in a Graphite path.
+func graphiteEscape(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, value)
+}
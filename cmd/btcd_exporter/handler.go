@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+var (
+	scrapeTimeout = kingpin.Flag(
+		"scrape.timeout",
+		"Maximum duration of a scrape. Lowered to the timeout sent by Prometheus in the X-Prometheus-Scrape-Timeout-Seconds header, minus --scrape.timeout-offset.",
+	).Default("10s").Duration()
+	scrapeTimeoutOffset = kingpin.Flag(
+		"scrape.timeout-offset",
+		"Time subtracted from the Prometheus scrape timeout, left for sending the response.",
+	).Default("500ms").Duration()
+	maxRequests = kingpin.Flag(
+		"web.max-requests",
+		"Maximum number of scrapes of /metrics and /probe served in parallel, further ones being answered with 503. 0 means no limit.",
+	).Default("10").Envar("BTCD_EXPORTER_WEB_MAX_REQUESTS").Int()
+)
+
+// registry holds the metrics of the exporter itself. The Go runtime and
+// process metrics are only registered with it when enabled.
+var registry = prometheus.NewRegistry()
+
+// scrapeLimiter bounds the number of scrapes in progress, shared by the
+// handlers it wraps.
+type scrapeLimiter struct {
+	inFlight chan struct{}
+	rejected prometheus.Counter
+}
+
+// newScrapeLimiter returns a limiter of max scrapes, nil without a limit,
+// counting the rejected scrapes in namespace.
+func newScrapeLimiter(max int, namespace string) *scrapeLimiter {
+	if max <= 0 {
+		return nil
+	}
+	l := &scrapeLimiter{
+		inFlight: make(chan struct{}, max),
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "scrapes_rejected_total",
+			Help:      "How many scrapes were answered with 503 because --web.max-requests scrapes were in progress.",
+		}),
+	}
+	registry.MustRegister(l.rejected)
+	return l
+}
+
+// wrap answers requests to next with 503 while the limit is reached.
+func (l *scrapeLimiter) wrap(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.inFlight <- struct{}{}:
+			defer func() { <-l.inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			l.rejected.Inc()
+			http.Error(w, "Too many scrapes in progress", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// target is a node whose metrics are served on /metrics.
+type target struct {
+	node    string
+	host    string
+	backend string
+	// rpc holds the settings the node is connected with, endpoints its
+	// hosts in order of preference when it has failover hosts.
+	rpc       collector.RPCConfig
+	endpoints []string
+	labels    prometheus.Labels
+	// collectors is the configuration exporter was created with, kept to
+	// recreate it along with its client.
+	collectors *collector.Config
+	exporter   *collector.Exporter
+	// poller is set when the node is polled in the background.
+	poller *collector.PollingCollector
+}
+
+// scrapeContext returns a context which is done when the scrape requested by
+// r has to be answered.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := *scrapeTimeout
+	if header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); header != "" {
+		seconds, err := strconv.ParseFloat(header, 64)
+		if err != nil {
+			slog.Warn("error parsing X-Prometheus-Scrape-Timeout-Seconds header", "header", header, "err", err)
+		} else if prometheusTimeout := time.Duration(seconds*float64(time.Second)) - *scrapeTimeoutOffset; prometheusTimeout > 0 && prometheusTimeout < timeout {
+			timeout = prometheusTimeout
+		}
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// scrapeCollector collects an Exporter within the context of a scrape.
+type scrapeCollector struct {
+	ctx      context.Context
+	exporter *collector.Exporter
+}
+
+func (c *scrapeCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporter.Describe(ch)
+}
+
+func (c *scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.exporter.CollectContext(c.ctx, ch)
+}
+
+// collector returns the collector of the metrics of t, querying the node
+// until ctx is done unless it is polled.
+func (t *target) collector(ctx context.Context) prometheus.Collector {
+	if t.poller != nil {
+		return t.poller
+	}
+	return &scrapeCollector{ctx: ctx, exporter: t.exporter}
+}
+
+// gatherer returns the metrics of the current targets of s along with those
+// of the exporter itself, which pass the current filter. The nodes which are
+// not polled are queried until ctx is done.
+func (s *server) gatherer(ctx context.Context) prometheus.Gatherer {
+	config, filter, targets := s.current()
+	return filter.gatherer(prometheus.Gatherers{registry, nodesGatherer(ctx, config, targets, s.options.Namespace)})
+}
+
+// nodesGatherer returns the metrics of targets, unfiltered. With several
+// nodes, the fleet metrics comparing them are added, named in namespace.
+func nodesGatherer(ctx context.Context, config *Config, targets []*target, namespace string) prometheus.Gatherer {
+	reg := prometheus.NewRegistry()
+	for _, t := range targets {
+		prometheus.WrapRegistererWith(t.labels, reg).MustRegister(t.collector(ctx))
+	}
+	if len(targets) > 1 {
+		return fleetGatherer(reg, config.Labels, namespace)
+	}
+	return reg
+}
+
+// nodeGatherer returns the metrics of the current target named node which
+// pass the current filter, or false if there is none.
+func (s *server) nodeGatherer(ctx context.Context, node string) (prometheus.Gatherer, bool) {
+	_, filter, targets := s.current()
+	for _, t := range targets {
+		if t.node == node {
+			reg := prometheus.NewRegistry()
+			prometheus.WrapRegistererWith(t.labels, reg).MustRegister(t.collector(ctx))
+			return filter.gatherer(reg), true
+		}
+	}
+	return nil, false
+}
+
+// metricsHandler serves the metrics gathered from s, or only those of a
+// single node given by the node query parameter.
+func metricsHandler(s *server) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+		gatherer := s.gatherer(ctx)
+		if node := r.URL.Query().Get("node"); node != "" {
+			var ok bool
+			if gatherer, ok = s.nodeGatherer(ctx, node); !ok {
+				http.Error(w, fmt.Sprintf("Unknown node %q", node), http.StatusNotFound)
+				return
+			}
+		}
+		promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(w, r)
+	})
+	return promhttp.InstrumentMetricHandler(registry, handler)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// healthHandler answers as long as the exporter is running.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK\n"))
+}
+
+// readyHandler answers with 200 when every node is connected and answering
+// RPC calls, and 503 listing the failing nodes otherwise.
+func readyHandler(s *server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, targets := s.current()
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+
+		var (
+			wg       sync.WaitGroup
+			mtx      sync.Mutex
+			failures []string
+		)
+		for _, t := range targets {
+			wg.Add(1)
+			go func(t *target) {
+				defer wg.Done()
+				if err := t.exporter.Client().Ready(ctx); err != nil {
+					mtx.Lock()
+					failures = append(failures, fmt.Sprintf("%s: %s", t.node, err))
+					mtx.Unlock()
+				}
+			}(t)
+		}
+		wg.Wait()
+		if len(failures) > 0 {
+			http.Error(w, strings.Join(failures, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK\n"))
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+// healthcheckTimeout bounds the healthcheck command.
+const healthcheckTimeout = 5 * time.Second
+
+// runHealthcheck runs the healthcheck command: it requests url, by default
+// /healthz of the exporter listening on listenAddress, or with rpc calls the
+// nodes of the configuration resolved from configFile and flagConfig.
+func runHealthcheck(configFile string, flagConfig *Config, listenAddress, url string, rpc bool) error {
+	if rpc {
+		config, err := resolveConfig(configFile, flagConfig)
+		if err != nil {
+			return err
+		}
+		return checkNodesHealth(config)
+	}
+	socket := ""
+	if url == "" {
+		webConfig, err := loadWebConfig(*webConfigFile)
+		if err != nil {
+			return err
+		}
+		if url, err = healthcheckURL(listenAddress, webConfig.tls); err != nil {
+			return err
+		}
+		socket, _ = unixSocketPath(listenAddress)
+	}
+	return checkHealthURL(url, socket)
+}
+
+// healthcheckURL returns the URL of /healthz of an exporter listening on
+// listenAddress, reached through the loopback interface when it listens on
+// every interface. The host of an exporter listening on a unix socket is
+// localhost.
+func healthcheckURL(listenAddress string, tlsEnabled bool) (string, error) {
+	scheme := "http"
+	if tlsEnabled {
+		scheme = "https"
+	}
+	if _, ok := unixSocketPath(listenAddress); ok {
+		return scheme + "://localhost/healthz", nil
+	}
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return "", fmt.Errorf("error parsing --web.listen-address: %w", err)
+	}
+	switch host {
+	case "", "0.0.0.0", "::":
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + "/healthz", nil
+}
+
+// checkHealthURL requests url and fails unless it answers 200, through the
+// unix socket at socket if set. The certificate of a local exporter is not
+// verified.
+func checkHealthURL(url, socket string) error {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if socket != "" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	client := &http.Client{
+		Timeout:   healthcheckTimeout,
+		Transport: transport,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s answered %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// checkNodesHealth connects to every node of config and fails unless each
+// answers an RPC call.
+func checkNodesHealth(config *Config) error {
+	nodes, err := config.NodeConfigs()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+	defer cancel()
+	options := newOptions(config)
+	for _, node := range nodes {
+		client, err := collector.NewClient(node.RPCConfig, false, options)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", node.Name, err)
+		}
+		err = client.Ready(ctx)
+		client.Shutdown()
+		if err != nil {
+			return fmt.Errorf("node %s: %w", node.Name, err)
+		}
+	}
+	return nil
+}
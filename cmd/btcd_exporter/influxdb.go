@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	influxDBURL = kingpin.Flag(
+		"influxdb.url",
+		"URL of an InfluxDB v2 server to write the metrics to, for example http://influxdb:8086. Disabled if empty.",
+	).Envar("BTCD_EXPORTER_INFLUXDB_URL").String()
+	influxDBOrg = kingpin.Flag(
+		"influxdb.org",
+		"InfluxDB organization owning the bucket.",
+	).Envar("BTCD_EXPORTER_INFLUXDB_ORG").String()
+	influxDBBucket = kingpin.Flag(
+		"influxdb.bucket",
+		"InfluxDB bucket to write the metrics to.",
+	).Envar("BTCD_EXPORTER_INFLUXDB_BUCKET").String()
+	influxDBToken = kingpin.Flag(
+		"influxdb.token",
+		"InfluxDB API token allowed to write to the bucket.",
+	).Envar("BTCD_EXPORTER_INFLUXDB_TOKEN").String()
+	influxDBInterval = kingpin.Flag(
+		"influxdb.interval",
+		"How often to write the metrics to InfluxDB.",
+	).Default("30s").Envar("BTCD_EXPORTER_INFLUXDB_INTERVAL").Duration()
+)
+
+var influxDBClient = &http.Client{Timeout: 30 * time.Second}
+
+// runInfluxDB writes the metrics of s to InfluxDB every --influxdb.interval
+// until ctx is done.
+func runInfluxDB(ctx context.Context, s *server) {
+	slog.Info("writing metrics to InfluxDB", "url", *influxDBURL, "bucket", *influxDBBucket, "interval", *influxDBInterval)
+	runPeriodically(ctx, *influxDBInterval, func(ctx context.Context) {
+		families, err := s.gatherer(ctx).Gather()
+		if err != nil {
+			slog.Warn("error gathering metrics", "err", err)
+		}
+		if err := sendInfluxDB(ctx, encodeLineProtocol(flatten(families, time.Now()))); err != nil {
+			slog.Warn("error writing metrics to InfluxDB", "url", *influxDBURL, "err", err)
+		}
+	})
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// encodeLineProtocol encodes the samples in the InfluxDB line protocol, one
+// point per sample measured as the sample name, with the labels as tags and a
+// single value field. NaN and infinite values cannot be stored and are left
+// out.
+func encodeLineProtocol(samples []sample) []byte {
+	var b bytes.Buffer
+	for _, sample := range samples {
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			continue
+		}
+		b.WriteString(influxMeasurementEscaper.Replace(sample.name))
+		for _, l := range sample.labels {
+			if l.value == "" {
+				continue
+			}
+			b.WriteByte(',')
+			b.WriteString(influxTagEscaper.Replace(l.name))
+			b.WriteByte('=')
+			b.WriteString(influxTagEscaper.Replace(l.value))
+		}
+		b.WriteString(" value=")
+		b.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(sample.timestamp.UnixMilli(), 10))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// sendInfluxDB posts points in the line protocol to the write API of
+// InfluxDB v2.
+func sendInfluxDB(ctx context.Context, points []byte) error {
+	query := url.Values{
+		"org":       {*influxDBOrg},
+		"bucket":    {*influxDBBucket},
+		"precision": {"ms"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(*influxDBURL, "/")+"/api/v2/write?"+query.Encode(), bytes.NewReader(points))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "btcd_exporter/"+version.Version)
+	if *influxDBToken != "" {
+		req.Header.Set("Authorization", "Token "+*influxDBToken)
+	}
+	resp, err := influxDBClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
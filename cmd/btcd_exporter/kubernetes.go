@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesSDConfig discovers btcd pods through the Kubernetes API.
+type KubernetesSDConfig struct {
+	// APIServer defaults to the API server of the cluster the exporter
+	// runs in.
+	APIServer string `yaml:"api_server"`
+	// Namespace defaults to the namespace of the exporter.
+	Namespace     string `yaml:"namespace"`
+	LabelSelector string `yaml:"label_selector"`
+	// Port is the RPC port of the pods, or PortName the name of the
+	// container port.
+	Port     int    `yaml:"port"`
+	PortName string `yaml:"port_name"`
+	// BearerTokenFile and CAFile default to those of the service account
+	// of the exporter.
+	BearerTokenFile string         `yaml:"bearer_token_file"`
+	CAFile          string         `yaml:"ca_file"`
+	RefreshInterval model.Duration `yaml:"refresh_interval"`
+}
+
+func (c KubernetesSDConfig) validate() error {
+	if (c.Port == 0) == (c.PortName == "") {
+		return errors.New("kubernetes_sd_configs: exactly one of port and port_name must be set")
+	}
+	if c.APIServer != "" {
+		if _, err := url.Parse(c.APIServer); err != nil {
+			return fmt.Errorf("kubernetes_sd_configs: invalid api_server: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c KubernetesSDConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval > 0 {
+		return time.Duration(c.RefreshInterval)
+	}
+	return defaultDiscoveryRefresh
+}
+
+// kubernetesPodList holds the fields of a list of pods the exporter uses.
+type kubernetesPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name              string     `json:"name"`
+			DeletionTimestamp *time.Time `json:"deletionTimestamp"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []struct {
+				Ports []struct {
+					Name          string `json:"name"`
+					ContainerPort int    `json:"containerPort"`
+				} `json:"ports"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// discover lists the running pods matching the label selector. Each becomes
+// a node named after the pod.
+func (c KubernetesSDConfig) discover(ctx context.Context) ([]NodeConfig, error) {
+	apiServer := c.APIServer
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes_sd_configs: api_server must be set outside of a cluster")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	namespace := c.Namespace
+	if namespace == "" {
+		content, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes_sd_configs: namespace must be set outside of a cluster: %w", err)
+		}
+		namespace = strings.TrimSpace(string(content))
+	}
+	tokenFile := c.BearerTokenFile
+	if tokenFile == "" {
+		tokenFile = serviceAccountDir + "/token"
+	}
+	caFile := c.CAFile
+	if caFile == "" {
+		caFile = serviceAccountDir + "/ca.crt"
+	}
+
+	tlsConfig := &tls.Config{}
+	if ca, err := ioutil.ReadFile(caFile); err == nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+	} else if c.CAFile != "" {
+		return nil, err
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	query := url.Values{}
+	if c.LabelSelector != "" {
+		query.Set("labelSelector", c.LabelSelector)
+	}
+	reqURL := strings.TrimSuffix(apiServer, "/") + "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, err := ioutil.ReadFile(tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	} else if c.BearerTokenFile != "" {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("listing pods of namespace %s: unexpected status %s: %s", namespace, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var pods kubernetesPodList
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("error parsing pods of namespace %s: %w", namespace, err)
+	}
+
+	var nodes []NodeConfig
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != "Running" || pod.Status.PodIP == "" || pod.Metadata.DeletionTimestamp != nil {
+			continue
+		}
+		port := c.Port
+		if c.PortName != "" {
+			for _, container := range pod.Spec.Containers {
+				for _, p := range container.Ports {
+					if p.Name == c.PortName {
+						port = p.ContainerPort
+					}
+				}
+			}
+			if port == 0 {
+				continue
+			}
+		}
+		node := NodeConfig{Name: pod.Metadata.Name}
+		node.Host = net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port))
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/version"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+var landingTemplate = template.Must(template.New("landing").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+	"seconds": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>BTCD Exporter</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.ok { color: #080; }
+.failed { color: #c00; }
+</style>
+</head>
+<body>
+<h1>BTCD Exporter</h1>
+<p>{{.Version}}</p>
+<ul>
+<li><a href="{{.MetricsPath}}">Metrics</a></li>
+<li><a href="/healthz">Health</a>, <a href="/readyz">readiness</a></li>
+<li><a href="/-/config">Configuration</a></li>
+<li><a href="/alerts">Alerts</a></li>
+<li><a href="/dashboard.json">Grafana dashboard</a>, <a href="/rules.yml">alerting rules</a></li>
+{{- if .Pprof}}
+<li><a href="/debug/pprof/">Profiling</a></li>
+{{- end}}
+{{- if .RPCDebug}}
+<li><a href="/debug/rpc">RPC responses</a></li>
+{{- end}}
+</ul>
+<h2>Collectors</h2>
+<p>Enabled: {{range $i, $name := .Collectors}}{{if $i}}, {{end}}{{$name}}{{else}}none{{end}}</p>
+<h2>Targets</h2>
+{{- range .Targets}}
+<h3>{{.Node}}</h3>
+<table>
+<tr><th>Host</th><td>{{.Host}}</td></tr>
+<tr><th>Backend</th><td>{{.Backend}}</td></tr>
+<tr><th>Connection</th><td>{{.Connection}}</td></tr>
+<tr><th>Last scrape</th><td>{{if .Status.Time.IsZero}}never{{else}}<span class="{{if .Status.Up}}ok{{else}}failed{{end}}">{{if .Status.Up}}up{{else}}down{{end}}</span>, {{ago .Status.Time}}, took {{seconds .Status.Duration}}{{end}}</td></tr>
+<tr><th>Last success</th><td>{{ago .Status.LastSuccess}}</td></tr>
+</table>
+<table>
+<tr><th>Collector</th><th>Status</th><th>Duration</th><th>Last success</th></tr>
+{{- range .Collectors}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{if .Status.LastSuccess.IsZero}}{{if .Status.Err}}<span class="failed">{{.Status.Err}}</span>{{else}}not run yet{{end}}{{else if .Status.Err}}<span class="failed">{{.Status.Err}}</span>{{else}}<span class="ok">ok</span>{{end}}</td>
+<td>{{seconds .Status.Duration}}</td>
+<td>{{ago .Status.LastSuccess}}</td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No node configured, metrics are only served on <a href="/probe">/probe</a>.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+type landingTarget struct {
+	Node, Host, Backend, Connection string
+	Status                          collector.ScrapeStatus
+	Collectors                      []landingCollector
+}
+
+type landingCollector struct {
+	Name   string
+	Status collector.CollectorStatus
+}
+
+// landingHandler serves a page showing the version of the exporter, the
+// enabled collectors and the outcome of the last scrape of every node.
+func landingHandler(s *server, metricsPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		config, _, targets := s.current()
+		data := struct {
+			Version     string
+			MetricsPath string
+			Pprof       bool
+			RPCDebug    bool
+			Collectors  []string
+			Targets     []landingTarget
+		}{
+			Version:     version.Info(),
+			MetricsPath: metricsPath,
+			Pprof:       *enablePprof && *pprofListenAddress == "",
+			RPCDebug:    s.options.RPCDebug,
+			Collectors:  config.EnabledCollectors(),
+		}
+		for _, t := range targets {
+			lt := landingTarget{
+				Node:       t.node,
+				Host:       t.host,
+				Backend:    t.backend,
+				Connection: "HTTP POST",
+				Status:     t.exporter.Status(),
+			}
+			if lt.Backend == "" {
+				lt.Backend = collector.BackendBtcd
+			}
+			if !t.exporter.Client().HTTPPostMode() {
+				lt.Connection = "websocket, disconnected"
+				if t.exporter.Client().Connected() {
+					lt.Connection = "websocket, connected"
+				}
+			}
+			for name, status := range lt.Status.Collectors {
+				lt.Collectors = append(lt.Collectors, landingCollector{Name: name, Status: status})
+			}
+			sort.Slice(lt.Collectors, func(i, j int) bool {
+				return lt.Collectors[i].Name < lt.Collectors[j].Name
+			})
+			data.Targets = append(data.Targets, lt)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingTemplate.Execute(w, data); err != nil {
+			slog.Error("error rendering landing page", "err", err)
+		}
+	})
+}
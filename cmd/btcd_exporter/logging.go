@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var (
+	logLevel = kingpin.Flag(
+		"log.level",
+		"Only log messages with the given severity or above. One of: [debug, info, warn, error]",
+	).Default("info").Envar("BTCD_EXPORTER_LOG_LEVEL").Enum("debug", "info", "warn", "error")
+	logFormat = kingpin.Flag(
+		"log.format",
+		"Output format of log messages. One of: [logfmt, json]",
+	).Default("logfmt").Envar("BTCD_EXPORTER_LOG_FORMAT").Enum("logfmt", "json")
+)
+
+// setupLogging makes the default slog logger write to stderr with the level
+// and format given by the flags. Messages of the log package, written by
+// dependencies, go through it at the info level.
+func setupLogging() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(*logLevel))); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", *logLevel, err)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch *logFormat {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
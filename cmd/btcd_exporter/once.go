@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	once = kingpin.Flag(
+		"once",
+		"Query the nodes once, write the metrics to --output and exit, instead of serving them.",
+	).Envar("BTCD_EXPORTER_ONCE").Bool()
+	dryRun = kingpin.Flag(
+		"dry-run",
+		"Query the nodes once, print the metrics to the standard output and exit, with a non-zero status if a node or a collector failed. Meant to check credentials and collector flags.",
+	).Bool()
+	outputFile = kingpin.Flag(
+		"output",
+		"File the metrics are written to with --once, for example /var/lib/node_exporter/textfile/btcd.prom for the textfile collector of the node exporter. - writes to the standard output.",
+	).Default("-").Envar("BTCD_EXPORTER_OUTPUT").String()
+)
+
+// collectOnce queries the nodes of s once, bounded by --scrape.timeout, and
+// writes the metrics in the text format to path. A file is replaced
+// atomically, so that a reader never sees it half written.
+func collectOnce(s *server, path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *scrapeTimeout)
+	defer cancel()
+	gatherer := s.gatherer(ctx)
+	if path != "-" {
+		if err := prometheus.WriteToTextfile(path, gatherer); err != nil {
+			return err
+		}
+		slog.Info("metrics written", "file", path)
+		return nil
+	}
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	enc := expfmt.NewEncoder(os.Stdout, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrapeErrors returns the failures of the last scrape of the nodes of s: the
+// nodes which are down and the collectors which failed.
+func scrapeErrors(s *server) error {
+	_, _, targets := s.current()
+	var errs []error
+	for _, t := range targets {
+		status := t.exporter.Status()
+		if !status.Up {
+			errs = append(errs, fmt.Errorf("node %s is down", t.node))
+		}
+		names := make([]string, 0, len(status.Collectors))
+		for name := range status.Collectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := status.Collectors[name].Err; err != nil {
+				errs = append(errs, fmt.Errorf("node %s: %s collector: %w", t.node, name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	otlpEndpoint = kingpin.Flag(
+		"otlp.endpoint",
+		"OTLP/HTTP metrics endpoint to send the metrics to, for example http://otel-collector:4318/v1/metrics. Disabled if empty.",
+	).Envar("BTCD_EXPORTER_OTLP_ENDPOINT").String()
+	otlpInterval = kingpin.Flag(
+		"otlp.interval",
+		"How often to send the metrics to the OTLP endpoint.",
+	).Default("30s").Envar("BTCD_EXPORTER_OTLP_INTERVAL").Duration()
+	otlpHeaders = kingpin.Flag(
+		"otlp.header",
+		"HTTP header sent to the OTLP endpoint, as name=value. Can be repeated.",
+	).PlaceHolder("NAME=VALUE").StringMap()
+	otlpResourceAttributes = kingpin.Flag(
+		"otlp.resource-attribute",
+		"Attribute of the resource the metrics are sent for, as name=value. Can be repeated. service.name defaults to btcd_exporter and service.instance.id to the host name.",
+	).PlaceHolder("NAME=VALUE").StringMap()
+)
+
+var otlpClient = &http.Client{Timeout: 30 * time.Second}
+
+// runOTLP sends the metrics of s to the OTLP endpoint every --otlp.interval
+// until ctx is done.
+func runOTLP(ctx context.Context, s *server) {
+	attributes := map[string]string{
+		"service.name":    "btcd_exporter",
+		"service.version": version.Version,
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attributes["service.instance.id"] = hostname
+	}
+	for name, value := range *otlpResourceAttributes {
+		attributes[name] = value
+	}
+	starts := newOTLPStarts()
+	slog.Info("sending metrics with OTLP", "endpoint", *otlpEndpoint, "interval", *otlpInterval)
+	runPeriodically(ctx, *otlpInterval, func(ctx context.Context) {
+		families, err := s.gatherer(ctx).Gather()
+		if err != nil {
+			slog.Warn("error gathering metrics", "err", err)
+		}
+		body, err := proto.Marshal(otlpRequest(families, attributes, starts, time.Now()))
+		if err != nil {
+			slog.Warn("error encoding OTLP request", "err", err)
+			return
+		}
+		if err := sendOTLP(ctx, body); err != nil {
+			slog.Warn("error sending metrics with OTLP", "endpoint", *otlpEndpoint, "err", err)
+		}
+	})
+}
+
+// otlpStarts follows the start times of the cumulative series sent, so that
+// a counter going back, the node having restarted, is sent as a reset rather
+// than as a decrease.
+type otlpStarts struct {
+	series map[string]otlpSeries
+}
+
+// otlpSeries is the latest point sent of a cumulative series.
+type otlpSeries struct {
+	start time.Time
+	time  time.Time
+	value float64
+}
+
+func newOTLPStarts() *otlpStarts {
+	return &otlpStarts{series: make(map[string]otlpSeries)}
+}
+
+// start returns the start time of the point of the series named key with
+// value at now. A series first seen starts at now. A series whose value went
+// back starts again after its previous point.
+func (s *otlpStarts) start(key string, value float64, now time.Time) time.Time {
+	series, ok := s.series[key]
+	switch {
+	case !ok:
+		series.start = now
+	case value < series.value:
+		series.start = series.time
+	}
+	series.time, series.value = now, value
+	s.series[key] = series
+	return series.start
+}
+
+// prune forgets the series not sent at now, which would otherwise be kept
+// forever as the nodes and their peers change.
+func (s *otlpStarts) prune(now time.Time) {
+	for key, series := range s.series {
+		if !series.time.Equal(now) {
+			delete(s.series, key)
+		}
+	}
+}
+
+// otlpRequest converts the metric families into an export request for the
+// resource described by attributes. Counters become monotonic cumulative
+// sums, gauges and untyped metrics gauges. The cumulative series start at
+// the times followed by starts. MetricsData is encoded like the
+// ExportMetricsServiceRequest of the collector service, whose package would
+// pull in gRPC.
+func otlpRequest(families []*dto.MetricFamily, attributes map[string]string, starts *otlpStarts, now time.Time) *metricspb.MetricsData {
+	timestamp := uint64(now.UnixNano())
+	// startTime returns the start time of the point of m, counting value.
+	startTime := func(family *dto.MetricFamily, m *dto.Metric, value float64) uint64 {
+		key := family.GetName()
+		for _, l := range m.GetLabel() {
+			key += "\xff" + l.GetName() + "=" + l.GetValue()
+		}
+		return uint64(starts.start(key, value, now).UnixNano())
+	}
+	metrics := make([]*metricspb.Metric, 0, len(families))
+	for _, family := range families {
+		metric := &metricspb.Metric{Name: family.GetName(), Description: family.GetHelp()}
+		var (
+			sum       *metricspb.Sum
+			gauge     *metricspb.Gauge
+			histogram *metricspb.Histogram
+			summary   *metricspb.Summary
+		)
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			sum = &metricspb.Sum{AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, IsMonotonic: true}
+			metric.Data = &metricspb.Metric_Sum{Sum: sum}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			gauge = &metricspb.Gauge{}
+			metric.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+		case dto.MetricType_HISTOGRAM:
+			histogram = &metricspb.Histogram{AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE}
+			metric.Data = &metricspb.Metric_Histogram{Histogram: histogram}
+		case dto.MetricType_SUMMARY:
+			summary = &metricspb.Summary{}
+			metric.Data = &metricspb.Metric_Summary{Summary: summary}
+		default:
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := otlpAttributes(m.GetLabel())
+			switch {
+			case sum != nil:
+				value := m.GetCounter().GetValue()
+				sum.DataPoints = append(sum.DataPoints, &metricspb.NumberDataPoint{
+					Attributes:        labels,
+					StartTimeUnixNano: startTime(family, m, value),
+					TimeUnixNano:      timestamp,
+					Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+				})
+			case gauge != nil:
+				value := m.GetGauge().GetValue()
+				if family.GetType() == dto.MetricType_UNTYPED {
+					value = m.GetUntyped().GetValue()
+				}
+				gauge.DataPoints = append(gauge.DataPoints, &metricspb.NumberDataPoint{
+					Attributes:   labels,
+					TimeUnixNano: timestamp,
+					Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+				})
+			case histogram != nil:
+				h := m.GetHistogram()
+				sampleSum := h.GetSampleSum()
+				point := &metricspb.HistogramDataPoint{
+					Attributes:        labels,
+					StartTimeUnixNano: startTime(family, m, float64(h.GetSampleCount())),
+					TimeUnixNano:      timestamp,
+					Count:             h.GetSampleCount(),
+					Sum:               &sampleSum,
+				}
+				// OTLP buckets count their own observations, with a last
+				// bucket above the highest bound.
+				var previous uint64
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						continue
+					}
+					point.ExplicitBounds = append(point.ExplicitBounds, b.GetUpperBound())
+					point.BucketCounts = append(point.BucketCounts, b.GetCumulativeCount()-previous)
+					previous = b.GetCumulativeCount()
+				}
+				point.BucketCounts = append(point.BucketCounts, h.GetSampleCount()-previous)
+				histogram.DataPoints = append(histogram.DataPoints, point)
+			case summary != nil:
+				sm := m.GetSummary()
+				point := &metricspb.SummaryDataPoint{
+					Attributes:        labels,
+					StartTimeUnixNano: startTime(family, m, float64(sm.GetSampleCount())),
+					TimeUnixNano:      timestamp,
+					Count:             sm.GetSampleCount(),
+					Sum:               sm.GetSampleSum(),
+				}
+				for _, q := range sm.GetQuantile() {
+					point.QuantileValues = append(point.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+						Quantile: q.GetQuantile(),
+						Value:    q.GetValue(),
+					})
+				}
+				summary.DataPoints = append(summary.DataPoints, point)
+			}
+		}
+		metrics = append(metrics, metric)
+	}
+	starts.prune(now)
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resource := &resourcepb.Resource{}
+	for _, name := range names {
+		resource.Attributes = append(resource.Attributes, otlpAttribute(name, attributes[name]))
+	}
+	return &metricspb.MetricsData{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: "btcd_exporter", Version: version.Version},
+				Metrics: metrics,
+			}},
+		}},
+	}
+}
+
+func otlpAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func otlpAttributes(labels []*dto.LabelPair) []*commonpb.KeyValue {
+	attributes := make([]*commonpb.KeyValue, 0, len(labels))
+	for _, l := range labels {
+		attributes = append(attributes, otlpAttribute(l.GetName(), l.GetValue()))
+	}
+	return attributes
+}
+
+// sendOTLP posts a protobuf encoded export request to the OTLP endpoint.
+func sendOTLP(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *otlpEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "btcd_exporter/"+version.Version)
+	for name, value := range *otlpHeaders {
+		req.Header.Set(name, value)
+	}
+	resp, err := otlpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
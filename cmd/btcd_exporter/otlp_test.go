@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func counterFamily(name string, value float64) []*dto.MetricFamily {
+	return []*dto.MetricFamily{{
+		Name: proto.String(name),
+		Help: proto.String("Test counter."),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{{
+			Label:   []*dto.LabelPair{{Name: proto.String("node"), Value: proto.String("edge-1")}},
+			Counter: &dto.Counter{Value: proto.Float64(value)},
+		}},
+	}}
+}
+
+// sumPoint returns the only data point of the only metric of req.
+func sumPoint(t *testing.T, req *metricspb.MetricsData) *metricspb.NumberDataPoint {
+	t.Helper()
+	metrics := req.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()
+	if len(metrics) != 1 {
+		t.Fatalf("got %d metrics, want 1", len(metrics))
+	}
+	sum := metrics[0].GetSum()
+	if sum == nil || !sum.GetIsMonotonic() || sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Fatalf("got %v, want a monotonic cumulative sum", metrics[0])
+	}
+	return sum.GetDataPoints()[0]
+}
+
+func TestOTLPCounterReset(t *testing.T) {
+	starts := newOTLPStarts()
+	attributes := map[string]string{"service.name": "btcd_exporter"}
+	first := time.Unix(1700000000, 0)
+
+	point := sumPoint(t, otlpRequest(counterFamily("btcd_network_sent_bytes_total", 1000), attributes, starts, first))
+	if point.GetStartTimeUnixNano() != uint64(first.UnixNano()) {
+		t.Errorf("got start %d for a new series, want %d", point.GetStartTimeUnixNano(), first.UnixNano())
+	}
+	if point.GetAsDouble() != 1000 {
+		t.Errorf("got value %v, want 1000", point.GetAsDouble())
+	}
+
+	// The series keeps its start while it grows.
+	second := first.Add(30 * time.Second)
+	point = sumPoint(t, otlpRequest(counterFamily("btcd_network_sent_bytes_total", 2000), attributes, starts, second))
+	if point.GetStartTimeUnixNano() != uint64(first.UnixNano()) {
+		t.Errorf("got start %d for a growing series, want %d", point.GetStartTimeUnixNano(), first.UnixNano())
+	}
+
+	// The node restarted, its counter starting again after the previous
+	// point.
+	third := second.Add(30 * time.Second)
+	point = sumPoint(t, otlpRequest(counterFamily("btcd_network_sent_bytes_total", 10), attributes, starts, third))
+	if point.GetStartTimeUnixNano() != uint64(second.UnixNano()) {
+		t.Errorf("got start %d after a reset, want %d", point.GetStartTimeUnixNano(), second.UnixNano())
+	}
+	if point.GetTimeUnixNano() != uint64(third.UnixNano()) {
+		t.Errorf("got time %d, want %d", point.GetTimeUnixNano(), third.UnixNano())
+	}
+
+	// Series no longer sent are forgotten.
+	otlpRequest(counterFamily("btcd_network_received_bytes_total", 1), attributes, starts, third.Add(30*time.Second))
+	if len(starts.series) != 1 {
+		t.Errorf("got %d series followed, want 1", len(starts.series))
+	}
+}
+
+func TestOTLPRequestEncoding(t *testing.T) {
+	families := []*dto.MetricFamily{{
+		Name:   proto.String("btcd_difficulty"),
+		Type:   dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(math.NaN())}}},
+	}, {
+		Name: proto.String("btcd_exporter_rpc_duration_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{Histogram: &dto.Histogram{
+			SampleCount: proto.Uint64(5),
+			SampleSum:   proto.Float64(0.5),
+			Bucket: []*dto.Bucket{
+				{UpperBound: proto.Float64(0.1), CumulativeCount: proto.Uint64(2)},
+				{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(4)},
+				{UpperBound: proto.Float64(math.Inf(1)), CumulativeCount: proto.Uint64(5)},
+			},
+		}}},
+	}}
+	req := otlpRequest(families, map[string]string{"service.name": "btcd_exporter"}, newOTLPStarts(), time.Unix(1700000000, 0))
+	body, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &metricspb.MetricsData{}
+	if err := proto.Unmarshal(body, decoded); err != nil {
+		t.Fatal(err)
+	}
+	metrics := decoded.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics()
+	if got := metrics[0].GetGauge().GetDataPoints()[0].GetAsDouble(); !math.IsNaN(got) {
+		t.Errorf("got gauge %v, want NaN", got)
+	}
+	histogram := metrics[1].GetHistogram().GetDataPoints()[0]
+	if got, want := histogram.GetBucketCounts(), []uint64{2, 2, 1}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("got bucket counts %v, want %v", got, want)
+	}
+	if got := histogram.GetExplicitBounds(); len(got) != 2 || got[0] != 0.1 || got[1] != 1 {
+		t.Errorf("got bounds %v, want [0.1 1]", got)
+	}
+	if got := decoded.GetResourceMetrics()[0].GetResource().GetAttributes()[0]; got.GetKey() != "service.name" || got.GetValue().GetStringValue() != "btcd_exporter" {
+		t.Errorf("got resource attribute %v", got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var (
+	enablePprof = kingpin.Flag(
+		"web.enable-pprof",
+		"Serve the Go profiling endpoints under /debug/pprof/.",
+	).Envar("BTCD_EXPORTER_WEB_ENABLE_PPROF").Bool()
+	pprofListenAddress = kingpin.Flag(
+		"web.pprof-listen-address",
+		"Separate address on which to serve /debug/pprof/, for example 127.0.0.1:6060. Defaults to --web.listen-address.",
+	).Envar("BTCD_EXPORTER_WEB_PPROF_LISTEN_ADDRESS").String()
+)
+
+// pprofHandler serves the profiles of net/http/pprof. Importing the package
+// also registers them with http.DefaultServeMux, which the exporter does not
+// serve.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// handlePprof serves the profiles on mux, behind protect, unless they are
+// disabled or served on their own listener.
+func handlePprof(mux *http.ServeMux, protect func(http.Handler) http.Handler) {
+	if *enablePprof && *pprofListenAddress == "" {
+		mux.Handle("/debug/pprof/", protect(pprofHandler()))
+	}
+}
+
+// servePprof serves the profiles on their own listener when
+// --web.pprof-listen-address is set. It returns the server of that
+// listener, nil otherwise.
+func servePprof() *http.Server {
+	if !*enablePprof || *pprofListenAddress == "" {
+		return nil
+	}
+	srv := &http.Server{Addr: *pprofListenAddress, Handler: pprofHandler()}
+	go func() {
+		slog.Info("serving pprof", "address", *pprofListenAddress)
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			slog.Error("error serving pprof", "err", err)
+		}
+	}()
+	return srv
+}
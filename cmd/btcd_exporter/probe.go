@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+// defaultProbeModule is the module probes without a module parameter use, if
+// the configuration file defines it.
+const defaultProbeModule = "default"
+
+// probeHandler scrapes the btcd node given by the target query parameter,
+// authenticating with the settings of the module query parameter, or of the
+// default module if no module is given. Without either, the target is probed
+// with the settings of the rpc section but without credentials, which are
+// only ever sent to the configured node or to the targets of a module. Only
+// the metrics passing filter are served. The target is scraped with options.
+func probeHandler(w http.ResponseWriter, r *http.Request, config *Config, filter *metricFilter, options collector.Options) {
+	params := r.URL.Query()
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := params.Get("module")
+	if _, ok := config.Modules[defaultProbeModule]; ok && moduleName == "" {
+		moduleName = defaultProbeModule
+	}
+	var rpc collector.RPCConfig
+	if moduleName != "" {
+		module, ok := config.Modules[moduleName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+			return
+		}
+		rpc = module
+	} else {
+		rpc = withoutCredentials(config.RPC)
+	}
+	rpc.Host = target
+	if err := rpc.ReadCredentials(); err != nil {
+		slog.Warn("error probing target", "target", target, "err", err)
+		http.Error(w, "Error reading credentials", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(config.Labels, registry)
+	client, err := collector.NewClient(rpc, false, options)
+	if err != nil {
+		slog.Warn("error connecting to probe target", "target", target, "err", err)
+		targetUp := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: options.Namespace,
+			Name:      "up",
+			Help:      "Was the last btcd query successful, that is did at least one collector succeed.",
+		})
+		registerer.MustRegister(targetUp)
+	} else {
+		defer client.Shutdown()
+		exporter, err := collector.NewExporter(client, config.probeCollectorConfig(), options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		registerer.MustRegister(&scrapeCollector{ctx: ctx, exporter: exporter})
+	}
+	promhttp.HandlerFor(filter.gatherer(registry), promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(w, r)
+}
+
+// withoutCredentials returns rpc without anything the node could be
+// authenticated with.
+func withoutCredentials(rpc collector.RPCConfig) collector.RPCConfig {
+	rpc.Username, rpc.Password = "", ""
+	rpc.UsernameFile, rpc.PasswordFile = "", ""
+	rpc.CookieFile = ""
+	rpc.BtcdConfigFile = ""
+	rpc.Credentials = collector.CredentialsConfig{}
+	return rpc
+}
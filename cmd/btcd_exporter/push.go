@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	pushURL = kingpin.Flag(
+		"push.url",
+		"URL of a Pushgateway to push the metrics to, for nodes Prometheus cannot scrape. Disabled if empty.",
+	).Envar("BTCD_EXPORTER_PUSH_URL").String()
+	pushJob = kingpin.Flag(
+		"push.job",
+		"Job label of the pushed metrics.",
+	).Default("btcd_exporter").Envar("BTCD_EXPORTER_PUSH_JOB").String()
+	pushGrouping = kingpin.Flag(
+		"push.grouping",
+		"Grouping label of the pushed metrics, as name=value. Can be repeated. The instance label defaults to the host name.",
+	).PlaceHolder("NAME=VALUE").StringMap()
+	pushInterval = kingpin.Flag(
+		"push.interval",
+		"How often to push the metrics.",
+	).Default("15s").Envar("BTCD_EXPORTER_PUSH_INTERVAL").Duration()
+	pushUsername = kingpin.Flag(
+		"push.username",
+		"Username for basic authentication with the Pushgateway.",
+	).Envar("BTCD_EXPORTER_PUSH_USERNAME").String()
+	pushPassword = kingpin.Flag(
+		"push.password",
+		"Password for basic authentication with the Pushgateway.",
+	).Envar("BTCD_EXPORTER_PUSH_PASSWORD").String()
+)
+
+// pushEnabled reports whether metrics are pushed anywhere.
+func pushEnabled() bool {
+	return *pushURL != "" || *remoteWriteURL != "" || *otlpEndpoint != "" || *graphiteAddress != "" || *influxDBURL != "" || *statsdAddress != ""
+}
+
+// validatePush checks that the push destinations are fully configured.
+func validatePush() error {
+	if *influxDBURL != "" && (*influxDBOrg == "" || *influxDBBucket == "") {
+		return errors.New("--influxdb.org and --influxdb.bucket are required with --influxdb.url")
+	}
+	return nil
+}
+
+// runPushers pushes the metrics of s to every configured destination until
+// ctx is done.
+func runPushers(ctx context.Context, s *server) {
+	var wg sync.WaitGroup
+	run := func(push func(context.Context, *server)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			push(ctx, s)
+		}()
+	}
+	if *pushURL != "" {
+		run(runPushgateway)
+	}
+	if *remoteWriteURL != "" {
+		run(runRemoteWrite)
+	}
+	if *otlpEndpoint != "" {
+		run(runOTLP)
+	}
+	if *graphiteAddress != "" {
+		run(runGraphite)
+	}
+	if *influxDBURL != "" {
+		run(runInfluxDB)
+	}
+	if *statsdAddress != "" {
+		run(runStatsD)
+	}
+	wg.Wait()
+}
+
+// runPushgateway pushes the metrics of s to the Pushgateway every
+// --push.interval until ctx is done. Every push replaces the metrics of the
+// previous one.
+func runPushgateway(ctx context.Context, s *server) {
+	grouping := map[string]string{}
+	if hostname, err := os.Hostname(); err == nil {
+		grouping["instance"] = hostname
+	}
+	for name, value := range *pushGrouping {
+		grouping[name] = value
+	}
+	slog.Info("pushing metrics", "url", *pushURL, "interval", *pushInterval)
+	runPeriodically(ctx, *pushInterval, func(ctx context.Context) {
+		// A pusher accumulates gatherers, a new one is needed for every
+		// push.
+		pusher := push.New(*pushURL, *pushJob).Gatherer(s.gatherer(ctx))
+		for name, value := range grouping {
+			pusher.Grouping(name, value)
+		}
+		if *pushUsername != "" || *pushPassword != "" {
+			pusher.BasicAuth(*pushUsername, *pushPassword)
+		}
+		if err := pusher.PushContext(ctx); err != nil {
+			slog.Warn("error pushing metrics", "url", *pushURL, "err", err)
+		}
+	})
+}
+
+// runPeriodically calls f right away and then every interval until ctx is
+// done. Each call is given --scrape.timeout to complete.
+func runPeriodically(ctx context.Context, interval time.Duration, f func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		callCtx, cancel := context.WithTimeout(ctx, *scrapeTimeout)
+		f(callCtx)
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sample is a single value of a metric family, named and labeled as in the
+// text exposition format.
+type sample struct {
+	name string
+	// labels are sorted by name.
+	labels []labelPair
+	value  float64
+	// timestamp is the time the value was gathered, or the explicit
+	// timestamp of the metric.
+	timestamp time.Time
+	// counter is set for samples which only ever increase: counters and
+	// the buckets, sums and counts of histograms and summaries.
+	counter bool
+}
+
+type labelPair struct {
+	name, value string
+}
+
+// flatten turns the metric families into samples. Summaries and histograms
+// become their quantile or bucket, _sum and _count samples.
+func flatten(families []*dto.MetricFamily, now time.Time) []sample {
+	var samples []sample
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			labels := make([]labelPair, 0, len(m.GetLabel())+1)
+			for _, l := range m.GetLabel() {
+				labels = append(labels, labelPair{l.GetName(), l.GetValue()})
+			}
+			timestamp := now
+			if m.TimestampMs != nil {
+				timestamp = time.UnixMilli(m.GetTimestampMs())
+			}
+			add := func(name string, value float64, counter bool, extra ...labelPair) {
+				all := append(append([]labelPair{}, labels...), extra...)
+				sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+				samples = append(samples, sample{name: name, labels: all, value: value, timestamp: timestamp, counter: counter})
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue(), true)
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue(), false)
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue(), false)
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, q := range summary.GetQuantile() {
+					add(name, q.GetValue(), false, labelPair{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", summary.GetSampleSum(), true)
+				add(name+"_count", float64(summary.GetSampleCount()), true)
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				histogram := m.GetHistogram()
+				counter := family.GetType() == dto.MetricType_HISTOGRAM
+				infSeen := false
+				for _, b := range histogram.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						infSeen = true
+					}
+					add(name+"_bucket", float64(b.GetCumulativeCount()), counter, labelPair{"le", formatFloat(b.GetUpperBound())})
+				}
+				if !infSeen {
+					add(name+"_bucket", float64(histogram.GetSampleCount()), counter, labelPair{"le", "+Inf"})
+				}
+				add(name+"_sum", histogram.GetSampleSum(), counter)
+				add(name+"_count", float64(histogram.GetSampleCount()), counter)
+			}
+		}
+	}
+	return samples
+}
+
+// formatFloat formats a quantile or bucket bound the way Prometheus does.
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/version"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+var (
+	remoteWriteURL = kingpin.Flag(
+		"remote-write.url",
+		"Prometheus remote write endpoint to push the metrics to, for example of Mimir or VictoriaMetrics. Disabled if empty.",
+	).Envar("BTCD_EXPORTER_REMOTE_WRITE_URL").String()
+	remoteWriteInterval = kingpin.Flag(
+		"remote-write.interval",
+		"How often to send the metrics to the remote write endpoint.",
+	).Default("30s").Envar("BTCD_EXPORTER_REMOTE_WRITE_INTERVAL").Duration()
+	remoteWriteLabels = kingpin.Flag(
+		"remote-write.label",
+		"Label added to every sent series, as name=value. Can be repeated. job defaults to btcd_exporter and instance to the host name.",
+	).PlaceHolder("NAME=VALUE").StringMap()
+	remoteWriteUsername = kingpin.Flag(
+		"remote-write.username",
+		"Username for basic authentication with the remote write endpoint.",
+	).Envar("BTCD_EXPORTER_REMOTE_WRITE_USERNAME").String()
+	remoteWritePassword = kingpin.Flag(
+		"remote-write.password",
+		"Password for basic authentication with the remote write endpoint.",
+	).Envar("BTCD_EXPORTER_REMOTE_WRITE_PASSWORD").String()
+	remoteWriteBearerTokenFile = kingpin.Flag(
+		"remote-write.bearer-token-file",
+		"File holding a bearer token sent to the remote write endpoint.",
+	).Envar("BTCD_EXPORTER_REMOTE_WRITE_BEARER_TOKEN_FILE").String()
+	remoteWriteHeaders = kingpin.Flag(
+		"remote-write.header",
+		"HTTP header sent to the remote write endpoint, as name=value, for example X-Scope-OrgID=tenant. Can be repeated.",
+	).PlaceHolder("NAME=VALUE").StringMap()
+)
+
+var remoteWriteClient = &http.Client{Timeout: 30 * time.Second}
+
+// runRemoteWrite sends the metrics of s to the remote write endpoint every
+// --remote-write.interval until ctx is done.
+func runRemoteWrite(ctx context.Context, s *server) {
+	labels := map[string]string{"job": "btcd_exporter"}
+	if hostname, err := os.Hostname(); err == nil {
+		labels["instance"] = hostname
+	}
+	for name, value := range *remoteWriteLabels {
+		labels[name] = value
+	}
+	slog.Info("sending metrics with remote write", "url", *remoteWriteURL, "interval", *remoteWriteInterval)
+	runPeriodically(ctx, *remoteWriteInterval, func(ctx context.Context) {
+		families, err := s.gatherer(ctx).Gather()
+		if err != nil {
+			slog.Warn("error gathering metrics", "err", err)
+		}
+		writeRequest, err := encodeWriteRequest(flatten(families, time.Now()), labels)
+		if err != nil {
+			slog.Warn("error encoding metrics for remote write", "err", err)
+			return
+		}
+		if err := sendRemoteWrite(ctx, writeRequest); err != nil {
+			slog.Warn("error sending metrics with remote write", "url", *remoteWriteURL, "err", err)
+		}
+	})
+}
+
+// encodeWriteRequest encodes the samples as a remote write WriteRequest
+// protobuf message, with the extra labels added to every series unless a
+// sample has a label of the same name.
+func encodeWriteRequest(samples []sample, extra map[string]string) ([]byte, error) {
+	req := prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(samples))}
+	for _, sample := range samples {
+		labels := map[string]string{"__name__": sample.name}
+		for name, value := range extra {
+			labels[name] = value
+		}
+		for _, l := range sample.labels {
+			labels[l.name] = l.value
+		}
+		series := prompb.TimeSeries{
+			Labels: make([]prompb.Label, 0, len(labels)),
+			Samples: []prompb.Sample{{
+				Value:     sample.value,
+				Timestamp: sample.timestamp.UnixMilli(),
+			}},
+		}
+		for name, value := range labels {
+			series.Labels = append(series.Labels, prompb.Label{Name: name, Value: value})
+		}
+		sort.Slice(series.Labels, func(i, j int) bool {
+			return series.Labels[i].Name < series.Labels[j].Name
+		})
+		req.Timeseries = append(req.Timeseries, series)
+	}
+	return req.Marshal()
+}
+
+// sendRemoteWrite posts an encoded WriteRequest to the remote write
+// endpoint.
+func sendRemoteWrite(ctx context.Context, writeRequest []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *remoteWriteURL, bytes.NewReader(snappy.Encode(nil, writeRequest)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "btcd_exporter/"+version.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for name, value := range *remoteWriteHeaders {
+		req.Header.Set(name, value)
+	}
+	if *remoteWriteUsername != "" || *remoteWritePassword != "" {
+		req.SetBasicAuth(*remoteWriteUsername, *remoteWritePassword)
+	}
+	if *remoteWriteBearerTokenFile != "" {
+		token, err := ioutil.ReadFile(*remoteWriteBearerTokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := remoteWriteClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+var enableRPCDebug = kingpin.Flag(
+	"web.enable-rpc-debug",
+	"Keep the latest response of every node to every RPC method and serve them under /debug/rpc. Needs basic or bearer authentication on every listener.",
+).Envar("BTCD_EXPORTER_WEB_ENABLE_RPC_DEBUG").Bool()
+
+// validateRPCDebug checks that /debug/rpc, which serves what the nodes
+// answered, is only served to authenticated clients.
+func validateRPCDebug(listeners []*webListener) error {
+	if !*enableRPCDebug {
+		return nil
+	}
+	for _, listener := range listeners {
+		if !listener.authenticated() {
+			return errors.New("--web.enable-rpc-debug needs basic or bearer authentication on every listener, see --web.basic-auth-users-file, --web.bearer-token-file and the users of the web config file")
+		}
+	}
+	return nil
+}
+
+// rpcResponseJSON is a response served by /debug/rpc.
+type rpcResponseJSON struct {
+	Node            string    `json:"node,omitempty"`
+	Host            string    `json:"host"`
+	Method          string    `json:"method"`
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+	// Result is the raw JSON result, or the start of a truncated one as a
+	// string.
+	Result    interface{} `json:"result,omitempty"`
+	Size      int         `json:"size"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// rpcDebugHandler serves the latest response of every node to every RPC
+// method as JSON, to compare what the nodes answered with the exported values.
+func rpcDebugHandler(s *server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, targets := s.current()
+		nodes := make(map[string]string)
+		for _, t := range targets {
+			nodes[t.host] = t.node
+			for _, endpoint := range t.endpoints {
+				nodes[endpoint] = t.node
+			}
+		}
+		responses := collector.RPCResponses()
+		resp := make([]rpcResponseJSON, len(responses))
+		for i, response := range responses {
+			resp[i] = rpcResponseJSON{
+				Node:            nodes[response.Host],
+				Host:            response.Host,
+				Method:          response.Method,
+				Time:            response.Time,
+				DurationSeconds: response.Duration.Seconds(),
+				Size:            response.Size,
+				Truncated:       response.Truncated(),
+			}
+			if response.Err != nil {
+				resp[i].Error = response.Err.Error()
+			}
+			switch {
+			case response.Truncated():
+				resp[i].Result = string(response.Result)
+			case response.Result != nil:
+				resp[i].Result = json.RawMessage(response.Result)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			slog.Error("error encoding RPC responses", "err", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+var (
+	rulesNoBlockFor = kingpin.Flag(
+		"rules.no-block-for",
+		"Age of the latest block of a node beyond which the rules served at /rules.yml alert.",
+	).Envar("BTCD_EXPORTER_RULES_NO_BLOCK_FOR").Default("1h").Duration()
+	rulesSyncStallFor = kingpin.Flag(
+		"rules.sync-stall-for",
+		"How long the height of a node behind the chain may stay the same before the rules served at /rules.yml alert.",
+	).Envar("BTCD_EXPORTER_RULES_SYNC_STALL_FOR").Default("30m").Duration()
+	rulesMinPeers = kingpin.Flag(
+		"rules.min-peers",
+		"Fewest peers a node may have before the rules served at /rules.yml alert.",
+	).Envar("BTCD_EXPORTER_RULES_MIN_PEERS").Default("3").Int()
+)
+
+// validateRules checks the thresholds of the alerting rules.
+func validateRules() error {
+	if *rulesNoBlockFor <= 0 {
+		return fmt.Errorf("--rules.no-block-for must be positive")
+	}
+	if *rulesSyncStallFor <= 0 {
+		return fmt.Errorf("--rules.sync-stall-for must be positive")
+	}
+	if *rulesMinPeers < 0 {
+		return fmt.Errorf("--rules.min-peers cannot be negative")
+	}
+	return nil
+}
+
+// rulesHandler serves the recommended alerting rules of the enabled
+// collectors as a Prometheus rule file.
+func rulesHandler(s *server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config, _, _ := s.current()
+		content, err := collector.AlertingRules(s.options.Namespace, config.EnabledCollectors(), collector.RulesConfig{
+			NoBlockFor:   *rulesNoBlockFor,
+			SyncStallFor: *rulesSyncStallFor,
+			MinPeers:     *rulesMinPeers,
+		})
+		if err != nil {
+			slog.Error("error generating alerting rules", "err", err)
+			http.Error(w, "failed to generate rules", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+		w.Write(content)
+	})
+}
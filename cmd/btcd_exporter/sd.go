@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// sdTargetGroup is a target group of the Prometheus HTTP service discovery.
+type sdTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdHandler serves a target group per node, in the format of the Prometheus
+// HTTP service discovery, each scraping the metrics of its node from
+// metricsPath of the exporter as reached by the request. The node, its host
+// and backend are given as __meta_btcd_* labels, and the instance label is
+// the node, so that the targets differ. The constant labels of the
+// configuration are not repeated since the metrics carry them.
+func sdHandler(s *server, metricsPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, targets := s.current()
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		groups := make([]sdTargetGroup, 0, len(targets))
+		for _, t := range targets {
+			groups = append(groups, sdTargetGroup{
+				Targets: []string{r.Host},
+				Labels: map[string]string{
+					"__scheme__":          scheme,
+					"__metrics_path__":    metricsPath,
+					"__param_node":        t.node,
+					"__meta_btcd_node":    t.node,
+					"__meta_btcd_host":    t.host,
+					"__meta_btcd_backend": t.backend,
+					"instance":            t.node,
+				},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(groups); err != nil {
+			slog.Error("error encoding service discovery targets", "err", err)
+		}
+	})
+}
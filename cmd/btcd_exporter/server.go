@@ -0,0 +1,401 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+var (
+	enableLifecycle = kingpin.Flag(
+		"web.enable-lifecycle",
+		"Serve /-/reload, reloading the configuration on POST requests. Needs --web.reload-token, or basic or bearer authentication on every listener.",
+	).Bool()
+	reloadToken = kingpin.Flag(
+		"web.reload-token",
+		"Bearer token required by /-/reload, instead of the authentication of the listeners.",
+	).Envar("BTCD_EXPORTER_RELOAD_TOKEN").String()
+)
+
+// server holds everything built from the configuration. It is rebuilt when
+// the configuration is reloaded, the previous state serving scrapes until the
+// new one is complete.
+type server struct {
+	configFile   string
+	flagConfig   *Config
+	pollInterval time.Duration
+	// options are the settings of the clients and exporters, which a
+	// reload does not change.
+	options collector.Options
+
+	// reloadMtx serializes reloads.
+	reloadMtx sync.Mutex
+	// clients are kept across reloads for the nodes whose settings,
+	// certificate and credentials did not change, so that their connections are not
+	// interrupted.
+	clients map[collector.RPCConfig]*collector.Client
+	// discovery adds the nodes found by service discovery to those of the
+	// configuration.
+	discovery *discoveryManager
+	// failover picks the endpoint of the nodes with failover hosts.
+	failover *failover
+	// alerter evaluates the alerts of the configuration.
+	alerter *alerter
+	// logs are the settings of the log files tailed for the nodes of the
+	// configuration in use.
+	logs []collector.LogConfig
+
+	mtx     sync.RWMutex
+	config  *Config
+	filter  *metricFilter
+	targets []*target
+}
+
+func newServer(configFile string, flagConfig *Config, pollInterval time.Duration, options collector.Options) *server {
+	s := &server{
+		configFile:   configFile,
+		flagConfig:   flagConfig,
+		pollInterval: pollInterval,
+		options:      options,
+		clients:      make(map[collector.RPCConfig]*collector.Client),
+		failover:     newFailover(options.Namespace),
+		alerter:      newAlerter(options.Namespace),
+	}
+	s.discovery = newDiscoveryManager(func() {
+		if err := s.reload(); err != nil {
+			slog.Error("error applying discovered nodes", "err", err)
+		}
+	})
+	return s
+}
+
+// current returns the configuration in use and what was built from it.
+func (s *server) current() (*Config, *metricFilter, []*target) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.config, s.filter, s.targets
+}
+
+// reload reads the configuration and replaces the state built from the
+// previous one. Everything is built before the discoverers and the clients
+// are swapped, so that on error the previous state is kept, including the
+// clients whose certificate changed, recreated by the next reload.
+func (s *server) reload() error {
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+
+	config, err := resolveConfig(s.configFile, s.flagConfig)
+	if err != nil {
+		return err
+	}
+	if config.Metrics.Namespace != "" && config.Metrics.Namespace != s.options.Namespace {
+		slog.Warn("the metric namespace cannot be changed by a reload", "namespace", s.options.Namespace)
+	}
+	if config.Metrics.Legacy != s.options.LegacyMetrics {
+		slog.Warn("the legacy metrics cannot be enabled or disabled by a reload", "legacy", s.options.LegacyMetrics)
+	}
+	// The whole configuration is checked before anything is changed.
+	filter, err := newMetricFilter(config.Metrics.Include, config.Metrics.Exclude)
+	if err != nil {
+		return err
+	}
+	if err := applyCollectorConfig(config); err != nil {
+		return err
+	}
+	if _, err := config.NodeConfigs(); err != nil {
+		return err
+	}
+	discovery := s.discovery.prepare(config)
+	config.Nodes = append(config.Nodes, discovery.nodes()...)
+	nodes, err := config.NodeConfigs()
+	if err != nil {
+		discovery.discard()
+		return err
+	}
+	if len(nodes) == 0 {
+		slog.Info("no node configured, only serving /probe")
+	}
+
+	clients := make(map[collector.RPCConfig]*collector.Client, len(nodes))
+	targets := make([]*target, 0, len(nodes))
+	var logs []collector.LogConfig
+	// abort releases what was built so far when the configuration turns out
+	// to be unusable, including what the collectors share across exporters.
+	abort := func(err error) error {
+		for rpc, client := range clients {
+			if s.clients[rpc] != client {
+				client.Shutdown()
+			}
+		}
+		for _, t := range targets {
+			if t.poller != nil {
+				t.poller.Stop()
+			}
+		}
+		if s.config != nil {
+			collector.PruneWalletClients(s.config.Wallet.RPCConfig)
+		} else {
+			collector.PruneWalletClients(collector.RPCConfig{})
+		}
+		collector.UseLogConfigs(s.logs)
+		discovery.discard()
+		return err
+	}
+	// The exporters created below pick up the clients of btcwallet whose
+	// certificate or credentials changed.
+	collector.RefreshWalletClients()
+	for _, node := range nodes {
+		endpoints := node.endpoints()
+		node.Host = s.failover.host(node)
+		client, ok := s.clients[node.RPCConfig]
+		if !ok || client.CertChanged() {
+			client, err = collector.NewClient(node.RPCConfig, true, s.options)
+			if err != nil {
+				return abort(fmt.Errorf("error creating client of node %s: %w", node.Name, err))
+			}
+		}
+		clients[node.RPCConfig] = client
+
+		collectorConfig := config.collectorConfig(node)
+		exporter, err := collector.NewExporter(client, collectorConfig, s.options)
+		if err != nil {
+			return abort(err)
+		}
+		if collectorConfig.Log.File != "" {
+			logs = append(logs, collectorConfig.Log)
+		}
+		labels := prometheus.Labels{}
+		for name, value := range config.Labels {
+			labels[name] = value
+		}
+		// A single node configured without the nodes section keeps its
+		// metrics unlabeled.
+		if len(config.Nodes) > 0 {
+			labels["node"] = node.Name
+		}
+		t := &target{
+			node:       node.Name,
+			host:       node.Host,
+			backend:    node.Backend,
+			rpc:        node.RPCConfig,
+			endpoints:  endpoints,
+			labels:     labels,
+			collectors: collectorConfig,
+			exporter:   exporter,
+		}
+		if s.pollInterval > 0 {
+			t.poller = collector.NewPollingCollector(exporter, s.pollInterval, *scrapeTimeout, s.options.MaxAge)
+			go t.poller.Run()
+		}
+		targets = append(targets, t)
+	}
+
+	s.mtx.Lock()
+	oldTargets := s.targets
+	s.config, s.filter, s.targets = config, filter, targets
+	s.mtx.Unlock()
+	discovery.commit()
+
+	for _, t := range oldTargets {
+		if t.poller != nil {
+			t.poller.Stop()
+		}
+	}
+	for rpc, client := range s.clients {
+		if clients[rpc] != client {
+			client.Shutdown()
+		}
+	}
+	s.clients = clients
+	s.failover.update(targets)
+	collector.PruneWalletClients(config.Wallet.RPCConfig)
+	s.logs = logs
+	collector.UseLogConfigs(logs)
+	return nil
+}
+
+// watchClients recreates the clients whose RPC certificate changed on disk
+// or whose credentials changed in their secret store, checking every
+// interval until stop is closed.
+func (s *server) watchClients(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		s.refreshClients()
+		collector.RefreshWalletClients()
+	}
+}
+
+// refreshClients recreates the clients of the nodes whose certificate or
+// credentials changed, along with the exporters querying them. The other
+// nodes keep their clients and the configuration is not reloaded. A client
+// which cannot be recreated is kept until its certificate or credentials
+// change again.
+func (s *server) refreshClients() {
+	// The certificates and the secret stores are read without holding up
+	// reloads.
+	s.reloadMtx.Lock()
+	current := make([]*collector.Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		current = append(current, client)
+	}
+	s.reloadMtx.Unlock()
+	changed := make(map[*collector.Client]bool)
+	for _, client := range current {
+		if client.CertChanged() || client.CredentialsChanged() {
+			changed[client] = true
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+	config, filter, targets := s.current()
+	clients := make(map[collector.RPCConfig]*collector.Client, len(s.clients))
+	recreated := make(map[*collector.Client]*collector.Client)
+	refreshed := make([]*target, len(targets))
+	var stale []*target
+	for i, t := range targets {
+		refreshed[i] = t
+		old := s.clients[t.rpc]
+		clients[t.rpc] = old
+		if !changed[old] {
+			continue
+		}
+		client, ok := recreated[old]
+		if !ok {
+			slog.Info("RPC certificate or credentials changed, recreating the client", "node", t.node)
+			var err error
+			if client, err = collector.NewClient(t.rpc, true, s.options); err != nil {
+				slog.Error("error recreating client", "node", t.node, "err", err)
+				continue
+			}
+			recreated[old] = client
+		}
+		exporter, err := collector.NewExporter(client, t.collectors, s.options)
+		if err != nil {
+			slog.Error("error recreating exporter", "node", t.node, "err", err)
+			continue
+		}
+		nt := *t
+		nt.exporter = exporter
+		if t.poller != nil {
+			nt.poller = collector.NewPollingCollector(exporter, s.pollInterval, *scrapeTimeout, s.options.MaxAge)
+			go nt.poller.Run()
+		}
+		refreshed[i] = &nt
+		clients[t.rpc] = client
+		stale = append(stale, t)
+	}
+
+	s.mtx.Lock()
+	s.config, s.filter, s.targets = config, filter, refreshed
+	s.mtx.Unlock()
+
+	for _, t := range stale {
+		if t.poller != nil {
+			t.poller.Stop()
+		}
+	}
+	used := make(map[*collector.Client]bool, len(clients))
+	for _, client := range clients {
+		used[client] = true
+	}
+	for old, client := range recreated {
+		if !used[old] {
+			old.Shutdown()
+		}
+		if !used[client] {
+			client.Shutdown()
+		}
+	}
+	// The clients kept are not recreated again until their certificate
+	// changes again.
+	for old := range changed {
+		if used[old] {
+			old.CertSeen()
+		}
+	}
+	s.clients = clients
+}
+
+// shutdown stops polling and shuts every client down.
+func (s *server) shutdown() {
+	s.discovery.stop()
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+	_, _, targets := s.current()
+	for _, t := range targets {
+		if t.poller != nil {
+			t.poller.Stop()
+		}
+	}
+	for _, client := range s.clients {
+		client.Shutdown()
+	}
+	collector.PruneWalletClients(collector.RPCConfig{})
+	collector.UseLogConfigs(nil)
+}
+
+// validateLifecycle checks that only authenticated clients can reload the
+// configuration, with the reload token or the authentication of every
+// listener.
+func validateLifecycle(listeners []*webListener) error {
+	if !*enableLifecycle || *reloadToken != "" {
+		return nil
+	}
+	for _, listener := range listeners {
+		if !listener.authenticated() {
+			return errors.New("--web.enable-lifecycle needs --web.reload-token, or basic or bearer authentication on every listener, see --web.basic-auth-users-file, --web.bearer-token-file and the users of the web config file")
+		}
+	}
+	return nil
+}
+
+// protectReload restricts /-/reload to the allowed networks of the listener,
+// and to its authenticated clients unless the reload token, carried in the
+// same Authorization header, is set.
+func (l *webListener) protectReload(next http.Handler, token string) http.Handler {
+	if token != "" {
+		return l.allowlist.wrap(next)
+	}
+	return l.protect(next)
+}
+
+// reloadHandler reloads the configuration on POST requests. If token is set,
+// requests have to carry it as a bearer token.
+func (s *server) reloadHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "Only POST and PUT requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := s.reload(); err != nil {
+			slog.Error("error reloading configuration", "err", err)
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("configuration reloaded")
+	})
+}
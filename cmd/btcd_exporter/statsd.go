@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var (
+	statsdAddress = kingpin.Flag(
+		"statsd.address",
+		"Host and port of a StatsD server, like the DogStatsD agent, to send the metrics to over UDP. Disabled if empty.",
+	).Envar("BTCD_EXPORTER_STATSD_ADDRESS").String()
+	statsdPrefix = kingpin.Flag(
+		"statsd.prefix",
+		"Prefix of the sent metric names, for example bitcoin.",
+	).Envar("BTCD_EXPORTER_STATSD_PREFIX").String()
+	statsdInterval = kingpin.Flag(
+		"statsd.interval",
+		"How often to send the metrics to StatsD.",
+	).Default("15s").Envar("BTCD_EXPORTER_STATSD_INTERVAL").Duration()
+	statsdTags = kingpin.Flag(
+		"statsd.tags",
+		"Send the labels as DogStatsD tags. Plain StatsD servers get the labels in the metric name instead.",
+	).Default("true").Envar("BTCD_EXPORTER_STATSD_TAGS").Bool()
+)
+
+// statsdMaxPacket keeps the datagrams below the usual MTU.
+const statsdMaxPacket = 1432
+
+// runStatsD sends the metrics of s to StatsD every --statsd.interval until
+// ctx is done.
+func runStatsD(ctx context.Context, s *server) {
+	slog.Info("sending metrics to StatsD", "address", *statsdAddress, "interval", *statsdInterval)
+	// StatsD counters are increments, the previous value of every counter
+	// is kept to send the difference.
+	previous := map[string]float64{}
+	runPeriodically(ctx, *statsdInterval, func(ctx context.Context) {
+		families, err := s.gatherer(ctx).Gather()
+		if err != nil {
+			slog.Warn("error gathering metrics", "err", err)
+		}
+		lines := statsdLines(flatten(families, time.Now()), previous)
+		if err := sendStatsD(ctx, lines); err != nil {
+			slog.Warn("error sending metrics to StatsD", "address", *statsdAddress, "err", err)
+		}
+	})
+}
+
+// statsdLines encodes the samples as StatsD gauges and counters. Counters are
+// sent as their increase since the value in previous, which is updated; a
+// counter seen for the first time only sets its previous value, and a counter
+// which went down was reset and is sent as is.
+func statsdLines(samples []sample, previous map[string]float64) []string {
+	lines := make([]string, 0, len(samples))
+	seen := make(map[string]bool, len(samples))
+	for _, sample := range samples {
+		var name, tags strings.Builder
+		if *statsdPrefix != "" {
+			name.WriteString(strings.TrimSuffix(*statsdPrefix, "."))
+			name.WriteByte('.')
+		}
+		name.WriteString(sample.name)
+		for i, l := range sample.labels {
+			if *statsdTags {
+				if i == 0 {
+					tags.WriteString("|#")
+				} else {
+					tags.WriteByte(',')
+				}
+				tags.WriteString(l.name)
+				tags.WriteByte(':')
+				tags.WriteString(statsdEscape(l.value))
+			} else {
+				name.WriteByte('.')
+				name.WriteString(l.name)
+				name.WriteByte('.')
+				name.WriteString(graphiteEscape(l.value))
+			}
+		}
+
+		value, kind := sample.value, "g"
+		if sample.counter {
+			key := name.String() + tags.String()
+			seen[key] = true
+			last, ok := previous[key]
+			previous[key] = sample.value
+			if !ok {
+				continue
+			}
+			if sample.value >= last {
+				value -= last
+			}
+			if value == 0 {
+				continue
+			}
+			kind = "c"
+		}
+		lines = append(lines, name.String()+":"+strconv.FormatFloat(value, 'g', -1, 64)+"|"+kind+tags.String())
+	}
+	for key := range previous {
+		if !seen[key] {
+			delete(previous, key)
+		}
+	}
+	return lines
+}
+
+// statsdEscape replaces the characters of a tag value which separate the
+// fields of a DogStatsD line.
+func statsdEscape(value string) string {
+	return strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_").Replace(value)
+}
+
+// sendStatsD sends the lines to StatsD, as many in a datagram as fit.
+func sendStatsD(ctx context.Context, lines []string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", *statsdAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err = conn.Write(packet.Bytes())
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/version"
+
+	"github.com/atk-works/btcd_exporter/pkg/collector"
+)
+
+// statusResponse is served by /api/v1/status.
+type statusResponse struct {
+	Version string       `json:"version"`
+	Targets []nodeStatus `json:"targets"`
+}
+
+// nodeStatus holds the latest statistics of a node. Values of collectors
+// which are disabled or failed are left out.
+type nodeStatus struct {
+	Node    string `json:"node"`
+	Host    string `json:"host"`
+	Backend string `json:"backend"`
+	Up      bool   `json:"up"`
+
+	LastScrape            time.Time  `json:"last_scrape"`
+	ScrapeDurationSeconds float64    `json:"scrape_duration_seconds"`
+	LastSuccess           *time.Time `json:"last_success,omitempty"`
+
+	Chain      string         `json:"chain,omitempty"`
+	Blocks     *int64         `json:"blocks,omitempty"`
+	Difficulty *float64       `json:"difficulty,omitempty"`
+	Sync       *syncStatus    `json:"sync,omitempty"`
+	Peers      *int64         `json:"peers,omitempty"`
+	Mempool    *mempoolStatus `json:"mempool,omitempty"`
+
+	Collectors map[string]collectorStatusJSON `json:"collectors"`
+}
+
+// syncStatus tells how far behind the tip of the network a node may be.
+type syncStatus struct {
+	LatestBlockTime       time.Time `json:"latest_block_time"`
+	LatestBlockAgeSeconds float64   `json:"latest_block_age_seconds"`
+}
+
+type mempoolStatus struct {
+	Transactions int64 `json:"transactions"`
+	Bytes        int64 `json:"bytes"`
+}
+
+type collectorStatusJSON struct {
+	DurationSeconds float64    `json:"duration_seconds"`
+	Error           string     `json:"error,omitempty"`
+	LastSuccess     *time.Time `json:"last_success,omitempty"`
+}
+
+// statusHandler serves the latest statistics of every node as JSON, for
+// tools which would rather not parse the Prometheus exposition format.
+// Nodes which are not polled are scraped.
+func statusHandler(s *server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+		_, _, targets := s.current()
+		resp := statusResponse{Version: version.Version, Targets: make([]nodeStatus, len(targets))}
+		var wg sync.WaitGroup
+		for i, t := range targets {
+			wg.Add(1)
+			go func(i int, t *target) {
+				defer wg.Done()
+				reg := prometheus.NewRegistry()
+				reg.MustRegister(t.collector(ctx))
+				families, err := reg.Gather()
+				if err != nil {
+					slog.Warn("error gathering metrics", "node", t.node, "err", err)
+				}
+				resp.Targets[i] = newNodeStatus(t, families, s.options.Namespace)
+			}(i, t)
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			slog.Error("error encoding status", "err", err)
+		}
+	})
+}
+
+func newNodeStatus(t *target, families []*dto.MetricFamily, namespace string) nodeStatus {
+	status := t.exporter.Status()
+	ns := nodeStatus{
+		Node:                  t.node,
+		Host:                  t.host,
+		Backend:               t.backend,
+		Up:                    status.Up,
+		LastScrape:            status.Time,
+		ScrapeDurationSeconds: status.Duration.Seconds(),
+		LastSuccess:           optionalTime(status.LastSuccess),
+		Collectors:            make(map[string]collectorStatusJSON, len(status.Collectors)),
+	}
+	if ns.Backend == "" {
+		ns.Backend = collector.BackendBtcd
+	}
+	for name, c := range status.Collectors {
+		cs := collectorStatusJSON{
+			DurationSeconds: c.Duration.Seconds(),
+			LastSuccess:     optionalTime(c.LastSuccess),
+		}
+		if c.Err != nil {
+			cs.Error = c.Err.Error()
+		}
+		ns.Collectors[name] = cs
+	}
+
+	values := make(map[string]*dto.Metric, len(families))
+	for _, family := range families {
+		if len(family.GetMetric()) > 0 {
+			values[family.GetName()] = family.GetMetric()[0]
+		}
+	}
+	value := func(name string) (float64, bool) {
+		m, ok := values[namespace+"_"+name]
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case m.Counter != nil:
+			return m.GetCounter().GetValue(), true
+		case m.Gauge != nil:
+			return m.GetGauge().GetValue(), true
+		}
+		return m.GetUntyped().GetValue(), true
+	}
+
+	if m, ok := values[namespace+"_chain_info"]; ok {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "chain" {
+				ns.Chain = l.GetValue()
+			}
+		}
+	}
+	if v, ok := value("block_height"); ok {
+		blocks := int64(v)
+		ns.Blocks = &blocks
+	}
+	if v, ok := value("difficulty"); ok {
+		ns.Difficulty = &v
+	}
+	if v, ok := value("latest_block_timestamp"); ok {
+		latest := time.Unix(int64(v), 0).UTC()
+		ns.Sync = &syncStatus{latest, time.Since(latest).Round(time.Second).Seconds()}
+	}
+	if v, ok := value("peers"); ok {
+		peers := int64(v)
+		ns.Peers = &peers
+	}
+	transactions, ok := value("mempool_transactions")
+	bytes, _ := value("mempool_bytes")
+	if ok {
+		ns.Mempool = &mempoolStatus{int64(transactions), int64(bytes)}
+	}
+	return ns
+}
+
+// optionalTime returns nil for the zero time, so that it is left out of the
+// JSON.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
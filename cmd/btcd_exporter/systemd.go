@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+)
+
+// notifySystemd sends state to systemd when the exporter runs as a
+// Type=notify service, doing nothing otherwise.
+func notifySystemd(state string) {
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		slog.Warn("error notifying systemd", "state", state, "err", err)
+	}
+}
+
+// notifyReady tells systemd that the exporter is ready, once its listeners
+// are open, whether the nodes are reachable or not. The nodes whose websocket
+// connection is not established yet are reported in the status of the
+// service until they connect or ctx is done.
+func notifyReady(ctx context.Context, s *server) {
+	notifySystemd(daemon.SdNotifyReady)
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		status := ""
+		for {
+			_, _, targets := s.current()
+			var waiting []string
+			for _, t := range targets {
+				if client := t.exporter.Client(); !client.HTTPPostMode() && !client.Connected() {
+					waiting = append(waiting, t.node)
+				}
+			}
+			if len(waiting) == 0 {
+				notifySystemd("STATUS=Serving metrics")
+				return
+			}
+			if waitingStatus := fmt.Sprintf("STATUS=Serving metrics, connecting to %s", strings.Join(waiting, ", ")); waitingStatus != status {
+				status = waitingStatus
+				notifySystemd(status)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// runWatchdog pings the systemd watchdog, if WatchdogSec is set for the
+// service, at half its interval until ctx is done. The state of s is read
+// before each ping, so that an exporter stuck holding it gets restarted.
+func runWatchdog(ctx context.Context, s *server) {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		slog.Warn("error reading the systemd watchdog interval", "err", err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		s.current()
+		notifySystemd(daemon.SdNotifyWatchdog)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
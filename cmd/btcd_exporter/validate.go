@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// validateConfig checks the configuration resolved from configFile and
+// flagConfig, along with the web, push and Consul settings, without starting
+// the exporter. Unknown keys in the configuration file are errors. With
+// connect, every node must also accept TCP connections. Every problem found is
+// returned.
+func validateConfig(configFile string, flagConfig *Config, listenAddress, metricsPath string, connect bool) error {
+	config, err := resolveConfig(configFile, flagConfig)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if _, err := newMetricFilter(config.Metrics.Include, config.Metrics.Exclude); err != nil {
+		errs = append(errs, err)
+	}
+	if err := applyCollectorConfig(config); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := config.WatchedAddresses(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateScrapeConcurrency(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTelemetryPath(metricsPath); err != nil {
+		errs = append(errs, err)
+	}
+	if listeners, err := webListeners(listenAddress); err != nil {
+		errs = append(errs, fmt.Errorf("web configuration: %w", err))
+	} else {
+		if err := validateRPCDebug(listeners); err != nil {
+			errs = append(errs, err)
+		}
+		if err := validateLifecycle(listeners); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validatePush(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateRules(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateWebhooks(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateConsul(listenAddress); err != nil {
+		errs = append(errs, err)
+	}
+	nodes, err := config.NodeConfigs()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if connect {
+		for _, node := range nodes {
+			// A node behind a proxy cannot be dialed directly.
+			if node.Proxy != "" {
+				continue
+			}
+			conn, err := net.DialTimeout("tcp", node.Host, 5*time.Second)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("node %q is unreachable: %w", node.Name, err))
+				continue
+			}
+			conn.Close()
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/exporter-toolkit/web"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	webBasicAuthFile = kingpin.Flag(
+		"web.basic-auth-users-file",
+		"File of users allowed to read metrics with basic authentication, one user:bcrypt-hash per line as written by htpasswd -B.",
+	).Envar("BTCD_EXPORTER_WEB_BASIC_AUTH_USERS_FILE").String()
+	webBearerTokenFile = kingpin.Flag(
+		"web.bearer-token-file",
+		"File holding a bearer token allowed to read metrics.",
+	).Envar("BTCD_EXPORTER_WEB_BEARER_TOKEN_FILE").String()
+	webExtraListeners = kingpin.Flag(
+		"web.listener",
+		"Further address to serve the web interface on, TCP or unix socket, as address=web-config-file with a web configuration file of its own, or address= for plain HTTP. Can be repeated.",
+	).PlaceHolder("ADDRESS=FILE").Strings()
+	webReadTimeout = kingpin.Flag(
+		"web.read-timeout",
+		"Maximum time to read a request, headers and body included. 0 for no limit.",
+	).Default("30s").Envar("BTCD_EXPORTER_WEB_READ_TIMEOUT").Duration()
+	webWriteTimeout = kingpin.Flag(
+		"web.write-timeout",
+		"Maximum time to serve a request once read, which has to exceed --scrape.timeout. 0 for no limit.",
+	).Default("2m").Envar("BTCD_EXPORTER_WEB_WRITE_TIMEOUT").Duration()
+	webIdleTimeout = kingpin.Flag(
+		"web.idle-timeout",
+		"Maximum time a keep-alive connection waits for the next request. 0 for no limit.",
+	).Default("2m").Envar("BTCD_EXPORTER_WEB_IDLE_TIMEOUT").Duration()
+)
+
+// reservedPaths are served by the exporter besides the metrics.
+var reservedPaths = []string{"/", "/probe", "/api/v1/status", "/sd", "/healthz", "/readyz", "/-/config", "/-/reload", "/dashboard.json", "/rules.yml", "/alerts", "/debug/pprof/", "/debug/rpc"}
+
+// validateTelemetryPath checks that the metrics can be served under path.
+func validateTelemetryPath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("--web.telemetry-path %q must start with /", path)
+	}
+	for _, reserved := range reservedPaths {
+		if path == reserved {
+			return fmt.Errorf("--web.telemetry-path %q is used by the exporter itself", path)
+		}
+	}
+	return nil
+}
+
+// validateTimeouts checks that the responses to scrapes are not cut short by
+// the write timeout.
+func validateTimeouts() error {
+	if *webWriteTimeout > 0 && *webWriteTimeout <= *scrapeTimeout {
+		return fmt.Errorf("--web.write-timeout %s must exceed --scrape.timeout %s", *webWriteTimeout, *scrapeTimeout)
+	}
+	return nil
+}
+
+// unixSocketPrefix marks a --web.listen-address which is the path of a unix
+// socket, as in unix:///run/btcd_exporter.sock.
+const unixSocketPrefix = "unix://"
+
+// unixSocketPath returns the path of the unix socket listenAddress designates,
+// if it does.
+func unixSocketPath(listenAddress string) (string, bool) {
+	return strings.CutPrefix(listenAddress, unixSocketPrefix)
+}
+
+// listen listens on address, a TCP address or a unix socket. A socket left
+// behind by a previous run is replaced.
+func listen(address string) (net.Listener, error) {
+	path, ok := unixSocketPath(address)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// webListener is an address the web interface is served on, with the
+// settings applying to it.
+type webListener struct {
+	address   string
+	config    *webConfig
+	auth      *authenticator
+	allowlist ipAllowlist
+}
+
+// protect restricts an endpoint serving metrics or details of the nodes to
+// the allowed networks and authenticated clients of the listener.
+func (l *webListener) protect(next http.Handler) http.Handler {
+	return l.allowlist.wrap(l.auth.wrap(next))
+}
+
+// authenticated reports whether the endpoints protected by the listener are
+// only served to authenticated clients, with the users of its web
+// configuration file, which exporter-toolkit requires for every request, or
+// with the basic or bearer authentication of the flags.
+func (l *webListener) authenticated() bool {
+	return l.config.users || l.auth != nil
+}
+
+// webListeners returns the listener of listenAddress, unless empty, with the
+// web configuration file, followed by the further listeners of
+// --web.listener. The basic and bearer authentication and the allowed
+// networks of the flags protect every listener.
+func webListeners(listenAddress string) ([]*webListener, error) {
+	auth, err := newAuthenticator(*webBasicAuthFile, *webBearerTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := newIPAllowlist(*webAllowCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	var listeners []*webListener
+	add := func(address string, config *webConfig) error {
+		for _, listener := range listeners {
+			if listener.address == address {
+				return fmt.Errorf("web interface listening twice on %s", address)
+			}
+		}
+		// exporter-toolkit would ask every request for the basic
+		// authentication of the file, before that of the flags.
+		if config.users && auth != nil {
+			return fmt.Errorf("listener %s: basic_auth_users of the web config file cannot be combined with --web.basic-auth-users-file or --web.bearer-token-file", address)
+		}
+		if _, ok := unixSocketPath(address); ok && len(allowlist) > 0 {
+			return fmt.Errorf("listener %s: --web.allow-cidr does not apply to clients of a unix socket", address)
+		}
+		listeners = append(listeners, &webListener{address: address, config: config, auth: auth, allowlist: allowlist})
+		return nil
+	}
+	if listenAddress != "" {
+		config, err := loadWebConfig(*webConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(listenAddress, config); err != nil {
+			return nil, err
+		}
+	}
+	for _, flag := range *webExtraListeners {
+		// Addresses hold colons but no equal sign.
+		address, file, ok := strings.Cut(flag, "=")
+		if !ok || address == "" {
+			return nil, fmt.Errorf("invalid --web.listener %q, expected address=web-config-file or address=", flag)
+		}
+		config, err := loadWebConfig(file)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", address, err)
+		}
+		if err := add(address, config); err != nil {
+			return nil, err
+		}
+	}
+	return listeners, nil
+}
+
+// serve serves srv on l, opened on the address of listener, with
+// exporter-toolkit, over HTTPS and with basic authentication as its web
+// configuration file says.
+func serve(srv *http.Server, l net.Listener, listener *webListener) error {
+	systemdSocket := false
+	flags := &web.FlagConfig{
+		WebListenAddresses: &[]string{listener.address},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &listener.config.file,
+	}
+	return web.Serve(l, srv, flags, toolkitLogger{})
+}
+
+// authenticator checks the credentials of requests for metrics.
+type authenticator struct {
+	// users maps user names to bcrypt hashes of their passwords.
+	users map[string][]byte
+	token []byte
+
+	// bcrypt is slow on purpose, verified credentials are remembered by
+	// their hash so that every scrape does not pay for it.
+	mtx      sync.Mutex
+	verified map[[sha256.Size]byte]bool
+}
+
+// newAuthenticator reads the users and token files given by the flags for
+// the main listener. It returns nil when there are neither users nor a token.
+func newAuthenticator(usersFile, tokenFile string) (*authenticator, error) {
+	if usersFile == "" && tokenFile == "" {
+		return nil, nil
+	}
+	a := &authenticator{
+		users:    make(map[string][]byte),
+		verified: make(map[[sha256.Size]byte]bool),
+	}
+	if usersFile != "" {
+		file, err := os.Open(usersFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			user, hash, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid line in %s, expected user:hash", usersFile)
+			}
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("invalid bcrypt hash of user %q in %s: %w", user, usersFile, err)
+			}
+			a.users[user] = []byte(hash)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", usersFile, err)
+		}
+	}
+	if tokenFile != "" {
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		a.token = bytes.TrimRight(token, "\r\n")
+		if len(a.token) == 0 {
+			return nil, fmt.Errorf("%s is empty", tokenFile)
+		}
+	}
+	return a, nil
+}
+
+// wrap rejects requests to next without valid credentials. A nil
+// authenticator lets every request through.
+func (a *authenticator) wrap(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.authorized(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(a.users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="btcd_exporter"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func (a *authenticator) authorized(r *http.Request) bool {
+	if len(a.token) > 0 {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			return subtle.ConstantTimeCompare([]byte(token), a.token) == 1
+		}
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := a.users[user]
+	if !ok {
+		return false
+	}
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + string(hash)))
+	a.mtx.Lock()
+	verified := a.verified[key]
+	a.mtx.Unlock()
+	if verified {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	a.mtx.Lock()
+	a.verified[key] = true
+	a.mtx.Unlock()
+	return true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/exporter-toolkit/web"
+	"gopkg.in/yaml.v2"
+)
+
+var webConfigFile = kingpin.Flag(
+	"web.config.file",
+	"Path to a web configuration file in the format of the Prometheus exporter-toolkit, setting up TLS, basic authentication and HTTP options of the web interface.",
+).Envar("BTCD_EXPORTER_WEB_CONFIG_FILE").String()
+
+// webConfig is a web configuration file, in the format of
+// prometheus/exporter-toolkit, which serves the web interface with it. Only
+// what the rest of the exporter needs to know is kept.
+type webConfig struct {
+	// file is the path of the file, empty for plain HTTP without users.
+	file string
+	// tls is set when the web interface is served over HTTPS.
+	tls bool
+	// users is set when basic_auth_users are required for every request.
+	users bool
+}
+
+// loadWebConfig checks the web configuration file at path, if any, the way
+// exporter-toolkit reads it, certificates included.
+func loadWebConfig(path string) (*webConfig, error) {
+	config := &webConfig{file: path}
+	if path == "" {
+		return config, nil
+	}
+	if err := web.Validate(path); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c web.Config
+	if err := yaml.Unmarshal(content, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	config.tls = c.TLSConfig.TLSCertPath != "" || c.TLSConfig.TLSCert != ""
+	config.users = len(c.Users) > 0
+	return config, nil
+}
+
+// toolkitLogger passes the messages of exporter-toolkit, logged with the
+// key-value pairs of go-kit, to slog.
+type toolkitLogger struct{}
+
+func (toolkitLogger) Log(keyvals ...interface{}) error {
+	level, msg := slog.LevelInfo, ""
+	var attrs []any
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		switch key {
+		case "level":
+			switch fmt.Sprint(keyvals[i+1]) {
+			case "debug":
+				level = slog.LevelDebug
+			case "warn":
+				level = slog.LevelWarn
+			case "error":
+				level = slog.LevelError
+			}
+		case "msg":
+			msg = fmt.Sprint(keyvals[i+1])
+		default:
+			attrs = append(attrs, key, keyvals[i+1])
+		}
+	}
+	slog.Log(context.Background(), level, msg, attrs...)
+	return nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+var (
+	webhookURLs = kingpin.Flag(
+		"webhook.url",
+		"URL to post a JSON notification to when a node goes down or up, reorganizes its chain, or stops or resumes syncing. Can be repeated.",
+	).Envar("BTCD_EXPORTER_WEBHOOK_URL").Strings()
+	webhookBearerTokenFile = kingpin.Flag(
+		"webhook.bearer-token-file",
+		"File holding a bearer token sent with the notifications.",
+	).Envar("BTCD_EXPORTER_WEBHOOK_BEARER_TOKEN_FILE").String()
+	webhookInterval = kingpin.Flag(
+		"webhook.interval",
+		"How often to check the nodes for the notifications.",
+	).Default("30s").Envar("BTCD_EXPORTER_WEBHOOK_INTERVAL").Duration()
+	webhookSyncStallFor = kingpin.Flag(
+		"webhook.sync-stall-for",
+		"How long the height of a node may stay the same before notifying that it stopped syncing.",
+	).Default("1h").Envar("BTCD_EXPORTER_WEBHOOK_SYNC_STALL_FOR").Duration()
+)
+
+// Events notified to the webhooks.
+const (
+	eventNodeDown    = "node_down"
+	eventNodeUp      = "node_up"
+	eventReorg       = "reorg"
+	eventSyncStalled = "sync_stalled"
+	eventSyncResumed = "sync_resumed"
+)
+
+// maxReorgCheck is how many blocks back a new best block is followed to the
+// previous best block. Beyond, the node is catching up and not checked.
+const maxReorgCheck = 10
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookURLList returns the URLs of --webhook.url. The environment variable
+// holds them separated by commas.
+func webhookURLList() []string {
+	var urls []string
+	for _, value := range *webhookURLs {
+		for _, u := range strings.Split(value, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
+
+// validateWebhooks checks the webhook URLs and thresholds.
+func validateWebhooks() error {
+	for _, u := range webhookURLList() {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("invalid --webhook.url: %w", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return fmt.Errorf("--webhook.url %s must be an http or https URL", parsed.Redacted())
+		}
+	}
+	if *webhookInterval <= 0 {
+		return fmt.Errorf("--webhook.interval must be positive")
+	}
+	if *webhookSyncStallFor <= 0 {
+		return fmt.Errorf("--webhook.sync-stall-for must be positive")
+	}
+	return nil
+}
+
+// webhookEvent is the JSON body of a notification. Text summarizes it, as
+// the incoming webhooks of Slack and Mattermost display.
+type webhookEvent struct {
+	Event   string                 `json:"event"`
+	Node    string                 `json:"node"`
+	Host    string                 `json:"host"`
+	Labels  map[string]string      `json:"labels,omitempty"`
+	Time    time.Time              `json:"time"`
+	Text    string                 `json:"text"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// watchedNode is what was last seen of a node.
+type watchedNode struct {
+	up     bool
+	height float64
+	hash   string
+	// heightSince is when the height was first seen.
+	heightSince time.Time
+	stalled     bool
+}
+
+// webhookNotifier follows the state of the nodes and notifies its changes.
+type webhookNotifier struct {
+	urls []string
+	// namespace names the metrics of the nodes checked.
+	namespace string
+	// notifications is created with the notifier, once the metric
+	// namespace of the configuration is known.
+	notifications *prometheus.CounterVec
+	mtx           sync.Mutex
+	nodes         map[string]*watchedNode
+}
+
+// runWebhooks checks the nodes of s every --webhook.interval until ctx is
+// done, posting the changes of their state to the webhooks.
+func runWebhooks(ctx context.Context, s *server) {
+	urls := webhookURLList()
+	if len(urls) == 0 {
+		return
+	}
+	n := &webhookNotifier{
+		urls:      urls,
+		namespace: s.options.Namespace,
+		notifications: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: s.options.Namespace,
+				Subsystem: "exporter",
+				Name:      "webhook_notifications_total",
+				Help:      "How many notifications were posted to the webhooks, by event and whether they were accepted.",
+			},
+			[]string{"event", "outcome"},
+		),
+		nodes: make(map[string]*watchedNode),
+	}
+	registry.MustRegister(n.notifications)
+	slog.Info("checking nodes for webhooks", "webhooks", len(urls), "interval", *webhookInterval)
+	runPeriodically(ctx, *webhookInterval, func(ctx context.Context) {
+		_, _, targets := s.current()
+		var wg sync.WaitGroup
+		for _, t := range targets {
+			wg.Add(1)
+			go func(t *target) {
+				defer wg.Done()
+				for _, event := range n.check(ctx, t, time.Now()) {
+					n.notify(ctx, event)
+				}
+			}(t)
+		}
+		wg.Wait()
+		n.prune(targets)
+	})
+}
+
+// check gathers the metrics of t and returns the events of the changes since
+// the previous check.
+func (n *webhookNotifier) check(ctx context.Context, t *target, now time.Time) []webhookEvent {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(t.collector(ctx))
+	families, err := reg.Gather()
+	if err != nil {
+		slog.Debug("error gathering metrics for webhooks", "node", t.node, "err", err)
+	}
+	up, height, hash := false, -1.0, ""
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch family.GetName() {
+			case n.namespace + "_up":
+				up = m.GetGauge().GetValue() == 1
+			case n.namespace + "_block_height":
+				height = m.GetGauge().GetValue()
+			case n.namespace + "_best_block_info":
+				hash = labelValue(m, "hash")
+			}
+		}
+	}
+
+	n.mtx.Lock()
+	node, seen := n.nodes[t.node]
+	if !seen {
+		node = &watchedNode{height: -1}
+		n.nodes[t.node] = node
+	}
+	previous := *node
+	n.mtx.Unlock()
+
+	var events []webhookEvent
+	event := func(name, text string, details map[string]interface{}) {
+		events = append(events, webhookEvent{
+			Event:   name,
+			Node:    t.node,
+			Host:    t.host,
+			Labels:  t.labels,
+			Time:    now,
+			Text:    fmt.Sprintf("btcd node %s: %s", t.node, text),
+			Details: details,
+		})
+	}
+	switch {
+	case !up && (previous.up || !seen):
+		event(eventNodeDown, "down", nil)
+	case up && !previous.up && seen:
+		event(eventNodeUp, "up again", nil)
+	}
+	current := previous
+	current.up = up
+	if up && height >= 0 && hash != "" {
+		if previous.hash != "" && hash != previous.hash && n.reorganized(ctx, t, previous, height, hash) {
+			event(eventReorg, fmt.Sprintf("chain reorganized, best block %.0f %s replaced by %.0f %s", previous.height, previous.hash, height, hash),
+				map[string]interface{}{
+					"previous_height": previous.height,
+					"previous_hash":   previous.hash,
+					"height":          height,
+					"hash":            hash,
+				})
+		}
+		if height != previous.height {
+			current.heightSince = now
+			if previous.stalled {
+				event(eventSyncResumed, fmt.Sprintf("syncing again at height %.0f", height), map[string]interface{}{"height": height})
+				current.stalled = false
+			}
+		} else if !previous.stalled && now.Sub(previous.heightSince) >= *webhookSyncStallFor {
+			event(eventSyncStalled, fmt.Sprintf("stuck at height %.0f since %s", height, previous.heightSince.Format(time.RFC3339)),
+				map[string]interface{}{"height": height, "since": previous.heightSince})
+			current.stalled = true
+		}
+		current.height, current.hash = height, hash
+	}
+
+	n.mtx.Lock()
+	*node = current
+	n.mtx.Unlock()
+	return events
+}
+
+// reorganized reports whether the best block hash at height no longer
+// descends from the previous best block of the node. It follows the headers
+// back from the new best block when the chain grew by a few blocks.
+func (n *webhookNotifier) reorganized(ctx context.Context, t *target, previous watchedNode, height float64, hash string) bool {
+	if height <= previous.height {
+		return true
+	}
+	if height-previous.height > maxReorgCheck {
+		return false
+	}
+	block, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		return false
+	}
+	for h := height; h > previous.height; h-- {
+		header, err := t.exporter.Client().GetBlockHeader(ctx, block)
+		if err != nil {
+			slog.Debug("error checking for a reorganization", "node", t.node, "err", err)
+			return false
+		}
+		block = &header.PrevBlock
+	}
+	return block.String() != previous.hash
+}
+
+// prune forgets the nodes which are no longer configured.
+func (n *webhookNotifier) prune(targets []*target) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	configured := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		configured[t.node] = true
+	}
+	for node := range n.nodes {
+		if !configured[node] {
+			delete(n.nodes, node)
+		}
+	}
+}
+
+// notify posts event to every webhook.
+func (n *webhookNotifier) notify(ctx context.Context, event webhookEvent) {
+	slog.Info("notifying webhooks", "event", event.Event, "node", event.Node, "text", event.Text)
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("error encoding notification", "err", err)
+		return
+	}
+	for _, u := range n.urls {
+		outcome := "success"
+		if err := postWebhook(ctx, u, body); err != nil {
+			outcome = "failure"
+			if parsed, parseErr := url.Parse(u); parseErr == nil {
+				u = parsed.Redacted()
+			}
+			slog.Warn("error notifying webhook", "url", u, "event", event.Event, "err", err)
+		}
+		n.notifications.WithLabelValues(event.Event, outcome).Inc()
+	}
+}
+
+func postWebhook(ctx context.Context, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "btcd_exporter/"+version.Version)
+	if *webhookBearerTokenFile != "" {
+		token, err := ioutil.ReadFile(*webhookBearerTokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+// Package btcdtest emulates the JSON-RPC server of btcd, over its websocket
+// endpoint as well as plain HTTP POST requests, so that the exporter can be
+// tested end to end without a node.
+package btcdtest
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/websocket"
+)
+
+// Credentials the server accepts.
+const (
+	Username = "user"
+	Password = "pass"
+)
+
+// Height and BestBlockHash describe the chain the server reports by default.
+var (
+	Height        int32 = 100
+	BestBlockHash       = chainhash.Hash{1}
+	// BestBlockTime is the timestamp of the header of the best block.
+	BestBlockTime = time.Unix(1700000000, 0)
+)
+
+// Handler answers a call of an RPC method. An error of type
+// *btcjson.RPCError is sent as is, other errors as internal errors.
+type Handler func(params []json.RawMessage) (interface{}, error)
+
+// Server is a btcd JSON-RPC server answering with canned results, over TLS.
+type Server struct {
+	srv      *httptest.Server
+	certFile string
+
+	mtx      sync.Mutex
+	handlers map[string]Handler
+	calls    map[string]int
+	batches  int
+	conns    map[*wsConn]bool
+	refuse   bool
+}
+
+// wsConn is a websocket connection of a client, whose writes are serialized.
+type wsConn struct {
+	mtx  sync.Mutex
+	conn *websocket.Conn
+}
+
+func (c *wsConn) write(message interface{}) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.conn.WriteJSON(message)
+}
+
+// request is a JSON-RPC request, response a JSON-RPC response and
+// notification a JSON-RPC 1.0 notification, a request without id.
+type request struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     interface{}       `json:"id"`
+}
+
+type response struct {
+	Result interface{}       `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+	ID     interface{}       `json:"id"`
+}
+
+type notification struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	ID     interface{}   `json:"id"`
+}
+
+// NewServer starts a server answering the calls the collectors make with the
+// results of a mainnet node at Height. Its certificate is written to a
+// temporary file, see CertFile. It is closed at the end of the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		handlers: defaultHandlers(),
+		calls:    make(map[string]int),
+		conns:    make(map[*wsConn]bool),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.serveHTTP)
+	mux.HandleFunc("/ws", s.serveWebsocket)
+	s.srv = httptest.NewTLSServer(mux)
+	t.Cleanup(s.Close)
+
+	s.certFile = filepath.Join(t.TempDir(), "rpc.cert")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.srv.Certificate().Raw})
+	if err := ioutil.WriteFile(s.certFile, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Host returns the host and port the server listens on.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.srv.URL, "https://")
+}
+
+// CertFile returns the path of the TLS certificate of the server.
+func (s *Server) CertFile() string {
+	return s.certFile
+}
+
+// Close drops the connections and stops the server.
+func (s *Server) Close() {
+	s.DropConnections()
+	s.srv.Close()
+}
+
+// Handle makes handler answer the calls of method.
+func (s *Server) Handle(method string, handler Handler) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.handlers[method] = handler
+}
+
+// SetResult makes the calls of method return result.
+func (s *Server) SetResult(method string, result interface{}) {
+	s.Handle(method, func([]json.RawMessage) (interface{}, error) {
+		return result, nil
+	})
+}
+
+// SetError makes the calls of method fail with an RPC error.
+func (s *Server) SetError(method string, code btcjson.RPCErrorCode, message string) {
+	s.Handle(method, func([]json.RawMessage) (interface{}, error) {
+		return nil, &btcjson.RPCError{Code: code, Message: message}
+	})
+}
+
+// Calls returns how many times method was called.
+func (s *Server) Calls(method string) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.calls[method]
+}
+
+// Batches returns how many JSON-RPC batches were posted.
+func (s *Server) Batches() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.batches
+}
+
+// Connections returns the number of open websocket connections.
+func (s *Server) Connections() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.conns)
+}
+
+// Notify sends a notification of method to every websocket client, for
+// example Notify("blockconnected", hash, height, time).
+func (s *Server) Notify(method string, params ...interface{}) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	for _, conn := range s.connections() {
+		conn.write(notification{Method: method, Params: params})
+	}
+}
+
+// DropConnections closes the websocket connections, as a restarting node
+// would.
+func (s *Server) DropConnections() {
+	for _, conn := range s.connections() {
+		conn.conn.Close()
+	}
+}
+
+// SetRefuse makes the server reject every request and websocket handshake
+// with 503 Service Unavailable while refuse is set, as a node which is
+// starting up.
+func (s *Server) SetRefuse(refuse bool) {
+	s.mtx.Lock()
+	s.refuse = refuse
+	s.mtx.Unlock()
+	if refuse {
+		s.DropConnections()
+	}
+}
+
+// WaitConnections waits until n websocket clients are connected.
+func (s *Server) WaitConnections(t testing.TB, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for s.Connections() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d websocket connections, want %d", s.Connections(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *Server) connections() []*wsConn {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	conns := make([]*wsConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// admit checks the credentials of r and that the server is not refusing
+// requests, answering the request otherwise.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request) bool {
+	s.mtx.Lock()
+	refuse := s.refuse
+	s.mtx.Unlock()
+	if refuse {
+		http.Error(w, "503 Service Unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(Username+":"+Password))
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="btcd RPC"`)
+		http.Error(w, "401 Unauthorized.", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.admit(w, r) {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// A JSON-RPC 2.0 batch is an array of requests, answered by an array
+	// of responses.
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		var reqs []request
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mtx.Lock()
+		s.batches++
+		s.mtx.Unlock()
+		responses := make([]response, len(reqs))
+		for i, req := range reqs {
+			responses[i] = s.answer(req)
+		}
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(s.answer(req))
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	if !s.admit(w, r) {
+		return
+	}
+	upgrader := websocket.Upgrader{}
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &wsConn{conn: c}
+	s.mtx.Lock()
+	s.conns[conn] = true
+	s.mtx.Unlock()
+	defer func() {
+		s.mtx.Lock()
+		delete(s.conns, conn)
+		s.mtx.Unlock()
+		c.Close()
+	}()
+	for {
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req request
+		if err := json.Unmarshal(message, &req); err != nil {
+			return
+		}
+		// Calls are answered concurrently, as btcd does, so that a slow
+		// handler does not hold up the others.
+		go func() {
+			conn.write(s.answer(req))
+		}()
+	}
+}
+
+// answer calls the handler of the method of req.
+func (s *Server) answer(req request) response {
+	s.mtx.Lock()
+	s.calls[req.Method]++
+	handler, ok := s.handlers[req.Method]
+	s.mtx.Unlock()
+	if !ok {
+		return response{
+			Error: &btcjson.RPCError{Code: btcjson.ErrRPCMethodNotFound.Code, Message: "Method not found"},
+			ID:    req.ID,
+		}
+	}
+	result, err := handler(req.Params)
+	if err != nil {
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok {
+			rpcErr = &btcjson.RPCError{Code: btcjson.ErrRPCInternal.Code, Message: err.Error()}
+		}
+		return response{Error: rpcErr, ID: req.ID}
+	}
+	return response{Result: result, ID: req.ID}
+}
+
+// defaultHandlers returns the handlers of the calls the collectors make,
+// answering as a mainnet node at Height with a single peer.
+func defaultHandlers() map[string]Handler {
+	result := func(result interface{}) Handler {
+		return func([]json.RawMessage) (interface{}, error) {
+			return result, nil
+		}
+	}
+	return map[string]Handler{
+		"getinfo": result(btcjson.InfoChainResult{
+			Version:         240200,
+			ProtocolVersion: 70016,
+			Blocks:          Height,
+			Connections:     8,
+			Difficulty:      1.5,
+			RelayFee:        0.00001,
+		}),
+		"getbestblockhash": result(BestBlockHash.String()),
+		"getcurrentnet":    result(uint32(wire.MainNet)),
+		"getblockchaininfo": result(btcjson.GetBlockChainInfoResult{
+			Chain:         "main",
+			Blocks:        Height,
+			Headers:       Height,
+			BestBlockHash: BestBlockHash.String(),
+			Difficulty:    1.5,
+		}),
+		"getblockhash":       result(BestBlockHash.String()),
+		"getblockheader":     getBlockHeader,
+		"getconnectioncount": result(8),
+		"getnettotals": result(btcjson.GetNetTotalsResult{
+			TotalBytesRecv: 2048,
+			TotalBytesSent: 1024,
+			TimeMillis:     BestBlockTime.UnixMilli(),
+		}),
+		"getpeerinfo": result([]btcjson.GetPeerInfoResult{{
+			ID:        1,
+			Addr:      "203.0.113.1:8333",
+			Services:  "00000009",
+			SubVer:    "/btcd:0.24.2/",
+			Version:   70016,
+			BytesSent: 100,
+			BytesRecv: 200,
+			PingTime:  1500,
+			BanScore:  5,
+		}}),
+		"getmempoolinfo": result(btcjson.GetMempoolInfoResult{Size: 10, Bytes: 2500}),
+		"getmininginfo": result(btcjson.GetMiningInfoResult{
+			Blocks:           int64(Height),
+			NetworkHashPS:    4e9,
+			PooledTx:         10,
+			CurrentBlockSize: 1000,
+			CurrentBlockTx:   3,
+		}),
+		// btcd reports an empty result page as an error.
+		"searchrawtransactions": func([]json.RawMessage) (interface{}, error) {
+			return nil, &btcjson.RPCError{Code: btcjson.ErrRPCNoTxInfo, Message: "No information available about transaction"}
+		},
+		"loadtxfilter":          result(nil),
+		"notifyblocks":          result(nil),
+		"notifynewtransactions": result(nil),
+		"rescan":                result(nil),
+		"session":               result(btcjson.SessionResult{SessionID: 1}),
+	}
+}
+
+// getBlockHeader answers getblockheader for BestBlockHash, verbose or not.
+func getBlockHeader(params []json.RawMessage) (interface{}, error) {
+	var hash string
+	if len(params) > 0 {
+		json.Unmarshal(params[0], &hash)
+	}
+	if hash != BestBlockHash.String() {
+		return nil, &btcjson.RPCError{Code: btcjson.ErrRPCBlockNotFound, Message: "Block not found"}
+	}
+	header := wire.BlockHeader{Version: 1, Timestamp: BestBlockTime, Bits: 0x1d00ffff}
+	verbose := true
+	if len(params) > 1 {
+		json.Unmarshal(params[1], &verbose)
+	}
+	if verbose {
+		return btcjson.GetBlockHeaderVerboseResult{
+			Hash:       hash,
+			Height:     Height,
+			Version:    header.Version,
+			Time:       header.Timestamp.Unix(),
+			Bits:       fmt.Sprintf("%08x", header.Bits),
+			Difficulty: 1.5,
+		}, nil
+	}
+	var buf bytes.Buffer
+	if err := header.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
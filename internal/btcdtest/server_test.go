@@ -0,0 +1,80 @@
+package btcdtest
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+func newClient(t *testing.T, s *Server, handlers *rpcclient.NotificationHandlers) *rpcclient.Client {
+	t.Helper()
+	cert, err := ioutil.ReadFile(s.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         s.Host(),
+		Endpoint:     "ws",
+		User:         Username,
+		Pass:         Password,
+		Certificates: cert,
+	}, handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Shutdown)
+	return client
+}
+
+func TestServerCalls(t *testing.T) {
+	s := NewServer(t)
+	client := newClient(t, s, nil)
+	hash, err := client.GetBestBlockHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *hash != BestBlockHash {
+		t.Errorf("got best block %s, want %s", hash, BestBlockHash)
+	}
+	header, err := client.GetBlockHeader(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.Timestamp.Equal(BestBlockTime) {
+		t.Errorf("got block time %s, want %s", header.Timestamp, BestBlockTime)
+	}
+	if _, err := client.GetBlockCount(); err == nil {
+		t.Error("call of a method without handler succeeded")
+	}
+	if n := s.Calls("getbestblockhash"); n != 1 {
+		t.Errorf("getbestblockhash called %d times, want 1", n)
+	}
+}
+
+func TestServerNotify(t *testing.T) {
+	s := NewServer(t)
+	type block struct {
+		hash   chainhash.Hash
+		height int32
+	}
+	connected := make(chan block, 1)
+	newClient(t, s, &rpcclient.NotificationHandlers{
+		OnBlockConnected: func(hash *chainhash.Hash, height int32, t time.Time) {
+			connected <- block{*hash, height}
+		},
+	})
+	s.WaitConnections(t, 1)
+
+	s.Notify("blockconnected", BestBlockHash.String(), Height+1, BestBlockTime.Unix())
+	select {
+	case b := <-connected:
+		if b.hash != BestBlockHash || b.height != Height+1 {
+			t.Errorf("got block %s at %d, want %s at %d", b.hash, b.height, BestBlockHash, Height+1)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not received")
+	}
+}
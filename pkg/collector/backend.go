@@ -0,0 +1,235 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Backends, see RPCConfig.
+const (
+	BackendBtcd     = "btcd"
+	BackendBitcoind = "bitcoind"
+)
+
+// backend hides the differences between the node implementations the
+// exporter can scrape.
+type backend interface {
+	// certFile returns the path of the TLS certificate of the RPC server,
+	// empty if TLS is not used.
+	certFile(config RPCConfig) string
+	// configure completes the connection settings of connCfg.
+	configure(config RPCConfig, connCfg *rpcclient.ConnConfig) error
+	// chainInfo returns the state of the best chain.
+	chainInfo(ctx context.Context, client *rpcclient.Client) (*ChainInfo, error)
+	// connectionCount returns the number of connected peers.
+	connectionCount(ctx context.Context, client *rpcclient.Client) (int64, error)
+	// pingSeconds converts a ping time reported by getpeerinfo to seconds.
+	pingSeconds(pingTime float64) float64
+	// supports reports whether the named collector works with the backend.
+	supports(collector string) bool
+}
+
+// ChainInfo describes the best chain of a node.
+type ChainInfo struct {
+	// Chain is the name of the network, as in chaincfg: mainnet,
+	// testnet3, regtest, signet or simnet.
+	Chain string
+	// Blocks is the height of the best block.
+	Blocks        int64
+	Difficulty    float64
+	BestBlockHash *chainhash.Hash
+}
+
+// newBackend returns the backend called name, btcd if name is empty.
+func newBackend(name string) (backend, error) {
+	switch name {
+	case "", BackendBtcd:
+		return btcdBackend{}, nil
+	case BackendBitcoind:
+		return bitcoindBackend{}, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", name)
+}
+
+// chainName returns the name of the network identified by net.
+func chainName(net wire.BitcoinNet) string {
+	for _, params := range []*chaincfg.Params{
+		&chaincfg.MainNetParams,
+		&chaincfg.TestNet3Params,
+		&chaincfg.RegressionNetParams,
+		&chaincfg.SigNetParams,
+		&chaincfg.SimNetParams,
+	} {
+		if params.Net == net {
+			return params.Name
+		}
+	}
+	return net.String()
+}
+
+// blockchainInfo returns the state of the best chain from getblockchaininfo,
+// which btcd and Bitcoin Core both serve, the latter naming the main and
+// test networks main and test.
+func blockchainInfo(ctx context.Context, client *rpcclient.Client) (*ChainInfo, error) {
+	// The result of getblockchaininfo is parsed here, since its rpcclient
+	// future cannot be awaited with a deadline.
+	raw, err := Call(ctx, "getblockchaininfo", func() rpcclient.FutureRawResult {
+		return client.RawRequestAsync("getblockchaininfo", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var info btcjson.GetBlockChainInfoResult
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, err
+	}
+	bestBlockHash, err := chainhash.NewHashFromStr(info.BestBlockHash)
+	if err != nil {
+		return nil, err
+	}
+	chain := info.Chain
+	switch chain {
+	case "main":
+		chain = chaincfg.MainNetParams.Name
+	case "test":
+		chain = chaincfg.TestNet3Params.Name
+	}
+	return &ChainInfo{
+		Chain:         chain,
+		Blocks:        int64(info.Blocks),
+		Difficulty:    info.Difficulty,
+		BestBlockHash: bestBlockHash,
+	}, nil
+}
+
+// btcdBackend talks to btcd, over TLS, preferably through a websocket.
+type btcdBackend struct {
+	// legacyGetInfo makes the backend use the deprecated getinfo, for btcd
+	// releases without getblockchaininfo.
+	legacyGetInfo bool
+}
+
+func (btcdBackend) certFile(config RPCConfig) string {
+	if config.TLS.CertFile != "" {
+		return config.TLS.CertFile
+	}
+	btcdHomeDir := btcutil.AppDataDir("btcd", false)
+	return filepath.Join(btcdHomeDir, "rpc.cert")
+}
+
+func (b btcdBackend) configure(config RPCConfig, connCfg *rpcclient.ConnConfig) error {
+	certPath := b.certFile(config)
+	if config.TLS.CertFile == "" {
+		slog.Info("--rpc.cert not set, using default path", "path", certPath)
+	}
+	certs, err := ioutil.ReadFile(certPath)
+	// Without verification, the certificate is not needed.
+	if err != nil && !config.TLS.InsecureSkipVerify {
+		return fmt.Errorf("error reading cert file: %w", err)
+	}
+	connCfg.Endpoint = "ws"
+	connCfg.Certificates = certs
+	connCfg.HTTPPostMode = config.Mode == RPCModeHTTP
+	return nil
+}
+
+func (b btcdBackend) chainInfo(ctx context.Context, client *rpcclient.Client) (*ChainInfo, error) {
+	if !b.legacyGetInfo {
+		return blockchainInfo(ctx, client)
+	}
+	info, err := Call(ctx, "getinfo", client.GetInfoAsync)
+	if err != nil {
+		return nil, err
+	}
+	bestBlockHash, err := Call(ctx, "getbestblockhash", client.GetBestBlockHashAsync)
+	if err != nil {
+		return nil, err
+	}
+	net, err := Call(ctx, "getcurrentnet", client.GetCurrentNetAsync)
+	if err != nil {
+		return nil, err
+	}
+	return &ChainInfo{
+		Chain:         chainName(net),
+		Blocks:        int64(info.Blocks),
+		Difficulty:    info.Difficulty,
+		BestBlockHash: bestBlockHash,
+	}, nil
+}
+
+func (b btcdBackend) connectionCount(ctx context.Context, client *rpcclient.Client) (int64, error) {
+	if !b.legacyGetInfo {
+		return Call(ctx, "getconnectioncount", client.GetConnectionCountAsync)
+	}
+	info, err := Call(ctx, "getinfo", client.GetInfoAsync)
+	if err != nil {
+		return 0, err
+	}
+	return int64(info.Connections), nil
+}
+
+func (btcdBackend) pingSeconds(pingTime float64) float64 {
+	// btcd reports the ping time in microseconds.
+	return pingTime / 1e6
+}
+
+func (btcdBackend) supports(collector string) bool {
+	return true
+}
+
+// bitcoindBackend talks to Bitcoin Core, which only serves plain HTTP POST
+// requests and has neither getinfo nor an address index.
+type bitcoindBackend struct{}
+
+func (bitcoindBackend) certFile(config RPCConfig) string {
+	return config.TLS.CertFile
+}
+
+func (bitcoindBackend) configure(config RPCConfig, connCfg *rpcclient.ConnConfig) error {
+	if config.Mode == RPCModeWebsocket {
+		return fmt.Errorf("bitcoind does not support rpc mode %q", config.Mode)
+	}
+	connCfg.HTTPPostMode = true
+	// TLS is only used when configured, for example when bitcoind is behind
+	// a TLS terminating proxy.
+	if config.TLS.CertFile == "" {
+		connCfg.DisableTLS = !config.TLS.InsecureSkipVerify && config.TLS.ServerName == ""
+		return nil
+	}
+	certs, err := ioutil.ReadFile(config.TLS.CertFile)
+	if err != nil {
+		return fmt.Errorf("error reading cert file: %w", err)
+	}
+	connCfg.Certificates = certs
+	return nil
+}
+
+func (bitcoindBackend) chainInfo(ctx context.Context, client *rpcclient.Client) (*ChainInfo, error) {
+	return blockchainInfo(ctx, client)
+}
+
+func (bitcoindBackend) connectionCount(ctx context.Context, client *rpcclient.Client) (int64, error) {
+	return Call(ctx, "getconnectioncount", client.GetConnectionCountAsync)
+}
+
+func (bitcoindBackend) pingSeconds(pingTime float64) float64 {
+	// Bitcoin Core reports the ping time in seconds.
+	return pingTime
+}
+
+func (bitcoindBackend) supports(collector string) bool {
+	// searchrawtransactions is specific to btcd, so are websocket
+	// notifications.
+	return collector != "address" && collector != "deposits" && collector != "payments"
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// rpcBatcher sends the calls made at the same time, as those of the
+// collectors of a scrape, as a single JSON-RPC batch over HTTP POST. The batch
+// client of rpcclient cannot be used concurrently, so a single goroutine
+// queues the calls and sends the batches.
+type rpcBatcher struct {
+	client   *rpcclient.Client
+	window   time.Duration
+	calls    chan batchCall
+	shutdown chan struct{}
+}
+
+// batchCall queues a call into the current batch and hands it back.
+type batchCall struct {
+	send   func()
+	queued chan *rpcBatch
+}
+
+// rpcBatch is a batch of calls. failed is closed when the batch could not be
+// sent, in which case its calls get no response.
+type rpcBatch struct {
+	failed chan struct{}
+	err    error
+}
+
+func newRPCBatcher(connCfg *rpcclient.ConnConfig, window time.Duration, shutdown chan struct{}) (*rpcBatcher, error) {
+	client, err := rpcclient.NewBatch(connCfg)
+	if err != nil {
+		return nil, err
+	}
+	b := &rpcBatcher{
+		client:   client,
+		window:   window,
+		calls:    make(chan batchCall, 64),
+		shutdown: shutdown,
+	}
+	go b.run()
+	return b, nil
+}
+
+// run queues the calls for the window after the first call of a batch,
+// then sends the batch, until the client is shut down.
+func (b *rpcBatcher) run() {
+	for {
+		batch := &rpcBatch{failed: make(chan struct{})}
+		calls := 0
+		select {
+		case call := <-b.calls:
+			b.queue(call, batch)
+			calls++
+		case <-b.shutdown:
+			return
+		}
+		window := time.NewTimer(b.window)
+	collect:
+		for {
+			select {
+			case call := <-b.calls:
+				b.queue(call, batch)
+				calls++
+			case <-window.C:
+				break collect
+			case <-b.shutdown:
+				window.Stop()
+				return
+			}
+		}
+		if batch.err = b.send(); batch.err != nil {
+			slog.Warn("RPC batch failed", "calls", calls, "err", batch.err)
+			close(batch.failed)
+		} else {
+			slog.Debug("RPC batch", "calls", calls)
+		}
+	}
+}
+
+func (b *rpcBatcher) queue(call batchCall, batch *rpcBatch) {
+	call.send()
+	call.queued <- batch
+}
+
+// send sends the queued calls, delivering their responses. rpcclient panics
+// on a response to a call it did not send, which is turned into an error.
+func (b *rpcBatcher) send() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid batch response: %v", r)
+		}
+	}()
+	return b.client.Send()
+}
+
+// Shutdown stops the batch client.
+func (b *rpcBatcher) Shutdown() {
+	b.client.Shutdown()
+}
+
+// sendBatched queues the call send makes into the next batch of b, giving up
+// when ctx is done first.
+func sendBatched[F any](ctx context.Context, b *rpcBatcher, send func() F) (F, *rpcBatch, error) {
+	var f, zero F
+	queued := make(chan *rpcBatch, 1)
+	call := batchCall{
+		send:   func() { f = send() },
+		queued: queued,
+	}
+	select {
+	case b.calls <- call:
+	case <-b.shutdown:
+		return zero, nil, rpcclient.ErrClientShutdown
+	case <-ctx.Done():
+		return zero, nil, ctx.Err()
+	}
+	// f is only read once the call is queued, an abandoned call is still
+	// sent and its response dropped.
+	select {
+	case batch := <-queued:
+		return f, batch, nil
+	case <-b.shutdown:
+		return zero, nil, rpcclient.ErrClientShutdown
+	case <-ctx.Done():
+		return zero, nil, ctx.Err()
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Run with go test -run '^$' -bench . -benchmem ./pkg/collector/ and compare
+// runs with benchstat.
+
+// newPeers returns n peers as reported by getpeerinfo.
+func newPeers(n int) []btcjson.GetPeerInfoResult {
+	peers := make([]btcjson.GetPeerInfoResult, n)
+	for i := range peers {
+		peers[i] = btcjson.GetPeerInfoResult{
+			ID:        int32(i),
+			Addr:      fmt.Sprintf("198.51.%d.%d:8333", i/256, i%256),
+			SubVer:    "/btcd:0.24.2/",
+			Version:   70016,
+			Inbound:   i%2 == 0,
+			BytesSent: uint64(i) * 1000,
+			BytesRecv: uint64(i) * 2000,
+			PingTime:  float64(i * 100),
+			BanScore:  int32(i % 100),
+		}
+	}
+	return peers
+}
+
+// drain collects exporter, discarding the metrics.
+func drain(exporter *Exporter) {
+	ch := make(chan prometheus.Metric, 64)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	exporter.Collect(ch)
+	close(ch)
+	<-done
+}
+
+func BenchmarkExporterCollect(b *testing.B) {
+	for _, test := range []struct {
+		name       string
+		collectors []string
+	}{
+		{"default", []string{"address", "chain", "network"}},
+		{"all", []string{"address", "chain", "mempool", "mining", "network", "peers"}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			exporter, err := NewExporter(newFakeNode(), enabled(test.collectors...), DefaultOptions())
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				drain(exporter)
+			}
+		})
+	}
+}
+
+func BenchmarkPeersCollector(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("peers=%d", n), func(b *testing.B) {
+			node := newFakeNode()
+			node.peerInfo = newPeers(n)
+			exporter, err := NewExporter(node, enabled("peers"), DefaultOptions())
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				drain(exporter)
+			}
+		})
+	}
+}
+
+func BenchmarkAddressCollector(b *testing.B) {
+	// A page of searchrawtransactions per address.
+	node := newFakeNode()
+	txs := node.transactions[genesisAddress]
+	for len(txs) < searchPageSize {
+		txs = append(txs, txs[:2]...)
+	}
+	node.transactions[genesisAddress] = txs[:searchPageSize-1]
+	config := enabled("address")
+	config.Addresses = []WatchedAddress{{Address: genesisAddress}}
+	exporter, err := NewExporter(node, config, DefaultOptions())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		drain(exporter)
+	}
+}
+
+// BenchmarkScrape measures a whole scrape of a node with 1000 peers, from
+// the RPC results to the text exposition format.
+func BenchmarkScrape(b *testing.B) {
+	node := newFakeNode()
+	node.peerInfo = newPeers(1000)
+	exporter, err := NewExporter(node, enabled("chain", "mempool", "network", "peers"), DefaultOptions())
+	if err != nil {
+		b.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		families, err := reg.Gather()
+		if err != nil {
+			b.Fatal(err)
+		}
+		enc := expfmt.NewEncoder(io.Discard, expfmt.NewFormat(expfmt.TypeTextPlain))
+		for _, family := range families {
+			if err := enc.Encode(family); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
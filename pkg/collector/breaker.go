@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// States of a circuit breaker.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+var circuitStates = []string{circuitClosed, circuitOpen, circuitHalfOpen}
+
+// circuitBreaker stops the scrapes of a node from querying it after it failed
+// several times in a row, so that a node which is down or restarting is not
+// hammered with RPC calls by every scraper. Once the cooldown has passed, a
+// single scrape is let through to try the node again.
+type circuitBreaker struct {
+	host      string
+	threshold int
+	cooldown  time.Duration
+
+	mtx      sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// newCircuitBreaker returns the circuit breaker of the node at host, nil if
+// the CircuitBreakerFailures of opts disable it.
+func newCircuitBreaker(host string, opts Options) *circuitBreaker {
+	if opts.CircuitBreakerFailures <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		host:      host,
+		threshold: opts.CircuitBreakerFailures,
+		cooldown:  opts.CircuitBreakerCooldown,
+		state:     circuitClosed,
+	}
+}
+
+// allow reports whether a scrape may query the node. When it does, the
+// outcome has to be reported with done.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	switch b.state {
+	case circuitClosed:
+		return true
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		// The scrapes in parallel with the trial are kept out.
+		b.state = circuitHalfOpen
+		return true
+	}
+	return false
+}
+
+// done records the outcome of a scrape let through by allow.
+func (b *circuitBreaker) done(success bool) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if success {
+		if b.state != circuitClosed {
+			slog.Info("node answers again, closing circuit", "host", b.host)
+		}
+		b.state, b.failures = circuitClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		if b.state == circuitClosed {
+			slog.Warn("node failed repeatedly, opening circuit", "host", b.host, "failures", b.failures, "cooldown", b.cooldown)
+		}
+		b.state, b.openedAt = circuitOpen, time.Now()
+	}
+}
+
+// current returns the state of the circuit.
+func (b *circuitBreaker) current() string {
+	if b == nil {
+		return circuitClosed
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.state
+}
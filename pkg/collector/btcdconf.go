@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// DefaultBtcdConfigFile is where btcd reads its configuration file from by
+// default.
+var DefaultBtcdConfigFile = filepath.Join(btcutil.AppDataDir("btcd", false), "btcd.conf")
+
+// btcdRPCPorts are the default RPC ports of btcd by network option.
+var btcdRPCPorts = map[string]string{
+	"testnet": "18334",
+	"regtest": "18334",
+	"simnet":  "18556",
+	"signet":  "38332",
+}
+
+// readBtcdConfig parses the btcd configuration file at path and returns the
+// settings needed to connect to its RPC server. The file is in the INI format
+// of btcd, only the options about the RPC server and the network are looked
+// at.
+func readBtcdConfig(path string) (*RPCConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	options := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			// Boolean options may be given without a value.
+			name, value = line, "1"
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		// Only the first rpclisten is used.
+		if _, seen := options[name]; seen && name == "rpclisten" {
+			continue
+		}
+		options[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	port := "8334"
+	for network, networkPort := range btcdRPCPorts {
+		if value, ok := options[network]; ok && value != "0" && value != "false" {
+			port = networkPort
+		}
+	}
+	config := &RPCConfig{
+		Host:     net.JoinHostPort("127.0.0.1", port),
+		Username: options["rpcuser"],
+		Password: options["rpcpass"],
+	}
+	// The limited user is enough for the default collectors.
+	if config.Username == "" && config.Password == "" {
+		config.Username = options["rpclimituser"]
+		config.Password = options["rpclimitpass"]
+	}
+	if listen := options["rpclisten"]; listen != "" {
+		host, listenPort, err := net.SplitHostPort(listen)
+		if err != nil {
+			// rpclisten may omit the port.
+			host, listenPort = listen, port
+		}
+		// The exporter runs on the same host, wildcard addresses are
+		// reached through the loopback interface.
+		switch host {
+		case "", "0.0.0.0":
+			host = "127.0.0.1"
+		case "::":
+			host = "::1"
+		}
+		config.Host = net.JoinHostPort(host, listenPort)
+	}
+	if rpccert := options["rpccert"]; rpccert != "" {
+		config.TLS.CertFile = cleanBtcdPath(rpccert)
+	}
+	return config, nil
+}
+
+// cleanBtcdPath expands a leading ~ the way btcd does.
+func cleanBtcdPath(path string) string {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	return filepath.Clean(os.ExpandEnv(path))
+}
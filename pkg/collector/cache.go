@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// lruCache keeps the values of the most recently used keys, up to size of
+// them. It is meant for the data of a block, which never changes for a given
+// hash. A nil cache keeps nothing.
+type lruCache[K comparable, V any] struct {
+	size int
+
+	mtx     sync.Mutex
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache returns a cache of size entries, nil if size is not positive.
+func newLRUCache[K comparable, V any](size int) *lruCache[K, V] {
+	if size <= 0 {
+		return nil
+	}
+	return &lruCache[K, V]{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[K]*list.Element, size),
+	}
+}
+
+// get returns the value of key, if cached.
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	if c == nil {
+		var zero V
+		return zero, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry[K, V]).value, true
+}
+
+// add caches the value of key, evicting the least recently used entry when
+// the cache is full.
+func (c *lruCache[K, V]) add(key K, value V) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// cached returns the value of key from the cache, or gets and caches it. A
+// hit is counted in the cache hits of the RPC method the value is otherwise
+// fetched with, in the RPCMetrics of the client of ctx.
+func cached[K comparable, V any](ctx context.Context, c *lruCache[K, V], method string, key K, get func() (V, error)) (V, error) {
+	if value, ok := c.get(key); ok {
+		optionsFromContext(ctx).RPCMetrics.countCacheHit(method)
+		return value, nil
+	}
+	value, err := get()
+	if err != nil {
+		return value, err
+	}
+	c.add(key, value)
+	return value, nil
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/atk-works/btcd_exporter/internal/btcdtest"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := newLRUCache[int, string](2)
+	cache.add(1, "one")
+	cache.add(2, "two")
+	// Using 1 makes 2 the least recently used entry, evicted by 3.
+	if value, ok := cache.get(1); !ok || value != "one" {
+		t.Errorf("got %q, %v for 1, want one", value, ok)
+	}
+	cache.add(3, "three")
+	if _, ok := cache.get(2); ok {
+		t.Error("2 was not evicted")
+	}
+	for key, want := range map[int]string{1: "one", 3: "three"} {
+		if value, ok := cache.get(key); !ok || value != want {
+			t.Errorf("got %q, %v for %d, want %s", value, ok, key, want)
+		}
+	}
+
+	disabled := newLRUCache[int, string](0)
+	disabled.add(1, "one")
+	if _, ok := disabled.get(1); ok {
+		t.Error("disabled cache returned a value")
+	}
+}
+
+func TestClientBlockCache(t *testing.T) {
+	server := btcdtest.NewServer(t)
+	opts := DefaultOptions()
+	opts.RPCMetrics = NewRPCMetrics(opts)
+	client := newTestClientWithOptions(t, serverConfig(server), false, opts)
+
+	for i := 0; i < 3; i++ {
+		header, err := client.GetBlockHeader(context.Background(), &btcdtest.BestBlockHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !header.Timestamp.Equal(btcdtest.BestBlockTime) {
+			t.Errorf("got timestamp %s, want %s", header.Timestamp, btcdtest.BestBlockTime)
+		}
+		// The cached header is not shared with the callers.
+		header.Nonce++
+	}
+	if n := server.Calls("getblockheader"); n != 1 {
+		t.Errorf("getblockheader called %d times, want 1", n)
+	}
+	if got := testutil.ToFloat64(opts.RPCMetrics.cacheHits.WithLabelValues("getblockheader")); got != 2 {
+		t.Errorf("got %v cache hits counted, want 2", got)
+	}
+}
@@ -0,0 +1,566 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+// Options are the settings of the clients and exporters, given to NewClient
+// and NewExporter. Programs using the package start from DefaultOptions.
+type Options struct {
+	// Namespace prefixes the name of every metric.
+	Namespace string
+	// LegacyMetrics makes the collectors also export the metrics renamed
+	// for their type, btcd_blocks_total, btcd_sent_bytes and
+	// btcd_received_bytes, under their former names and types, while
+	// dashboards and alerts migrate.
+	LegacyMetrics bool
+	// ScrapeConcurrency is the maximum number of collectors querying a
+	// node concurrently during a scrape. 0 or less does not limit them.
+	ScrapeConcurrency int
+	// MaxAge is the maximum age of the values served by the collectors
+	// with an interval. Older values are withheld. 0 serves them however
+	// old.
+	MaxAge time.Duration
+
+	// RPCTimeout is the maximum duration of a single RPC call. 0 only
+	// bounds calls by their context.
+	RPCTimeout time.Duration
+	// RPCRetries is how many times an RPC call failing because of a
+	// connection error is retried.
+	RPCRetries int
+	// RPCRetryBackoff is the delay before the first retry of an RPC call,
+	// doubled on every further retry and randomized by ±50%.
+	RPCRetryBackoff time.Duration
+	// RPCDebug keeps the latest response of the node to every RPC method,
+	// returned by RPCResponses. The calls to btcwallet are never kept.
+	RPCDebug bool
+	// RPCClassicBuckets keeps the classic buckets of the RPC duration
+	// histogram next to its native buckets, for scrapers which do not
+	// ingest native histograms.
+	RPCClassicBuckets bool
+	// RPCBatchWindow is how long the first call of a JSON-RPC batch waits
+	// for the calls made at the same time to join it.
+	RPCBatchWindow time.Duration
+	// BlockCacheSize is how many blocks the headers of are kept by the
+	// client, so that the header of the best block is fetched once rather
+	// than on every scrape. 0 disables the cache.
+	BlockCacheSize int
+
+	// CircuitBreakerFailures is the number of failed scrapes in a row
+	// after which a node is no longer queried for CircuitBreakerCooldown,
+	// its scrapes only reporting it down. 0 disables the circuit breaker.
+	CircuitBreakerFailures int
+	// CircuitBreakerCooldown is how long a node is left alone once its
+	// circuit breaker opened. The next scrape then queries it again.
+	CircuitBreakerCooldown time.Duration
+
+	// RPCMetrics records the RPC calls of the clients, nil not recording
+	// them.
+	RPCMetrics *RPCMetrics
+}
+
+// DefaultOptions returns the default settings of the clients and exporters.
+func DefaultOptions() Options {
+	return Options{
+		Namespace:              "btcd",
+		ScrapeConcurrency:      4,
+		RPCTimeout:             5 * time.Second,
+		RPCRetries:             2,
+		RPCRetryBackoff:        100 * time.Millisecond,
+		RPCClassicBuckets:      true,
+		RPCBatchWindow:         10 * time.Millisecond,
+		BlockCacheSize:         128,
+		CircuitBreakerFailures: 3,
+		CircuitBreakerCooldown: 30 * time.Second,
+	}
+}
+
+// Collector is the interface a btcd collector has to implement.
+type Collector interface {
+	// Update sends the collector's metrics to ch. It gives up when ctx is
+	// done.
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
+}
+
+type collectorFactory func(client RPC, config *Config, opts Options) (Collector, error)
+
+var (
+	factories        = make(map[string]collectorFactory)
+	collectorDefault = make(map[string]bool)
+)
+
+// registerCollector makes a collector available under name, enabled by
+// default if isDefaultEnabled is set.
+func registerCollector(name string, isDefaultEnabled bool, factory collectorFactory) {
+	collectorDefault[name] = isDefaultEnabled
+	factories[name] = factory
+}
+
+// Names returns the names of the available collectors, sorted.
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// labelNames are the labels of the metrics of the collectors and of the RPC
+// calls, besides the labels of the watched addresses.
+var labelNames = []string{
+	"addr", "address", "category", "chain", "collector", "directory", "hash",
+	"inbound", "kind", "le", "level", "method", "state", "status",
+	"subscription", "subsystem", "subver", "version",
+}
+
+// LabelNames returns the names of the labels the metrics of the exporter
+// carry, sorted. Constant labels cannot reuse them.
+func LabelNames() []string {
+	names := append([]string(nil), labelNames...)
+	sort.Strings(names)
+	return names
+}
+
+// DefaultEnabled reports whether the named collector is enabled unless
+// configured otherwise.
+func DefaultEnabled(name string) bool {
+	return collectorDefault[name]
+}
+
+// Exporter runs the enabled collectors against a btcd node.
+type Exporter struct {
+	client      RPC
+	breaker     *circuitBreaker
+	collectors  map[string]Collector
+	concurrency int
+
+	up                *prometheus.Desc
+	rpcConnected      *prometheus.Desc
+	rpcReconnects     *prometheus.Desc
+	subscription      *prometheus.Desc
+	subscriptionAge   *prometheus.Desc
+	resubscriptions   *prometheus.Desc
+	collectorSuccess  *prometheus.Desc
+	collectorDuration *prometheus.Desc
+	scrapeDuration    *prometheus.Desc
+	pollAge           *prometheus.Desc
+	lastSuccess       *prometheus.Desc
+	collectorLastOK   *prometheus.Desc
+	circuitState      *prometheus.Desc
+
+	// mtx guards the outcome of the last scrape and collector runs, which
+	// outlive a single scrape.
+	mtx             sync.Mutex
+	lastSuccessTime time.Time
+	lastScrape      ScrapeStatus
+	collectorStatus map[string]CollectorStatus
+}
+
+// ScrapeStatus is the outcome of the last scrape of a node.
+type ScrapeStatus struct {
+	Time     time.Time
+	Duration time.Duration
+	// Up is set when at least one collector succeeded.
+	Up          bool
+	LastSuccess time.Time
+	Collectors  map[string]CollectorStatus
+}
+
+// CollectorStatus is the outcome of the last run of a collector.
+type CollectorStatus struct {
+	Duration    time.Duration
+	Err         error
+	LastSuccess time.Time
+}
+
+// NewExporter creates an Exporter with every enabled collector supported by
+// the backend of client.
+func NewExporter(client RPC, config *Config, opts Options) (*Exporter, error) {
+	backend, err := newBackend(client.Backend())
+	if err != nil {
+		return nil, err
+	}
+	collectors := make(map[string]Collector)
+	for _, name := range config.EnabledCollectors() {
+		if !backend.supports(name) {
+			continue
+		}
+		collector, err := factories[name](client, config, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s collector: %w", name, err)
+		}
+		if interval := config.collectorInterval(name); interval > 0 {
+			collector = newCachingCollector(name, collector, interval, opts.MaxAge)
+		}
+		collectors[name] = collector
+	}
+	// The circuit breaker belongs to the client, so that it outlives the
+	// exporters recreated on reloads. Other RPC implementations have none.
+	var breaker *circuitBreaker
+	if c, ok := client.(*Client); ok {
+		breaker = c.breaker
+	}
+	return &Exporter{
+		client:          client,
+		breaker:         breaker,
+		collectors:      collectors,
+		concurrency:     opts.ScrapeConcurrency,
+		collectorStatus: make(map[string]CollectorStatus),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "up"),
+			"Was the last btcd query successful, that is did at least one collector succeed.",
+			nil, nil,
+		),
+		rpcConnected: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "rpc", "connected"),
+			"Whether the websocket connection to btcd is established.",
+			nil, nil,
+		),
+		rpcReconnects: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "rpc", "reconnects_total"),
+			"How many times the websocket connection to btcd was reestablished after being lost.",
+			nil, nil,
+		),
+		subscription: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "rpc", "subscription_active"),
+			"Whether btcd notifies the websocket connection of the exporter, by subscription.",
+			[]string{"subscription"}, nil,
+		),
+		subscriptionAge: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "rpc", "subscription_last_notification_age_seconds"),
+			"Seconds since btcd last sent a notification of a subscription, or since the subscription was last established if later.",
+			[]string{"subscription"}, nil,
+		),
+		resubscriptions: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "rpc", "resubscriptions_total"),
+			"How many times a subscription to the notifications of btcd was established again after being dropped.",
+			[]string{"subscription"}, nil,
+		),
+		collectorSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "collector", "success"),
+			"Whether a collector succeeded.",
+			[]string{"collector"}, nil,
+		),
+		collectorDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "collector", "duration_seconds"),
+			"How long a collector took.",
+			[]string{"collector"}, nil,
+		),
+		scrapeDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "exporter", "scrape_duration_seconds"),
+			"How long querying the node took, for all collectors.",
+			nil, nil,
+		),
+		pollAge: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "exporter", "poll_age_seconds"),
+			"How long ago the values served were collected by the background poll of the node.",
+			nil, nil,
+		),
+		lastSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "exporter", "last_scrape_success_timestamp_seconds"),
+			"When the node was last queried successfully, that is at least one collector succeeded. 0 if never.",
+			nil, nil,
+		),
+		collectorLastOK: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "collector", "last_success_timestamp_seconds"),
+			"When a collector last succeeded. 0 if never.",
+			[]string{"collector"}, nil,
+		),
+		circuitState: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "rpc", "circuit_state"),
+			"State of the circuit breaker of the node, 1 for the current state: closed while the node is queried, open while it is left alone after failing repeatedly, half_open while it is tried again.",
+			[]string{"state"}, nil,
+		),
+	}, nil
+}
+
+// Client returns the RPC client the exporter queries.
+func (e *Exporter) Client() RPC {
+	return e.client
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.up
+	ch <- e.rpcConnected
+	ch <- e.rpcReconnects
+	ch <- e.subscription
+	ch <- e.subscriptionAge
+	ch <- e.resubscriptions
+	ch <- e.collectorSuccess
+	ch <- e.collectorDuration
+	ch <- e.scrapeDuration
+	// The poll age is only emitted by a PollingCollector of the exporter.
+	ch <- e.pollAge
+	ch <- e.lastSuccess
+	ch <- e.collectorLastOK
+	ch <- e.circuitState
+}
+
+// Collect runs every collector without a deadline.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext runs every collector and sends whatever metrics were
+// obtained before ctx is done, along with the success of each collector.
+// While the circuit breaker of the node is open, no collector runs and the
+// node is reported down.
+func (e *Exporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	var (
+		mtx       sync.Mutex
+		metrics   []prometheus.Metric
+		succeeded int
+		g         errgroup.Group
+	)
+	if e.concurrency > 0 {
+		g.SetLimit(e.concurrency)
+	}
+	start := time.Now()
+	allowed := e.breaker.allow()
+	for name, c := range e.collectors {
+		if !allowed {
+			break
+		}
+		name, c := name, c
+		g.Go(func() error {
+			collectorStart := time.Now()
+			collected, err := collect(ctx, c)
+			duration := time.Since(collectorStart)
+			success := 1.0
+			if err != nil {
+				// Withheld metrics are logged when they become stale
+				// and when refreshed again, not on every scrape.
+				if !errors.Is(err, errStaleMetrics) {
+					slog.Warn("collector failed", "collector", name, "err", err)
+				}
+				success = 0
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			metrics = append(metrics, collected...)
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				e.collectorSuccess, prometheus.GaugeValue, success, name,
+			))
+			metrics = append(metrics, prometheus.MustNewConstMetric(
+				e.collectorDuration, prometheus.GaugeValue, duration.Seconds(), name,
+			))
+			if err == nil {
+				succeeded++
+			}
+			e.mtx.Lock()
+			status := e.collectorStatus[name]
+			status.Duration, status.Err = duration, err
+			if err == nil {
+				status.LastSuccess = time.Now()
+			}
+			e.collectorStatus[name] = status
+			e.mtx.Unlock()
+			return nil
+		})
+	}
+	g.Wait()
+	scrapeDuration := time.Since(start)
+	ch <- prometheus.MustNewConstMetric(
+		e.scrapeDuration, prometheus.GaugeValue, scrapeDuration.Seconds(),
+	)
+	upValue := 0.0
+	if allowed && (succeeded > 0 || len(e.collectors) == 0) {
+		upValue = 1
+	}
+	if allowed {
+		e.breaker.done(upValue == 1)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		e.up, prometheus.GaugeValue, upValue,
+	)
+	e.mtx.Lock()
+	if upValue == 1 {
+		e.lastSuccessTime = time.Now()
+	}
+	e.lastScrape = ScrapeStatus{Time: start, Duration: scrapeDuration, Up: upValue == 1}
+	ch <- prometheus.MustNewConstMetric(e.lastSuccess, prometheus.GaugeValue, unixSeconds(e.lastSuccessTime))
+	for name := range e.collectors {
+		ch <- prometheus.MustNewConstMetric(
+			e.collectorLastOK, prometheus.GaugeValue, unixSeconds(e.collectorStatus[name].LastSuccess), name,
+		)
+	}
+	e.mtx.Unlock()
+	// There is no connection to report on in HTTP POST mode.
+	if !e.client.HTTPPostMode() {
+		connected := 0.0
+		if e.client.Connected() {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(e.rpcConnected, prometheus.GaugeValue, connected)
+		ch <- prometheus.MustNewConstMetric(e.rpcReconnects, prometheus.CounterValue, float64(e.client.Reconnects()))
+		for _, s := range e.client.Subscriptions() {
+			active := 0.0
+			if s.Active {
+				active = 1
+			}
+			last := s.LastNotification
+			if last.Before(s.Since) {
+				last = s.Since
+			}
+			age := 0.0
+			if !last.IsZero() {
+				age = time.Since(last).Seconds()
+			}
+			ch <- prometheus.MustNewConstMetric(e.subscription, prometheus.GaugeValue, active, s.Name)
+			ch <- prometheus.MustNewConstMetric(e.subscriptionAge, prometheus.GaugeValue, age, s.Name)
+			ch <- prometheus.MustNewConstMetric(e.resubscriptions, prometheus.CounterValue, float64(s.Resubscriptions), s.Name)
+		}
+	}
+	if e.breaker != nil {
+		current := e.breaker.current()
+		for _, state := range circuitStates {
+			value := 0.0
+			if state == current {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(e.circuitState, prometheus.GaugeValue, value, state)
+		}
+	}
+	for _, metric := range metrics {
+		ch <- metric
+	}
+}
+
+// Status returns the outcome of the last scrape, with the zero time if the
+// node was not scraped yet.
+func (e *Exporter) Status() ScrapeStatus {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	status := e.lastScrape
+	status.LastSuccess = e.lastSuccessTime
+	status.Collectors = make(map[string]CollectorStatus, len(e.collectors))
+	for name := range e.collectors {
+		status.Collectors[name] = e.collectorStatus[name]
+	}
+	return status
+}
+
+// unixSeconds returns t as seconds since the epoch, 0 for the zero time.
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// collect runs c and returns the metrics it sent.
+func collect(ctx context.Context, c Collector) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Update(ctx, ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics, <-errs
+}
+
+// errStaleMetrics is the error of a collector whose metrics are older than
+// the MaxAge of the options.
+var errStaleMetrics = errors.New("metrics older than the maximum age")
+
+// cachingCollector refreshes the metrics of a slow collector at most once per
+// interval. In between, and while a refresh is running in the background, the
+// previous metrics are served, unless they are older than maxAge when set.
+type cachingCollector struct {
+	name      string
+	collector Collector
+	interval  time.Duration
+	maxAge    time.Duration
+
+	mtx        sync.Mutex
+	metrics    []prometheus.Metric
+	err        error
+	updated    time.Time
+	refreshing bool
+	// first is closed once the first refresh, which concurrent scrapes
+	// wait for, is done.
+	first chan struct{}
+	// stale is set while the metrics are withheld.
+	stale bool
+}
+
+func newCachingCollector(name string, collector Collector, interval, maxAge time.Duration) *cachingCollector {
+	return &cachingCollector{
+		name:      name,
+		collector: collector,
+		interval:  interval,
+		maxAge:    maxAge,
+	}
+}
+
+func (c *cachingCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	if c.updated.IsZero() {
+		// Nothing to serve yet, wait for the first refresh, run by a single
+		// scrape.
+		first, running := c.first, c.first != nil
+		if !running {
+			first = make(chan struct{})
+			c.first = first
+		}
+		c.mtx.Unlock()
+		if running {
+			select {
+			case <-first:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		} else {
+			c.refresh(ctx)
+			close(first)
+		}
+		c.mtx.Lock()
+	} else if time.Since(c.updated) >= c.interval && !c.refreshing {
+		c.refreshing = true
+		// The refresh outlives the scrape which triggered it.
+		go c.refresh(context.Background())
+	}
+	metrics, err := c.metrics, c.err
+	if age := time.Since(c.updated); c.maxAge > 0 && age > c.maxAge {
+		if !c.stale {
+			c.stale = true
+			slog.Warn("withholding stale metrics", "collector", c.name, "age", age.Round(time.Second), "max_age", c.maxAge)
+		}
+		metrics, err = nil, fmt.Errorf("withholding metrics refreshed %s ago: %w", age.Round(time.Second), errStaleMetrics)
+	}
+	c.mtx.Unlock()
+
+	for _, metric := range metrics {
+		ch <- metric
+	}
+	return err
+}
+
+func (c *cachingCollector) refresh(ctx context.Context) {
+	metrics, err := collect(ctx, c.collector)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.metrics = metrics
+	c.err = err
+	c.updated = time.Now()
+	c.refreshing = false
+	if c.stale {
+		c.stale = false
+		slog.Info("serving refreshed metrics again", "collector", c.name)
+	}
+}
@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// searchPageSize is the number of transactions requested per
+// searchrawtransactions call.
+const searchPageSize = 1000
+
+type addressCollector struct {
+	client    RPC
+	addresses []btcutil.Address
+	// labels holds the values of the configured labels of every address, in
+	// the order of the variable labels of the metrics, empty for the labels
+	// set on other addresses only.
+	labels       [][]string
+	balance      *prometheus.Desc
+	transactions *prometheus.Desc
+}
+
+type AddressStatistics struct {
+	address      string
+	received     float64
+	sent         float64
+	transactions int
+}
+
+func init() {
+	registerCollector("address", true, newAddressCollector)
+}
+
+func newAddressCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	addresses, err := config.WatchedAddresses()
+	if err != nil {
+		return nil, err
+	}
+	names, labels := addressLabels(config.Addresses)
+	variableLabels := append([]string{"address"}, names...)
+	return &addressCollector{
+		client:    client,
+		addresses: addresses,
+		labels:    labels,
+		balance: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "address", "balance_btc"),
+			"Balance of a watched address in BTC, including unconfirmed transactions. Requires btcd to run with --addrindex.",
+			variableLabels, nil,
+		),
+		transactions: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "address", "transactions"),
+			"How many transactions involve a watched address, including unconfirmed ones. Requires btcd to run with --addrindex.",
+			variableLabels, nil,
+		),
+	}, nil
+}
+
+func (c *addressCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	for i, address := range c.addresses {
+		statistics, err := c.GetAddressStatistics(ctx, address)
+		if err != nil {
+			return err
+		}
+		labels := append([]string{statistics.address}, c.labels[i]...)
+		ch <- prometheus.MustNewConstMetric(c.balance, prometheus.GaugeValue, statistics.received-statistics.sent, labels...)
+		ch <- prometheus.MustNewConstMetric(c.transactions, prometheus.GaugeValue, float64(statistics.transactions), labels...)
+	}
+	return nil
+}
+
+// addressLabels returns the names of the labels configured for any of
+// addresses, sorted, and the values of these labels for every address, empty
+// for the labels it lacks, since every metric of a name has the same labels.
+func addressLabels(addresses []WatchedAddress) ([]string, [][]string) {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, address := range addresses {
+		for name := range address.Labels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	values := make([][]string, len(addresses))
+	for i, address := range addresses {
+		values[i] = make([]string, len(names))
+		for j, name := range names {
+			values[i][j] = address.Labels[name]
+		}
+	}
+	return names, values
+}
+
+// GetAddressStatistics sums up all transactions paying to or spending from
+// address, as returned by searchrawtransactions.
+func (c *addressCollector) GetAddressStatistics(ctx context.Context, address btcutil.Address) (*AddressStatistics, error) {
+	encoded := address.EncodeAddress()
+	statistics := &AddressStatistics{address: encoded}
+	for skip := 0; ; skip += searchPageSize {
+		txs, err := c.client.SearchRawTransactionsVerbose(ctx, address, skip, searchPageSize)
+		var rpcErr *btcjson.RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCNoTxInfo {
+			// btcd reports an empty result page as an error.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range txs {
+			for _, vin := range tx.Vin {
+				if vin.PrevOut != nil && containsAddress(vin.PrevOut.Addresses, encoded) {
+					statistics.sent += vin.PrevOut.Value
+				}
+			}
+			for _, vout := range tx.Vout {
+				if vout.ScriptPubKey.Address == encoded || containsAddress(vout.ScriptPubKey.Addresses, encoded) {
+					statistics.received += vout.Value
+				}
+			}
+		}
+		statistics.transactions += len(txs)
+		if len(txs) < searchPageSize {
+			break
+		}
+	}
+	return statistics, nil
+}
+
+func containsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type chainCollector struct {
+	client           RPC
+	height           *prometheus.Desc
+	blocks           *prometheus.Desc
+	difficulty       *prometheus.Desc
+	latestBlock      *prometheus.Desc
+	chainInfo        *prometheus.Desc
+	bestBlock        *prometheus.Desc
+	bestBlockChanges *prometheus.Desc
+
+	// mtx guards the best block last seen and how many times it changed
+	// since the collector was created.
+	mtx      sync.Mutex
+	lastBest *chainhash.Hash
+	changes  float64
+}
+
+func init() {
+	registerCollector("chain", true, newChainCollector)
+}
+
+func newChainCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	c := &chainCollector{
+		client: client,
+		height: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "block_height"),
+			"Height of the best chain reported by the node, which decreases on a reorganization to a shorter chain.",
+			nil, nil,
+		),
+		difficulty: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "difficulty"),
+			"What is difficulty reported by the node.",
+			nil, nil,
+		),
+		latestBlock: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "latest_block_timestamp"),
+			"Timestamp of the latest block in the chain. According to block header information.",
+			nil, nil,
+		),
+		chainInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "chain", "info"),
+			"Network the node is on, always 1.",
+			[]string{"chain"}, nil,
+		),
+		bestBlock: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "best_block", "info"),
+			"Hash of the best block reported by the node, always 1.",
+			[]string{"hash"}, nil,
+		),
+		bestBlockChanges: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "best_block", "changes_total"),
+			"How many times the best block reported by the node changed since the exporter started watching it, new blocks and reorganizations alike.",
+			nil, nil,
+		),
+	}
+	if opts.LegacyMetrics {
+		c.blocks = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "blocks_total"),
+			"How many blocks are in the best chain reported by the node. Deprecated, use block_height.",
+			nil, nil,
+		)
+	}
+	return c, nil
+}
+
+func (c *chainCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	info, err := c.client.ChainInfo(ctx)
+	if err != nil {
+		return err
+	}
+	// The state of the chain is served even if the header of the best
+	// block cannot be fetched.
+	ch <- prometheus.MustNewConstMetric(c.height, prometheus.GaugeValue, float64(info.Blocks))
+	if c.blocks != nil {
+		ch <- prometheus.MustNewConstMetric(c.blocks, prometheus.CounterValue, float64(info.Blocks))
+	}
+	ch <- prometheus.MustNewConstMetric(c.difficulty, prometheus.GaugeValue, info.Difficulty)
+	ch <- prometheus.MustNewConstMetric(c.chainInfo, prometheus.GaugeValue, 1, info.Chain)
+	ch <- prometheus.MustNewConstMetric(c.bestBlock, prometheus.GaugeValue, 1, info.BestBlockHash.String())
+	changes := c.countBestChange(info.BestBlockHash)
+	blockHeader, err := c.client.GetBlockHeader(ctx, info.BestBlockHash)
+	if err != nil {
+		return err
+	}
+	// The hash of the best block is attached as an exemplar, so that a data
+	// point can be linked to a block explorer. OpenMetrics does not allow
+	// exemplars on the gauge block_height.
+	ch <- prometheus.MustNewMetricWithExemplars(
+		prometheus.MustNewConstMetric(c.bestBlockChanges, prometheus.CounterValue, changes),
+		prometheus.Exemplar{
+			Value:     1,
+			Labels:    prometheus.Labels{"block_hash": info.BestBlockHash.String()},
+			Timestamp: blockHeader.Timestamp,
+		},
+	)
+	ch <- prometheus.MustNewConstMetric(c.latestBlock, prometheus.GaugeValue, float64(blockHeader.Timestamp.Unix()))
+	return nil
+}
+
+// countBestChange records hash as the best block and returns how many times
+// the best block changed, the first one seen not being a change.
+func (c *chainCollector) countBestChange(hash *chainhash.Hash) float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.lastBest != nil && !c.lastBest.IsEqual(hash) {
+		c.changes++
+	}
+	best := *hash
+	c.lastBest = &best
+	return c.changes
+}
@@ -0,0 +1,491 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// defaultDepositConfirmations is the number of confirmations after
+	// which a deposit counts as credited, unless configured.
+	defaultDepositConfirmations = 6
+	// depositExpiry is how long a transaction is followed at most, like
+	// the expiry of the mempool of Bitcoin Core.
+	depositExpiry = 14 * 24 * time.Hour
+	// depositBlockQueue is the number of connected and disconnected blocks
+	// waiting to be looked at before further ones are dropped.
+	depositBlockQueue = 100
+	// depositMissedBlocks is the number of blocks whose transactions could
+	// not be fetched which are tried again before the oldest are given up.
+	depositMissedBlocks = 100
+)
+
+// depositLatencyBuckets are the upper bounds of the deposit latency
+// histogram in seconds, from a minute to a day.
+var depositLatencyBuckets = []float64{60, 300, 600, 1200, 1800, 3600, 7200, 14400, 28800, 86400}
+
+// depositConflictKinds are the values of the kind label of the deposit
+// conflicts: a replacement paying at least as much to the address, a
+// replacement in the mempool paying less or nothing, and a conflicting
+// transaction confirmed in a block paying less or nothing.
+var depositConflictKinds = []string{"fee_bump", "replacement", "double_spend"}
+
+type depositsCollector struct {
+	tracker   *depositTracker
+	addresses []string
+	labels    [][]string
+	latency   *prometheus.Desc
+	pending   *prometheus.Desc
+	conflicts *prometheus.Desc
+}
+
+func init() {
+	registerCollector("deposits", false, newDepositsCollector)
+}
+
+func newDepositsCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	c, ok := client.(*Client)
+	if !ok || c.HTTPPostMode() {
+		return nil, errors.New("the deposits collector needs the websocket connection of btcd, rpc mode ws")
+	}
+	decoded, err := config.WatchedAddresses()
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(decoded))
+	for i, address := range decoded {
+		addresses[i] = address.EncodeAddress()
+	}
+	confirmations := config.Deposits.Confirmations
+	if confirmations == 0 {
+		confirmations = defaultDepositConfirmations
+	}
+	tracker := c.depositTracker()
+	tracker.watch(addresses, int32(confirmations))
+	names, labels := addressLabels(config.Addresses)
+	variableLabels := append([]string{"address"}, names...)
+	return &depositsCollector{
+		tracker:   tracker,
+		addresses: addresses,
+		labels:    labels,
+		latency: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "deposit", "confirmation_latency_seconds"),
+			"Time from the arrival of a transaction paying to a watched address in the mempool of btcd to its configured number of confirmations.",
+			variableLabels, nil,
+		),
+		pending: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "deposit", "pending"),
+			"How many transactions paying to a watched address are in the mempool or not confirmed enough yet.",
+			variableLabels, nil,
+		),
+		conflicts: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "deposit", "conflicts_total"),
+			"Transactions conflicting with a pending transaction paying to a watched address by spending one of its inputs, by kind.",
+			append(variableLabels, "kind"), nil,
+		),
+	}, nil
+}
+
+func (c *depositsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	latencies, pending, conflicts := c.tracker.snapshot()
+	for i, address := range c.addresses {
+		labels := append([]string{address}, c.labels[i]...)
+		h := latencies[address]
+		if h == nil {
+			h = newLatencyHistogram()
+		}
+		ch <- prometheus.MustNewConstHistogram(c.latency, h.count, h.sum, h.bucketMap(), labels...)
+		ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(pending[address]), labels...)
+		for _, kind := range depositConflictKinds {
+			ch <- prometheus.MustNewConstMetric(c.conflicts, prometheus.CounterValue, float64(conflicts[address][kind]), append(labels, kind)...)
+		}
+	}
+	return nil
+}
+
+// latencyHistogram accumulates the deposit latencies of an address.
+type latencyHistogram struct {
+	count uint64
+	sum   float64
+	// buckets holds the cumulative counts of depositLatencyBuckets.
+	buckets []uint64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make([]uint64, len(depositLatencyBuckets))}
+}
+
+func (h *latencyHistogram) observe(seconds float64) {
+	h.count++
+	h.sum += seconds
+	for i, bound := range depositLatencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+}
+
+func (h *latencyHistogram) bucketMap() map[float64]uint64 {
+	buckets := make(map[float64]uint64, len(depositLatencyBuckets))
+	for i, bound := range depositLatencyBuckets {
+		buckets[bound] = h.buckets[i]
+	}
+	return buckets
+}
+
+// pendingDeposit is a transaction paying to watched addresses which is not
+// confirmed enough yet.
+type pendingDeposit struct {
+	firstSeen time.Time
+	addresses []string
+	// amounts is what the transaction pays to each of the addresses.
+	amounts map[string]float64
+	// inputs are the outpoints the transaction spends.
+	inputs []string
+	// height is the height of the block including the transaction, 0 while
+	// it is in the mempool.
+	height int32
+}
+
+// blockEvent is a block connected to or disconnected from the best chain.
+type blockEvent struct {
+	hash      chainhash.Hash
+	height    int32
+	connected bool
+}
+
+// depositTracker follows the transactions paying to watched addresses from
+// their arrival in the mempool to their confirmation, through the websocket
+// notifications of a node. It lives as long as the client, so that
+// reloading the configuration does not lose the transactions in flight.
+type depositTracker struct {
+	client *Client
+	blocks chan blockEvent
+	// blockTxs returns the transactions of a block, now the current time,
+	// replaced by tests.
+	blockTxs func(ctx context.Context, hash *chainhash.Hash) ([]btcjson.TxRawResult, error)
+	now      func() time.Time
+	// missed are the connected blocks whose transactions could not be
+	// fetched, tried again with the next connected block. It is only used
+	// by the goroutine looking at the blocks.
+	missed []blockEvent
+
+	mtx           sync.Mutex
+	watched       map[string]bool
+	confirmations int32
+	pending       map[string]*pendingDeposit
+	// spent maps the outpoints spent by the pending transactions to their
+	// ids.
+	spent     map[string]string
+	latencies map[string]*latencyHistogram
+	// conflicts counts the conflicts per address and kind.
+	conflicts map[string]map[string]uint64
+}
+
+func newDepositTracker(client *Client) *depositTracker {
+	t := &depositTracker{
+		client:    client,
+		blocks:    make(chan blockEvent, depositBlockQueue),
+		now:       time.Now,
+		watched:   make(map[string]bool),
+		pending:   make(map[string]*pendingDeposit),
+		spent:     make(map[string]string),
+		latencies: make(map[string]*latencyHistogram),
+		conflicts: make(map[string]map[string]uint64),
+	}
+	t.blockTxs = func(ctx context.Context, hash *chainhash.Hash) ([]btcjson.TxRawResult, error) {
+		// The verbose rpcclient future cannot be awaited with a deadline.
+		ctx, rpc := client.rpc(ctx)
+		raw, err := Call(ctx, "getblock", func() rpcclient.FutureRawResult {
+			return rpc.RawRequestAsync("getblock", []json.RawMessage{
+				json.RawMessage(strconv.Quote(hash.String())), json.RawMessage("2"),
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		var block btcjson.GetBlockVerboseResult
+		if err := json.Unmarshal(raw, &block); err != nil {
+			return nil, err
+		}
+		return block.RawTx, nil
+	}
+	return t
+}
+
+// depositTracker returns the deposit tracker of the client, starting it and
+// subscribing to the notifications it needs on first use.
+func (c *Client) depositTracker() *depositTracker {
+	c.depositsOnce.Do(func() {
+		t := newDepositTracker(c)
+		c.deposits.Store(t)
+		go t.run(c.shutdown)
+		go t.subscribe()
+	})
+	return c.deposits.Load()
+}
+
+// subscribe asks btcd for notifications of new blocks and of the
+// transactions accepted to its mempool. It is called again on every
+// reconnection.
+func (t *depositTracker) subscribe() {
+	err := t.client.NotifyBlocks()
+	t.client.subscriptions.subscribed(subscriptionBlocks, err)
+	if err != nil {
+		// The client subscribes once connected.
+		slog.Debug("error subscribing to block notifications", "err", err)
+		return
+	}
+	err = t.client.NotifyNewTransactions(true)
+	t.client.subscriptions.subscribed(subscriptionTransactions, err)
+	if err != nil {
+		slog.Debug("error subscribing to transaction notifications", "err", err)
+	}
+}
+
+// watch sets the addresses to follow and the number of confirmations after
+// which a deposit counts as credited.
+func (t *depositTracker) watch(addresses []string, confirmations int32) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.watched = make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		t.watched[address] = true
+	}
+	t.confirmations = confirmations
+}
+
+// txAccepted records the arrival of tx in the mempool if it pays to a
+// watched address.
+func (t *depositTracker) txAccepted(tx *btcjson.TxRawResult) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.accept(tx, 0)
+}
+
+// accept records tx, seen in the mempool or, with a height, in a block of
+// the best chain. A transaction spending an input of a pending transaction
+// replaces it and is counted as a conflict of the addresses the latter paid
+// to. Transactions first seen in a block are not followed, unless they
+// replace a pending one, whose arrival they inherit. The caller holds t.mtx.
+func (t *depositTracker) accept(tx *btcjson.TxRawResult, height int32) {
+	if deposit, ok := t.pending[tx.Txid]; ok {
+		if height > 0 && deposit.height == 0 {
+			deposit.height = height
+		}
+		return
+	}
+	amounts := make(map[string]float64)
+	var addresses []string
+	for _, vout := range tx.Vout {
+		seen := make(map[string]bool)
+		for _, address := range append([]string{vout.ScriptPubKey.Address}, vout.ScriptPubKey.Addresses...) {
+			if !t.watched[address] || seen[address] {
+				continue
+			}
+			seen[address] = true
+			if _, ok := amounts[address]; !ok {
+				addresses = append(addresses, address)
+			}
+			amounts[address] += vout.Value
+		}
+	}
+	kind := "replacement"
+	if height > 0 {
+		kind = "double_spend"
+	}
+	firstSeen := t.now()
+	replaced := false
+	var inputs []string
+	for i := range tx.Vin {
+		if tx.Vin[i].IsCoinBase() {
+			continue
+		}
+		input := tx.Vin[i].Txid + ":" + strconv.FormatUint(uint64(tx.Vin[i].Vout), 10)
+		inputs = append(inputs, input)
+		owner, ok := t.spent[input]
+		if !ok {
+			continue
+		}
+		deposit := t.pending[owner]
+		for address, amount := range deposit.amounts {
+			k := kind
+			if amounts[address] >= amount {
+				k = "fee_bump"
+			}
+			if t.conflicts[address] == nil {
+				t.conflicts[address] = make(map[string]uint64)
+			}
+			t.conflicts[address][k]++
+		}
+		if deposit.firstSeen.Before(firstSeen) {
+			firstSeen = deposit.firstSeen
+		}
+		replaced = true
+		t.remove(owner)
+	}
+	if len(addresses) == 0 || height > 0 && !replaced {
+		return
+	}
+	t.pending[tx.Txid] = &pendingDeposit{
+		firstSeen: firstSeen,
+		addresses: addresses,
+		amounts:   amounts,
+		inputs:    inputs,
+		height:    height,
+	}
+	for _, input := range inputs {
+		t.spent[input] = tx.Txid
+	}
+}
+
+// remove stops following the pending transaction txid. The caller holds
+// t.mtx.
+func (t *depositTracker) remove(txid string) {
+	for _, input := range t.pending[txid].inputs {
+		if t.spent[input] == txid {
+			delete(t.spent, input)
+		}
+	}
+	delete(t.pending, txid)
+}
+
+// blockChanged queues a block connected to or disconnected from the best
+// chain. It does not block, as notification handlers must not.
+func (t *depositTracker) blockChanged(hash *chainhash.Hash, height int32, connected bool) {
+	select {
+	case t.blocks <- blockEvent{hash: *hash, height: height, connected: connected}:
+	default:
+		slog.Warn("too many blocks queued for the deposits collector, dropping one", "hash", hash, "height", height)
+	}
+}
+
+// run looks at the queued blocks until stop is closed.
+func (t *depositTracker) run(stop <-chan struct{}) {
+	for {
+		select {
+		case block := <-t.blocks:
+			if block.connected {
+				t.blockConnected(block.hash, block.height)
+			} else {
+				t.blockDisconnected(block.height)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// blockConnected marks the pending transactions included in the block,
+// counts the transactions of the block conflicting with pending ones and
+// records the latency of those confirmed enough at its height. The blocks
+// whose transactions could not be fetched before are tried again first.
+func (t *depositTracker) blockConnected(hash chainhash.Hash, height int32) {
+	t.mtx.Lock()
+	unconfirmed := 0
+	for _, deposit := range t.pending {
+		if deposit.height == 0 {
+			unconfirmed++
+		}
+	}
+	t.mtx.Unlock()
+	blocks := append(t.missed, blockEvent{hash: hash, height: height, connected: true})
+	t.missed = nil
+	if unconfirmed == 0 {
+		blocks = nil
+	}
+	for _, block := range blocks {
+		// The call is bounded by the RPCTimeout of the client.
+		txs, err := t.blockTxs(context.Background(), &block.hash)
+		if err != nil {
+			slog.Warn("error getting the transactions of a block for the deposits collector, trying again with the next block", "hash", block.hash, "err", err)
+			t.missed = append(t.missed, block)
+			continue
+		}
+		t.mtx.Lock()
+		for i := range txs {
+			t.accept(&txs[i], block.height)
+		}
+		t.mtx.Unlock()
+	}
+	if len(t.missed) > depositMissedBlocks {
+		slog.Warn("too many blocks missed by the deposits collector, giving up the oldest", "blocks", len(t.missed)-depositMissedBlocks)
+		t.missed = t.missed[len(t.missed)-depositMissedBlocks:]
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	now := t.now()
+	for txid, deposit := range t.pending {
+		switch {
+		case deposit.height > 0 && height-deposit.height+1 >= t.confirmations:
+			for _, address := range deposit.addresses {
+				h, ok := t.latencies[address]
+				if !ok {
+					h = newLatencyHistogram()
+					t.latencies[address] = h
+				}
+				h.observe(now.Sub(deposit.firstSeen).Seconds())
+			}
+			t.remove(txid)
+		case now.Sub(deposit.firstSeen) > depositExpiry:
+			t.remove(txid)
+		}
+	}
+}
+
+// blockDisconnected returns the transactions of a block removed from the best
+// chain by a reorganization to the mempool, until they are included again.
+func (t *depositTracker) blockDisconnected(height int32) {
+	missed := t.missed[:0]
+	for _, block := range t.missed {
+		if block.height < height {
+			missed = append(missed, block)
+		}
+	}
+	t.missed = missed
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, deposit := range t.pending {
+		if deposit.height >= height {
+			deposit.height = 0
+		}
+	}
+}
+
+// snapshot returns a copy of the latency histograms, the number of pending
+// transactions and the conflict counts of the watched addresses.
+func (t *depositTracker) snapshot() (map[string]*latencyHistogram, map[string]int, map[string]map[string]uint64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	latencies := make(map[string]*latencyHistogram, len(t.latencies))
+	for address, h := range t.latencies {
+		c := *h
+		c.buckets = append([]uint64(nil), h.buckets...)
+		latencies[address] = &c
+	}
+	pending := make(map[string]int)
+	for _, deposit := range t.pending {
+		for _, address := range deposit.addresses {
+			pending[address]++
+		}
+	}
+	conflicts := make(map[string]map[string]uint64, len(t.conflicts))
+	for address, kinds := range t.conflicts {
+		conflicts[address] = make(map[string]uint64, len(kinds))
+		for kind, n := range kinds {
+			conflicts[address][kind] = n
+		}
+	}
+	return latencies, pending, conflicts
+}
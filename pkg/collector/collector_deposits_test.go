@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/atk-works/btcd_exporter/internal/btcdtest"
+)
+
+func TestDepositsCollector(t *testing.T) {
+	const txid = "0000000000000000000000000000000000000000000000000000000000000abc"
+	server := btcdtest.NewServer(t)
+	server.SetResult("getblock", btcjson.GetBlockVerboseResult{RawTx: []btcjson.TxRawResult{{Txid: txid}}})
+	client := newTestClient(t, serverConfig(server), false)
+	config := enabled("deposits")
+	config.Addresses = []WatchedAddress{{Address: genesisAddress, Labels: map[string]string{"purpose": "hot"}}}
+	config.Deposits.Confirmations = 2
+	exporter := newTestExporter(t, client, config)
+
+	// waitPending waits until the exporter reports n pending deposits.
+	waitPending := func(n int) {
+		t.Helper()
+		expected := fmt.Sprintf(`
+# HELP btcd_deposit_pending How many transactions paying to a watched address are in the mempool or not confirmed enough yet.
+# TYPE btcd_deposit_pending gauge
+btcd_deposit_pending{address=%q,purpose="hot"} %d
+`, genesisAddress, n)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			err := compare(exporter, strings.NewReader(expected), "btcd_deposit_pending")
+			if err == nil {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Calls("notifyblocks") == 0 || server.Calls("notifynewtransactions") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no subscription to notifications")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server.Notify("txacceptedverbose", btcjson.TxRawResult{
+		Txid: txid,
+		Vout: []btcjson.Vout{{Value: 1, ScriptPubKey: btcjson.ScriptPubKeyResult{Address: genesisAddress}}},
+	})
+	// Transactions to other addresses are ignored.
+	server.Notify("txacceptedverbose", btcjson.TxRawResult{
+		Txid: "0000000000000000000000000000000000000000000000000000000000000def",
+		Vout: []btcjson.Vout{{Value: 1, ScriptPubKey: btcjson.ScriptPubKeyResult{Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}}},
+	})
+	waitPending(1)
+
+	// The first confirmation is not enough.
+	server.Notify("blockconnected", chainhash.Hash{2}.String(), btcdtest.Height+1, btcdtest.BestBlockTime.Unix())
+	for server.Calls("getblock") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("transactions of the connected block not requested")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitPending(1)
+
+	server.Notify("blockconnected", chainhash.Hash{3}.String(), btcdtest.Height+2, btcdtest.BestBlockTime.Unix())
+	waitPending(0)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "btcd_deposit_confirmation_latency_seconds" {
+			continue
+		}
+		h := family.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 1 || h.GetSampleSum() <= 0 {
+			t.Errorf("got %d deposits confirmed in %vs, want 1", h.GetSampleCount(), h.GetSampleSum())
+		}
+		return
+	}
+	t.Error("no latency histogram")
+}
+
+func TestDepositConflicts(t *testing.T) {
+	// payment returns a transaction spending input and paying amount to the
+	// genesis address.
+	payment := func(txid, input string, amount float64) *btcjson.TxRawResult {
+		return &btcjson.TxRawResult{
+			Txid: txid,
+			Vin:  []btcjson.Vin{{Txid: input, Vout: 1}},
+			Vout: []btcjson.Vout{{Value: amount, ScriptPubKey: btcjson.ScriptPubKeyResult{Address: genesisAddress}}},
+		}
+	}
+	var block []btcjson.TxRawResult
+	tracker := newDepositTracker(nil)
+	tracker.blockTxs = func(context.Context, *chainhash.Hash) ([]btcjson.TxRawResult, error) {
+		return block, nil
+	}
+	tracker.watch([]string{genesisAddress}, 1)
+
+	tracker.txAccepted(payment("a1", "in1", 1))
+	// A fee bump pays as much, the replacement paying less replaces it.
+	tracker.txAccepted(payment("a2", "in1", 1))
+	tracker.txAccepted(payment("a3", "in1", 0.5))
+	tracker.txAccepted(payment("b1", "in2", 1))
+	// A transaction paying elsewhere is confirmed instead.
+	block = []btcjson.TxRawResult{{Txid: "b2", Vin: []btcjson.Vin{{Txid: "in2", Vout: 1}}}}
+	tracker.blockConnected(chainhash.Hash{2}, 2)
+
+	_, pending, conflicts := tracker.snapshot()
+	if pending[genesisAddress] != 1 {
+		t.Errorf("got %d pending deposits, want 1", pending[genesisAddress])
+	}
+	expected := map[string]uint64{"fee_bump": 1, "replacement": 1, "double_spend": 1}
+	if !reflect.DeepEqual(conflicts[genesisAddress], expected) {
+		t.Errorf("got conflicts %v, want %v", conflicts[genesisAddress], expected)
+	}
+	if len(tracker.spent) != 1 || tracker.spent["in1:1"] != "a3" {
+		t.Errorf("got spent outpoints %v, want in1:1 of a3", tracker.spent)
+	}
+}
+
+func TestDepositMissedBlock(t *testing.T) {
+	deposit := &btcjson.TxRawResult{
+		Txid: "a1",
+		Vout: []btcjson.Vout{{Value: 1, ScriptPubKey: btcjson.ScriptPubKeyResult{Address: genesisAddress}}},
+	}
+	blocks := map[chainhash.Hash][]btcjson.TxRawResult{{2}: {*deposit}}
+	failing := map[chainhash.Hash]bool{{2}: true}
+	var fetched []chainhash.Hash
+	tracker := newDepositTracker(nil)
+	tracker.blockTxs = func(_ context.Context, hash *chainhash.Hash) ([]btcjson.TxRawResult, error) {
+		fetched = append(fetched, *hash)
+		if failing[*hash] {
+			return nil, errors.New("node unavailable")
+		}
+		return blocks[*hash], nil
+	}
+	tracker.watch([]string{genesisAddress}, 2)
+	tracker.txAccepted(deposit)
+
+	// The block including the deposit cannot be fetched.
+	tracker.blockConnected(chainhash.Hash{2}, 2)
+	if _, pending, _ := tracker.snapshot(); pending[genesisAddress] != 1 {
+		t.Fatalf("got %d pending deposits, want 1", pending[genesisAddress])
+	}
+
+	// It is fetched again with the next block, which confirms the deposit
+	// twice.
+	failing[chainhash.Hash{2}] = false
+	tracker.blockConnected(chainhash.Hash{3}, 3)
+	if want := []chainhash.Hash{{2}, {2}, {3}}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("got blocks fetched %v, want %v", fetched, want)
+	}
+	latencies, pending, _ := tracker.snapshot()
+	if pending[genesisAddress] != 0 {
+		t.Errorf("got %d pending deposits, want 0", pending[genesisAddress])
+	}
+	if h := latencies[genesisAddress]; h == nil || h.count != 1 {
+		t.Errorf("got latencies %v, want a confirmed deposit", h)
+	}
+	if len(tracker.missed) != 0 {
+		t.Errorf("got missed blocks %v, want none", tracker.missed)
+	}
+
+	// A missed block disconnected from the best chain is not fetched again.
+	tracker.txAccepted(&btcjson.TxRawResult{Txid: "a2", Vout: deposit.Vout})
+	failing[chainhash.Hash{4}] = true
+	tracker.blockConnected(chainhash.Hash{4}, 4)
+	tracker.blockDisconnected(4)
+	if len(tracker.missed) != 0 {
+		t.Errorf("got missed blocks %v after a reorganization, want none", tracker.missed)
+	}
+}
+
+func TestDepositsCollectorHTTPPostMode(t *testing.T) {
+	server := btcdtest.NewServer(t)
+	config := serverConfig(server)
+	config.Mode = RPCModeHTTP
+	client := newTestClient(t, config, false)
+	if _, err := NewExporter(client, enabled("deposits"), DefaultOptions()); err == nil {
+		t.Error("deposits collector created without websocket")
+	}
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// diskDirectoryDepth is how deep the sizes of the directories of the data
+// directory are broken down, deep enough for the network directories of
+// btcd, mainnet/blocks_ffldb, as for blocks/index of Bitcoin Core.
+const diskDirectoryDepth = 2
+
+type diskCollector struct {
+	dataDir string
+	// statfs returns the size of the filesystem holding a path and the
+	// space available on it, replaced by tests.
+	statfs func(path string) (size, avail uint64, err error)
+
+	dataDirSize    *prometheus.Desc
+	directorySize  *prometheus.Desc
+	filesystemSize *prometheus.Desc
+	filesystemFree *prometheus.Desc
+}
+
+func init() {
+	registerCollector("disk", false, newDiskCollector)
+}
+
+func newDiskCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	if config.Disk.DataDir == "" {
+		return nil, errors.New("the disk collector needs the data directory of the node, disk.data_dir")
+	}
+	return &diskCollector{
+		dataDir: config.Disk.DataDir,
+		statfs:  statFilesystem,
+		dataDirSize: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "disk", "data_dir_bytes"),
+			"Total size of the files in the data directory of the node in bytes.",
+			nil, nil,
+		),
+		directorySize: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "disk", "directory_bytes"),
+			"Total size of the files in a directory of the data directory of the node in bytes.",
+			[]string{"directory"}, nil,
+		),
+		filesystemSize: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "disk", "filesystem_size_bytes"),
+			"Size of the filesystem holding the data directory of the node in bytes.",
+			nil, nil,
+		),
+		filesystemFree: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "disk", "filesystem_avail_bytes"),
+			"Space available to the node on the filesystem holding its data directory in bytes.",
+			nil, nil,
+		),
+	}, nil
+}
+
+func (c *diskCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	fsSize, fsAvail, err := c.statfs(c.dataDir)
+	if err != nil {
+		return err
+	}
+	// The filesystem is reported even if walking the directory fails.
+	ch <- prometheus.MustNewConstMetric(c.filesystemSize, prometheus.GaugeValue, float64(fsSize))
+	ch <- prometheus.MustNewConstMetric(c.filesystemFree, prometheus.GaugeValue, float64(fsAvail))
+	var total int64
+	directories := make(map[string]int64)
+	err = filepath.WalkDir(c.dataDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// The node deletes files while they are counted.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(c.dataDir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if entry.IsDir() {
+			// Empty directories are reported too.
+			if rel != "." && len(parts) <= diskDirectoryDepth {
+				if _, ok := directories[filepath.ToSlash(rel)]; !ok {
+					directories[filepath.ToSlash(rel)] = 0
+				}
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		total += info.Size()
+		for i := 1; i < len(parts) && i <= diskDirectoryDepth; i++ {
+			directories[strings.Join(parts[:i], "/")] += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.dataDirSize, prometheus.GaugeValue, float64(total))
+	for directory, size := range directories {
+		ch <- prometheus.MustNewConstMetric(c.directorySize, prometheus.GaugeValue, float64(size), directory)
+	}
+	return nil
+}
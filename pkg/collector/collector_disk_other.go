@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package collector
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// statFilesystem is only implemented on Linux and macOS.
+func statFilesystem(path string) (size, avail uint64, err error) {
+	return 0, 0, fmt.Errorf("filesystem statistics are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package collector
+
+import "syscall"
+
+// statFilesystem returns the size of the filesystem holding path and the
+// space available on it to unprivileged users, in bytes.
+func statFilesystem(path string) (size, avail uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.Blocks * uint64(stat.Bsize), stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,349 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// logPollInterval is how often the log file is read for new lines.
+	logPollInterval = time.Second
+	// maxLogLine is the length beyond which a line is skipped, so that a
+	// garbled log does not grow the buffer of a partial line forever.
+	maxLogLine = 64 * 1024
+)
+
+var (
+	// logLineRegexp matches the lines written by btcd,
+	// "2006-01-02 15:04:05.000 [WRN] PEER: message".
+	logLineRegexp = regexp.MustCompile(`^\S+ \S+ \[([A-Z]{3})\] ([A-Z]+): (.*)$`)
+	// logLevels are the levels counted, by their tag in the log.
+	logLevels = map[string]string{
+		"WRN": "warning",
+		"ERR": "error",
+		"CRT": "critical",
+	}
+	// defaultLogCategories match the messages of btcd worth acting upon,
+	// whatever their level.
+	defaultLogCategories = map[string]string{
+		"misbehaving_peer":    `^Misbehaving peer`,
+		"banned_peer":         `^Banned peer`,
+		"rejected_block":      `^(Rejected|Failed to process) block`,
+		"database_corruption": `Database corruption detected`,
+	}
+
+	// The log files are tailed for as long as the exporter runs, not only
+	// as long as a configuration, so that reloading it does not lose the
+	// lines written in the meantime. Tailers are kept by path until pruned.
+	logTailersMtx sync.Mutex
+	logTailers    = make(map[string]*logTailer)
+)
+
+type logCollector struct {
+	tailer     *logTailer
+	categories []string
+	messages   *prometheus.Desc
+	events     *prometheus.Desc
+}
+
+func init() {
+	registerCollector("log", false, newLogCollector)
+}
+
+func newLogCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	if config.Log.File == "" {
+		return nil, errors.New("the log collector needs the log file of the node, log.file")
+	}
+	categories, err := config.Log.compileCategories()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tailer := sharedLogTailer(config.Log.File, categories)
+	return &logCollector{
+		tailer:     tailer,
+		categories: names,
+		messages: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "log", "messages_total"),
+			"How many warning, error and critical messages the node logged since the exporter started, by subsystem.",
+			[]string{"level", "subsystem"}, nil,
+		),
+		events: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "log", "events_total"),
+			"How many messages of a category the node logged since the exporter started.",
+			[]string{"category"}, nil,
+		),
+	}, nil
+}
+
+func (c *logCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	messages, events, err := c.tailer.snapshot()
+	for key, n := range messages {
+		ch <- prometheus.MustNewConstMetric(c.messages, prometheus.CounterValue, float64(n), key.level, key.subsystem)
+	}
+	for _, category := range c.categories {
+		ch <- prometheus.MustNewConstMetric(c.events, prometheus.CounterValue, float64(events[category]), category)
+	}
+	return err
+}
+
+// compileCategories returns the default categories of log messages along
+// with the configured ones, which replace defaults of the same name.
+func (c *LogConfig) compileCategories() (map[string]*regexp.Regexp, error) {
+	categories := make(map[string]*regexp.Regexp, len(defaultLogCategories)+len(c.Categories))
+	for name, pattern := range defaultLogCategories {
+		categories[name] = regexp.MustCompile(pattern)
+	}
+	for name, pattern := range c.Categories {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of log category %s: %w", name, err)
+		}
+		categories[name] = re
+	}
+	return categories, nil
+}
+
+// sharedLogTailer returns the tailer of the log file at path, starting it on
+// first use with categories. The categories of a running tailer are left
+// alone, they only change with the configuration in use, see UseLogConfigs.
+func sharedLogTailer(path string, categories map[string]*regexp.Regexp) *logTailer {
+	logTailersMtx.Lock()
+	defer logTailersMtx.Unlock()
+	if tailer, ok := logTailers[path]; ok {
+		return tailer
+	}
+	tailer := newLogTailer(path)
+	tailer.setCategories(categories)
+	go tailer.run(logPollInterval)
+	logTailers[path] = tailer
+	return tailer
+}
+
+// UseLogConfigs is called once the configuration with the log settings
+// configs, those of every node, is in use. It stops tailing the log files
+// other than theirs, none stopping them all, and matches the messages of each
+// file against the categories of its settings from then on.
+func UseLogConfigs(configs []LogConfig) {
+	byFile := make(map[string]LogConfig, len(configs))
+	for _, config := range configs {
+		byFile[config.File] = config
+	}
+	logTailersMtx.Lock()
+	defer logTailersMtx.Unlock()
+	for path, tailer := range logTailers {
+		config, ok := byFile[path]
+		if !ok {
+			tailer.stop()
+			delete(logTailers, path)
+			continue
+		}
+		// The configuration was validated before being used.
+		if categories, err := config.compileCategories(); err == nil {
+			tailer.setCategories(categories)
+		}
+	}
+}
+
+// logKey identifies the messages of a level and subsystem.
+type logKey struct {
+	level     string
+	subsystem string
+}
+
+// logTailer follows a log file, counting the lines written to it after it
+// started. It follows the file across rotations and truncations.
+type logTailer struct {
+	path     string
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// file, partial, truncated and fromStart belong to the goroutine
+	// running run.
+	file *os.File
+	// partial is the end of the file not terminated by a newline yet.
+	partial []byte
+	// truncated is set while the rest of a line longer than maxLogLine is
+	// skipped.
+	truncated bool
+	// fromStart is set once the initial content of the file was skipped,
+	// so that files appearing later are read from their start.
+	fromStart bool
+
+	mtx        sync.Mutex
+	categories map[string]*regexp.Regexp
+	messages   map[logKey]uint64
+	events     map[string]uint64
+	err        error
+}
+
+func newLogTailer(path string) *logTailer {
+	return &logTailer{
+		path:     path,
+		done:     make(chan struct{}),
+		messages: make(map[logKey]uint64),
+		events:   make(map[string]uint64),
+	}
+}
+
+func (t *logTailer) setCategories(categories map[string]*regexp.Regexp) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.categories = categories
+}
+
+// run reads the new lines of the file every interval until stopped.
+func (t *logTailer) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := t.poll()
+		t.mtx.Lock()
+		t.err = err
+		t.mtx.Unlock()
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			if t.file != nil {
+				t.file.Close()
+			}
+			return
+		}
+	}
+}
+
+func (t *logTailer) stop() {
+	t.doneOnce.Do(func() {
+		close(t.done)
+	})
+}
+
+// poll reads the lines written since the last poll, then checks whether the
+// file was rotated or truncated.
+func (t *logTailer) poll() error {
+	if t.file == nil {
+		file, err := os.Open(t.path)
+		fromStart := t.fromStart
+		t.fromStart = true
+		if err != nil {
+			return err
+		}
+		if !fromStart {
+			if _, err := file.Seek(0, io.SeekEnd); err != nil {
+				file.Close()
+				return err
+			}
+		}
+		t.file = file
+	}
+	if err := t.read(); err != nil {
+		return err
+	}
+	current, err := os.Stat(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Rotated, the new file is not created yet.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	opened, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	offset, err := t.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !os.SameFile(current, opened):
+		t.file.Close()
+		t.file, t.partial, t.truncated = nil, nil, false
+		return t.poll()
+	case current.Size() < offset:
+		t.partial, t.truncated = nil, false
+		_, err := t.file.Seek(0, io.SeekStart)
+		return err
+	}
+	return nil
+}
+
+// read counts the complete lines up to the end of the file.
+func (t *logTailer) read() error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := t.file.Read(buf)
+		data := buf[:n]
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			if !t.truncated {
+				t.partial = append(t.partial, data[:i]...)
+				t.count(string(t.partial))
+			}
+			t.partial, t.truncated, data = t.partial[:0], false, data[i+1:]
+		}
+		switch {
+		case t.truncated:
+		case len(t.partial)+len(data) <= maxLogLine:
+			t.partial = append(t.partial, data...)
+		default:
+			// The line is too long, the rest of it is skipped too.
+			t.partial, t.truncated = t.partial[:0], true
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// count records a line of the log.
+func (t *logTailer) count(line string) {
+	match := logLineRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if level, ok := logLevels[match[1]]; ok {
+		t.messages[logKey{level: level, subsystem: match[2]}]++
+	}
+	for name, re := range t.categories {
+		if re.MatchString(match[3]) {
+			t.events[name]++
+		}
+	}
+}
+
+// snapshot returns a copy of the counts of messages and events, and the error
+// of the last poll of the file.
+func (t *logTailer) snapshot() (map[logKey]uint64, map[string]uint64, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	messages := make(map[logKey]uint64, len(t.messages))
+	for key, n := range t.messages {
+		messages[key] = n
+	}
+	events := make(map[string]uint64, len(t.events))
+	for name, n := range t.events {
+		events[name] = n
+	}
+	return messages, events, t.err
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "btcd.log")
+	write := func(flag int, lines string) {
+		t.Helper()
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(lines); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := LogConfig{Categories: map[string]string{"orphan": `^Adding orphan block`}}
+	categories, err := config.compileCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailer := newLogTailer(path)
+	tailer.setCategories(categories)
+	poll := func() {
+		t.Helper()
+		if err := tailer.poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The lines written before the tailer started are skipped.
+	write(os.O_TRUNC, "2024-01-02 15:04:05.000 [ERR] BCDB: before\n")
+	poll()
+	write(os.O_APPEND, "2024-01-02 15:04:05.000 [WRN] PEER: Misbehaving peer 203.0.113.1:8333 (inbound): ban score increased to 20\n"+
+		"2024-01-02 15:04:05.000 [INF] SYNC: Rejected block 000000 from 203.0.113.1:8333 (inbound): bad merkle root\n"+
+		"2024-01-02 15:04:05.000 [INF] CHAN: Adding orphan block 000000 with parent 000000\n"+
+		"not a line of btcd\n"+
+		"2024-01-02 15:04:05.000 [ERR] BCDB: ***Database corruption detected***: ")
+	poll()
+	// The incomplete line is counted once terminated.
+	write(os.O_APPEND, "missing block\n")
+	poll()
+	// A line too long is skipped whole, even once terminated.
+	write(os.O_APPEND, "2024-01-02 15:04:05.000 [ERR] BCDB: ")
+	poll()
+	write(os.O_APPEND, strings.Repeat("x", maxLogLine))
+	poll()
+	write(os.O_APPEND, "***Database corruption detected***\n")
+	poll()
+	// Rotated to another file, then truncated.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(os.O_TRUNC, "2024-01-02 15:04:05.000 [WRN] PEER: Misbehaving peer 203.0.113.2:8333 (inbound): ban score increased to 40\n")
+	poll()
+	write(os.O_TRUNC, "2024-01-02 15:04:05.000 [CRT] BTCD: truncated\n")
+	poll()
+	poll()
+
+	messages, events, err := tailer.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMessages := map[logKey]uint64{
+		{level: "warning", subsystem: "PEER"}:  2,
+		{level: "error", subsystem: "BCDB"}:    1,
+		{level: "critical", subsystem: "BTCD"}: 1,
+	}
+	if !reflect.DeepEqual(messages, expectedMessages) {
+		t.Errorf("got messages %v, want %v", messages, expectedMessages)
+	}
+	expectedEvents := map[string]uint64{
+		"misbehaving_peer":    2,
+		"rejected_block":      1,
+		"database_corruption": 1,
+		"orphan":              1,
+	}
+	if !reflect.DeepEqual(events, expectedEvents) {
+		t.Errorf("got events %v, want %v", events, expectedEvents)
+	}
+}
+
+func TestLogCollectorConfig(t *testing.T) {
+	if _, err := NewExporter(newFakeNode(), enabled("log"), DefaultOptions()); err == nil {
+		t.Error("log collector created without a log file")
+	}
+	config := enabled("log")
+	config.Log.Categories = map[string]string{"broken": "("}
+	if err := config.Validate(); err == nil {
+		t.Error("invalid category pattern accepted")
+	}
+}
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type mempoolCollector struct {
+	client       RPC
+	transactions *prometheus.Desc
+	bytes        *prometheus.Desc
+}
+
+func init() {
+	registerCollector("mempool", false, newMempoolCollector)
+}
+
+func newMempoolCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	return &mempoolCollector{
+		client: client,
+		transactions: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mempool", "transactions"),
+			"How many transactions are in the mempool reported by btcd getmempoolinfo.",
+			nil, nil,
+		),
+		bytes: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mempool", "bytes"),
+			"Size of the mempool in bytes reported by btcd getmempoolinfo.",
+			nil, nil,
+		),
+	}, nil
+}
+
+func (c *mempoolCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	mempoolInfo, err := c.client.GetMempoolInfo(ctx)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.transactions, prometheus.GaugeValue, float64(mempoolInfo.Size))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(mempoolInfo.Bytes))
+	return nil
+}
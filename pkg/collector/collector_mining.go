@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type miningCollector struct {
+	client             RPC
+	networkHashRate    *prometheus.Desc
+	pooledTransactions *prometheus.Desc
+	currentBlockSize   *prometheus.Desc
+	currentBlockTx     *prometheus.Desc
+	// The CPU miner metrics are nil for nodes without the CPU miner of
+	// btcd.
+	generate     *prometheus.Desc
+	hashesPerSec *prometheus.Desc
+	workers      *prometheus.Desc
+}
+
+func init() {
+	registerCollector("mining", false, newMiningCollector)
+}
+
+func newMiningCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	c := &miningCollector{
+		client: client,
+		networkHashRate: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mining", "network_hashes_per_second"),
+			"Estimated network hash rate reported by btcd getmininginfo.",
+			nil, nil,
+		),
+		pooledTransactions: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mining", "pooled_transactions"),
+			"How many transactions are pooled for the next block reported by btcd getmininginfo.",
+			nil, nil,
+		),
+		currentBlockSize: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mining", "current_block_bytes"),
+			"Size of the last generated block template in bytes reported by btcd getmininginfo.",
+			nil, nil,
+		),
+		currentBlockTx: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mining", "current_block_transactions"),
+			"How many transactions are in the last generated block template reported by btcd getmininginfo.",
+			nil, nil,
+		),
+	}
+	if client.Backend() == BackendBtcd {
+		c.generate = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mining", "generate"),
+			"Whether the CPU miner of btcd is generating blocks.",
+			nil, nil,
+		)
+		c.hashesPerSec = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mining", "hashes_per_second"),
+			"Hash rate of the CPU miner of btcd.",
+			nil, nil,
+		)
+		c.workers = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "mining", "workers"),
+			"How many workers the CPU miner of btcd runs while generating.",
+			nil, nil,
+		)
+	}
+	return c, nil
+}
+
+func (c *miningCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	miningInfo, err := c.client.GetMiningInfo(ctx)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.networkHashRate, prometheus.GaugeValue, miningInfo.NetworkHashPS)
+	ch <- prometheus.MustNewConstMetric(c.pooledTransactions, prometheus.GaugeValue, float64(miningInfo.PooledTx))
+	ch <- prometheus.MustNewConstMetric(c.currentBlockSize, prometheus.GaugeValue, float64(miningInfo.CurrentBlockSize))
+	ch <- prometheus.MustNewConstMetric(c.currentBlockTx, prometheus.GaugeValue, float64(miningInfo.CurrentBlockTx))
+	if c.generate != nil {
+		generate := 0.0
+		if miningInfo.Generate {
+			generate = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.generate, prometheus.GaugeValue, generate)
+		ch <- prometheus.MustNewConstMetric(c.hashesPerSec, prometheus.GaugeValue, miningInfo.HashesPerSec)
+		ch <- prometheus.MustNewConstMetric(c.workers, prometheus.GaugeValue, float64(miningInfo.GenProcLimit))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type networkCollector struct {
+	client        RPC
+	peers         *prometheus.Desc
+	bytesSent     *prometheus.Desc
+	bytesReceived *prometheus.Desc
+	// legacySent and legacyReceived are only set with LegacyMetrics.
+	legacySent     *prometheus.Desc
+	legacyReceived *prometheus.Desc
+}
+
+func init() {
+	registerCollector("network", true, newNetworkCollector)
+}
+
+func newNetworkCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	c := &networkCollector{
+		client: client,
+		peers: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "peers"),
+			"How many peers are connected to the node.",
+			nil, nil,
+		),
+		bytesSent: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "network", "sent_bytes_total"),
+			"How many bytes have been sent reported by btcd getnettotals.",
+			nil, nil,
+		),
+		bytesReceived: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "network", "received_bytes_total"),
+			"How many bytes have been received reported by btcd getnettotals.",
+			nil, nil,
+		),
+	}
+	if opts.LegacyMetrics {
+		c.legacySent = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "sent_bytes"),
+			"How many bytes have been sent reported by btcd getnettotals. Deprecated, use network_sent_bytes_total.",
+			nil, nil,
+		)
+		c.legacyReceived = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "", "received_bytes"),
+			"How many bytes have been received reported by btcd getnettotals. Deprecated, use network_received_bytes_total.",
+			nil, nil,
+		)
+	}
+	return c, nil
+}
+
+func (c *networkCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	connections, err := c.client.ConnectionCount(ctx)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.peers, prometheus.GaugeValue, float64(connections))
+	netTotals, err := c.client.GetNetTotals(ctx)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.bytesSent, prometheus.CounterValue, float64(netTotals.TotalBytesSent))
+	ch <- prometheus.MustNewConstMetric(c.bytesReceived, prometheus.CounterValue, float64(netTotals.TotalBytesRecv))
+	if c.legacySent != nil {
+		ch <- prometheus.MustNewConstMetric(c.legacySent, prometheus.CounterValue, float64(netTotals.TotalBytesSent))
+		ch <- prometheus.MustNewConstMetric(c.legacyReceived, prometheus.GaugeValue, float64(netTotals.TotalBytesRecv))
+	}
+	return nil
+}
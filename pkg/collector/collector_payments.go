@@ -0,0 +1,343 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type paymentsCollector struct {
+	tracker   *paymentTracker
+	addresses []string
+	labels    [][]string
+	payments  *prometheus.Desc
+	received  *prometheus.Desc
+	// rescanHeight and rescanFinished are nil when no rescan is configured.
+	rescanHeight   *prometheus.Desc
+	rescanFinished *prometheus.Desc
+}
+
+func init() {
+	registerCollector("payments", false, newPaymentsCollector)
+}
+
+func newPaymentsCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	c, ok := client.(*Client)
+	if !ok || c.HTTPPostMode() {
+		return nil, errors.New("the payments collector needs the websocket connection of btcd, rpc mode ws")
+	}
+	decoded, err := config.WatchedAddresses()
+	if err != nil {
+		return nil, err
+	}
+	tracker := c.paymentTracker()
+	if err := tracker.watch(decoded, config.Payments.RescanFromHeight); err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(decoded))
+	for i, address := range decoded {
+		addresses[i] = address.EncodeAddress()
+	}
+	names, labels := addressLabels(config.Addresses)
+	variableLabels := append([]string{"address"}, names...)
+	collector := &paymentsCollector{
+		tracker:   tracker,
+		addresses: addresses,
+		labels:    labels,
+		payments: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "payments", "received_total"),
+			"How many transactions paying to a watched address btcd notified since the exporter connected.",
+			variableLabels, nil,
+		),
+		received: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "payments", "received_btc_total"),
+			"Amount paid to a watched address by the transactions btcd notified since the exporter connected in BTC.",
+			variableLabels, nil,
+		),
+	}
+	if config.Payments.RescanFromHeight > 0 {
+		collector.rescanHeight = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "payments", "rescan_height"),
+			"Height of the last block btcd rescanned for payments to the watched addresses.",
+			nil, nil,
+		)
+		collector.rescanFinished = prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "payments", "rescan_finished"),
+			"Whether btcd finished rescanning the chain for payments to the watched addresses.",
+			nil, nil,
+		)
+	}
+	return collector, nil
+}
+
+func (c *paymentsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	received, rescan := c.tracker.snapshot()
+	for i, address := range c.addresses {
+		labels := append([]string{address}, c.labels[i]...)
+		r := received[address]
+		payments := prometheus.MustNewConstMetric(c.payments, prometheus.CounterValue, float64(r.payments), labels...)
+		amount := prometheus.MustNewConstMetric(c.received, prometheus.CounterValue, r.amount.ToBTC(), labels...)
+		if r.latestTxid != "" {
+			// The latest payment is attached as an exemplar, so that a
+			// data point can be linked to a block explorer.
+			txid := prometheus.Labels{"txid": r.latestTxid}
+			payments = prometheus.MustNewMetricWithExemplars(payments, prometheus.Exemplar{
+				Value: 1, Labels: txid, Timestamp: r.latestTime,
+			})
+			amount = prometheus.MustNewMetricWithExemplars(amount, prometheus.Exemplar{
+				Value: r.latestAmount.ToBTC(), Labels: txid, Timestamp: r.latestTime,
+			})
+		}
+		ch <- payments
+		ch <- amount
+	}
+	if c.rescanHeight != nil {
+		finished := 0.0
+		if rescan.finished {
+			finished = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.rescanHeight, prometheus.GaugeValue, float64(rescan.height))
+		ch <- prometheus.MustNewConstMetric(c.rescanFinished, prometheus.GaugeValue, finished)
+	}
+	return rescan.err
+}
+
+// addressReceived is what an address received.
+type addressReceived struct {
+	payments uint64
+	amount   btcutil.Amount
+	// latestTxid is the transaction last counted, which paid latestAmount
+	// to the address and was counted at latestTime.
+	latestTxid   string
+	latestAmount btcutil.Amount
+	latestTime   time.Time
+}
+
+// rescanState is the progress of the rescan of the chain for payments.
+type rescanState struct {
+	// from is the height the rescan starts at, 0 for no rescan.
+	from     int32
+	running  bool
+	height   int32
+	finished bool
+	err      error
+}
+
+// paymentTracker counts the payments to watched addresses pushed by btcd
+// through a transaction filter, loaded with loadtxfilter: the transactions
+// accepted to its mempool and those of connected blocks paying to the
+// addresses. A transaction is counted once, when first notified. Like the
+// deposit tracker, it lives as long as the client. If configured, it also
+// has btcd rescan the chain from a height for the payments made before the
+// exporter connected, once.
+type paymentTracker struct {
+	client *Client
+	now    func() time.Time
+
+	mtx       sync.Mutex
+	addresses []btcutil.Address
+	// scripts maps the output scripts of the watched addresses to them.
+	scripts map[string]string
+	// seen holds when the transactions counted were first notified, until
+	// they are included in a block or expire.
+	seen     map[chainhash.Hash]time.Time
+	received map[string]addressReceived
+	rescan   rescanState
+}
+
+func newPaymentTracker(client *Client) *paymentTracker {
+	return &paymentTracker{
+		client:   client,
+		now:      time.Now,
+		scripts:  make(map[string]string),
+		seen:     make(map[chainhash.Hash]time.Time),
+		received: make(map[string]addressReceived),
+	}
+}
+
+// paymentTracker returns the payment tracker of the client, starting it on
+// first use.
+func (c *Client) paymentTracker() *paymentTracker {
+	c.paymentsOnce.Do(func() {
+		c.payments.Store(newPaymentTracker(c))
+	})
+	return c.payments.Load()
+}
+
+// watch sets the addresses whose payments are counted and loads them in the
+// transaction filter of the node. A rescanFrom above 0 is the height the chain
+// is rescanned from, unless a rescan already started.
+func (t *paymentTracker) watch(addresses []btcutil.Address, rescanFrom int32) error {
+	scripts := make(map[string]string, len(addresses))
+	for _, address := range addresses {
+		script, err := txscript.PayToAddrScript(address)
+		if err != nil {
+			return err
+		}
+		scripts[string(script)] = address.EncodeAddress()
+	}
+	t.mtx.Lock()
+	t.addresses, t.scripts = addresses, scripts
+	if t.rescan.from == 0 {
+		t.rescan.from = rescanFrom
+	}
+	t.mtx.Unlock()
+	go t.subscribe()
+	return nil
+}
+
+// subscribe loads the transaction filter of the watched addresses and asks
+// for block notifications, which carry the transactions of the blocks
+// passing the filter, then starts the rescan if it is not done yet. It is
+// called again on every reconnection, as neither the filter nor the rescan
+// are restored by rpcclient.
+func (t *paymentTracker) subscribe() {
+	t.mtx.Lock()
+	addresses := t.addresses
+	rescan := t.rescan.from > 0 && !t.rescan.running && !t.rescan.finished
+	t.rescan.running = t.rescan.running || rescan
+	t.mtx.Unlock()
+	if rescan {
+		go t.rescanChain(addresses)
+	}
+	err := t.client.LoadTxFilter(true, addresses, nil)
+	t.client.subscriptions.subscribed(subscriptionTransactionFilter, err)
+	if err != nil {
+		// The client subscribes once connected.
+		slog.Debug("error loading the transaction filter", "err", err)
+		return
+	}
+	err = t.client.NotifyBlocks()
+	t.client.subscriptions.subscribed(subscriptionBlocks, err)
+	if err != nil {
+		slog.Debug("error subscribing to block notifications", "err", err)
+	}
+}
+
+// rescanChain has btcd rescan the chain for the payments to addresses, which
+// it notifies along with its progress. A failed rescan is started again on
+// the next connection.
+func (t *paymentTracker) rescanChain(addresses []btcutil.Address) {
+	t.mtx.Lock()
+	from := t.rescan.from
+	t.mtx.Unlock()
+	ctx, rpc := t.client.rpc(context.Background())
+	start, err := Call(ctx, "getblockhash", func() rpcclient.FutureGetBlockHashResult {
+		return rpc.GetBlockHashAsync(int64(from))
+	})
+	if err == nil {
+		err = t.client.Rescan(start, addresses, nil)
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.rescan.running = false
+	if err != nil {
+		slog.Warn("error rescanning the chain for payments", "from", from, "err", err)
+		t.rescan.err = fmt.Errorf("error rescanning the chain for payments: %w", err)
+		return
+	}
+	t.rescan.err = nil
+}
+
+// rescanProgress records the height of the last block rescanned, finished
+// once the rescan reached the best block.
+func (t *paymentTracker) rescanProgress(height int32, finished bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.rescan.height = height
+	t.rescan.finished = t.rescan.finished || finished
+}
+
+// recvTx counts a transaction paying to a watched address found by the
+// rescan. It is counted as if it came from the mempool, so that it is not
+// counted again when notified in a connected block while the rescan reaches
+// the best block.
+func (t *paymentTracker) recvTx(tx *btcutil.Tx) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.count(tx.MsgTx(), false)
+}
+
+// relevantTxAccepted counts a transaction accepted to the mempool of the
+// node and passing the filter, serialized.
+func (t *paymentTracker) relevantTxAccepted(serialized []byte) {
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(serialized)); err != nil {
+		slog.Warn("error decoding a relevant transaction", "err", err)
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.count(&tx, false)
+}
+
+// filteredBlockConnected counts the transactions of a connected block which
+// passed the filter and were not notified in the mempool.
+func (t *paymentTracker) filteredBlockConnected(txs []*btcutil.Tx) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, tx := range txs {
+		t.count(tx.MsgTx(), true)
+	}
+	now := t.now()
+	for hash, seen := range t.seen {
+		if now.Sub(seen) > depositExpiry {
+			delete(t.seen, hash)
+		}
+	}
+}
+
+// count records the payments of tx to the watched addresses, unless it was
+// counted already. The caller holds t.mtx.
+func (t *paymentTracker) count(tx *wire.MsgTx, confirmed bool) {
+	amounts := make(map[string]btcutil.Amount)
+	for _, out := range tx.TxOut {
+		if address, ok := t.scripts[string(out.PkScript)]; ok {
+			amounts[address] += btcutil.Amount(out.Value)
+		}
+	}
+	if len(amounts) == 0 {
+		return
+	}
+	hash := tx.TxHash()
+	if _, ok := t.seen[hash]; ok {
+		if confirmed {
+			delete(t.seen, hash)
+		}
+		return
+	}
+	if !confirmed {
+		t.seen[hash] = t.now()
+	}
+	now := t.now()
+	for address, amount := range amounts {
+		r := t.received[address]
+		r.payments++
+		r.amount += amount
+		r.latestTxid, r.latestAmount, r.latestTime = hash.String(), amount, now
+		t.received[address] = r
+	}
+}
+
+// snapshot returns a copy of what the watched addresses received, and of the
+// progress of the rescan.
+func (t *paymentTracker) snapshot() (map[string]addressReceived, rescanState) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	received := make(map[string]addressReceived, len(t.received))
+	for address, r := range t.received {
+		received[address] = r
+	}
+	return received, t.rescan
+}
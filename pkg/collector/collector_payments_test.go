@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/atk-works/btcd_exporter/internal/btcdtest"
+)
+
+func TestPaymentsCollector(t *testing.T) {
+	server := btcdtest.NewServer(t)
+	client := newTestClient(t, serverConfig(server), false)
+	config := enabled("payments")
+	config.Addresses = []WatchedAddress{{Address: genesisAddress}}
+	config.Payments.RescanFromHeight = 1
+	exporter := newTestExporter(t, client, config)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Calls("loadtxfilter") == 0 || server.Calls("notifyblocks") == 0 || server.Calls("rescan") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no transaction filter loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	address, err := decodeAddress(genesisAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// payment returns a serialized transaction paying amounts to the
+	// genesis address, distinguished by lockTime.
+	payment := func(lockTime uint32, amounts ...int64) string {
+		tx := wire.NewMsgTx(2)
+		tx.LockTime = lockTime
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+		for _, amount := range amounts {
+			tx.AddTxOut(wire.NewTxOut(amount, script))
+		}
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return hex.EncodeToString(buf.Bytes())
+	}
+	var header bytes.Buffer
+	if err := (&wire.BlockHeader{}).Serialize(&header); err != nil {
+		t.Fatal(err)
+	}
+
+	// A transaction of the mempool is counted once, not again when
+	// confirmed, unlike one first seen in a block.
+	server.Notify("relevanttxaccepted", payment(1, 1e8, 2e7))
+	server.Notify("filteredblockconnected", btcdtest.Height+1, hex.EncodeToString(header.Bytes()), []string{
+		payment(1, 1e8, 2e7), payment(2, 5e7),
+	})
+
+	// The payments found by the rescan are counted along.
+	server.Notify("recvtx", payment(3, 3e7))
+	server.Notify("rescanprogress", btcdtest.BestBlockHash.String(), btcdtest.Height-1, 1231006505)
+	server.Notify("rescanfinished", btcdtest.BestBlockHash.String(), btcdtest.Height, 1231006505)
+
+	expected := fmt.Sprintf(`
+# HELP btcd_payments_received_btc_total Amount paid to a watched address by the transactions btcd notified since the exporter connected in BTC.
+# TYPE btcd_payments_received_btc_total counter
+btcd_payments_received_btc_total{address=%[1]q} 2
+# HELP btcd_payments_received_total How many transactions paying to a watched address btcd notified since the exporter connected.
+# TYPE btcd_payments_received_total counter
+btcd_payments_received_total{address=%[1]q} 3
+# HELP btcd_payments_rescan_finished Whether btcd finished rescanning the chain for payments to the watched addresses.
+# TYPE btcd_payments_rescan_finished gauge
+btcd_payments_rescan_finished 1
+# HELP btcd_payments_rescan_height Height of the last block btcd rescanned for payments to the watched addresses.
+# TYPE btcd_payments_rescan_height gauge
+btcd_payments_rescan_height %[2]d
+`, genesisAddress, btcdtest.Height)
+	for {
+		err := compare(exporter, strings.NewReader(expected), "btcd_payments_received_total", "btcd_payments_received_btc_total",
+			"btcd_payments_rescan_height", "btcd_payments_rescan_finished")
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The payment counted last is attached as an exemplar.
+	raw, err := hex.DecodeString(payment(3, 3e7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var latest wire.MsgTx
+	if err := latest.Deserialize(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exemplars := map[string]float64{"btcd_payments_received_total": 1, "btcd_payments_received_btc_total": 0.3}
+	for _, family := range families {
+		want, ok := exemplars[family.GetName()]
+		if !ok {
+			continue
+		}
+		delete(exemplars, family.GetName())
+		exemplar := family.GetMetric()[0].GetCounter().GetExemplar()
+		if exemplar == nil {
+			t.Errorf("%s has no exemplar", family.GetName())
+			continue
+		}
+		if got := exemplar.GetLabel()[0]; got.GetName() != "txid" || got.GetValue() != latest.TxHash().String() {
+			t.Errorf("got %s exemplar label %s=%s, want txid=%s", family.GetName(), got.GetName(), got.GetValue(), latest.TxHash())
+		}
+		if exemplar.GetValue() != want {
+			t.Errorf("got %s exemplar value %v, want %v", family.GetName(), exemplar.GetValue(), want)
+		}
+	}
+	for name := range exemplars {
+		t.Errorf("%s is missing", name)
+	}
+}
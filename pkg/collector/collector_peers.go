@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type peersCollector struct {
+	client        RPC
+	backend       backend
+	info          *prometheus.Desc
+	bytesSent     *prometheus.Desc
+	bytesReceived *prometheus.Desc
+	pingTime      *prometheus.Desc
+	banScore      *prometheus.Desc
+}
+
+func init() {
+	registerCollector("peers", false, newPeersCollector)
+}
+
+func newPeersCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	backend, err := newBackend(client.Backend())
+	if err != nil {
+		return nil, err
+	}
+	return &peersCollector{
+		client:  client,
+		backend: backend,
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "peer", "info"),
+			"Information about a connected peer reported by btcd getpeerinfo.",
+			[]string{"addr", "subver", "version", "inbound"}, nil,
+		),
+		bytesSent: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "peer", "sent_bytes"),
+			"How many bytes have been sent to a peer reported by btcd getpeerinfo.",
+			[]string{"addr"}, nil,
+		),
+		bytesReceived: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "peer", "received_bytes"),
+			"How many bytes have been received from a peer reported by btcd getpeerinfo.",
+			[]string{"addr"}, nil,
+		),
+		pingTime: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "peer", "ping_seconds"),
+			"Last ping round trip time to a peer reported by btcd getpeerinfo.",
+			[]string{"addr"}, nil,
+		),
+		banScore: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "peer", "ban_score"),
+			"Ban score of a peer reported by btcd getpeerinfo.",
+			[]string{"addr"}, nil,
+		),
+	}, nil
+}
+
+func (c *peersCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	peers, err := c.client.GetPeerInfo(ctx)
+	if err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		ch <- prometheus.MustNewConstMetric(
+			c.info, prometheus.GaugeValue, 1,
+			peer.Addr, peer.SubVer, strconv.FormatUint(uint64(peer.Version), 10), strconv.FormatBool(peer.Inbound),
+		)
+		ch <- prometheus.MustNewConstMetric(c.bytesSent, prometheus.CounterValue, float64(peer.BytesSent), peer.Addr)
+		ch <- prometheus.MustNewConstMetric(c.bytesReceived, prometheus.CounterValue, float64(peer.BytesRecv), peer.Addr)
+		ch <- prometheus.MustNewConstMetric(c.pingTime, prometheus.GaugeValue, c.backend.pingSeconds(peer.PingTime), peer.Addr)
+		ch <- prometheus.MustNewConstMetric(c.banScore, prometheus.GaugeValue, float64(peer.BanScore), peer.Addr)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+// defaultProcFS is where the proc filesystem is mounted, unless configured.
+const defaultProcFS = "/proc"
+
+type processCollector struct {
+	fs      procfs.FS
+	pidFile string
+	name    string
+
+	cpuTime       *prometheus.Desc
+	residentBytes *prometheus.Desc
+	virtualBytes  *prometheus.Desc
+	openFDs       *prometheus.Desc
+	maxFDs        *prometheus.Desc
+	threads       *prometheus.Desc
+	startTime     *prometheus.Desc
+}
+
+func init() {
+	registerCollector("process", false, newProcessCollector)
+}
+
+func newProcessCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	path := config.Process.ProcFS
+	if path == "" {
+		path = defaultProcFS
+	}
+	fs, err := procfs.NewFS(path)
+	if err != nil {
+		return nil, fmt.Errorf("the process collector needs the proc filesystem of Linux: %w", err)
+	}
+	name := config.Process.Name
+	if name == "" {
+		// The backend names the process of its daemon.
+		name = client.Backend()
+	}
+	return &processCollector{
+		fs:      fs,
+		pidFile: config.Process.PIDFile,
+		name:    name,
+		cpuTime: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "process", "cpu_seconds_total"),
+			"Total user and system CPU time spent by the node process in seconds.",
+			nil, nil,
+		),
+		residentBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "process", "resident_memory_bytes"),
+			"Resident memory size of the node process in bytes.",
+			nil, nil,
+		),
+		virtualBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "process", "virtual_memory_bytes"),
+			"Virtual memory size of the node process in bytes.",
+			nil, nil,
+		),
+		openFDs: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "process", "open_fds"),
+			"Number of open file descriptors of the node process.",
+			nil, nil,
+		),
+		maxFDs: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "process", "max_fds"),
+			"Maximum number of open file descriptors of the node process.",
+			nil, nil,
+		),
+		threads: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "process", "threads"),
+			"Number of OS threads of the node process.",
+			nil, nil,
+		),
+		startTime: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "process", "start_time_seconds"),
+			"Start time of the node process since unix epoch in seconds.",
+			nil, nil,
+		),
+	}, nil
+}
+
+func (c *processCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	proc, err := c.find()
+	if err != nil {
+		return err
+	}
+	stat, err := proc.Stat()
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.cpuTime, prometheus.CounterValue, stat.CPUTime())
+	ch <- prometheus.MustNewConstMetric(c.residentBytes, prometheus.GaugeValue, float64(stat.ResidentMemory()))
+	ch <- prometheus.MustNewConstMetric(c.virtualBytes, prometheus.GaugeValue, float64(stat.VirtualMemory()))
+	ch <- prometheus.MustNewConstMetric(c.threads, prometheus.GaugeValue, float64(stat.NumThreads))
+	startTime, err := stat.StartTime()
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.startTime, prometheus.GaugeValue, startTime)
+	fds, err := proc.FileDescriptorsLen()
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.openFDs, prometheus.GaugeValue, float64(fds))
+	limits, err := proc.Limits()
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.maxFDs, prometheus.GaugeValue, float64(limits.OpenFiles))
+	return nil
+}
+
+// find locates the node process, by its pid file when configured, otherwise
+// by its name. It is looked up on every update, as the node may have been
+// restarted.
+func (c *processCollector) find() (procfs.Proc, error) {
+	if c.pidFile != "" {
+		content, err := ioutil.ReadFile(c.pidFile)
+		if err != nil {
+			return procfs.Proc{}, fmt.Errorf("error reading pid file: %w", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			return procfs.Proc{}, fmt.Errorf("invalid pid file %s: %w", c.pidFile, err)
+		}
+		return c.fs.Proc(pid)
+	}
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return procfs.Proc{}, err
+	}
+	var found []procfs.Proc
+	for _, proc := range procs {
+		// Processes may exit while being listed.
+		if comm, err := proc.Comm(); err == nil && comm == c.name {
+			found = append(found, proc)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return procfs.Proc{}, fmt.Errorf("no process named %s", c.name)
+	case 1:
+		return found[0], nil
+	default:
+		return procfs.Proc{}, fmt.Errorf("%d processes named %s, set the pid file of the node", len(found), c.name)
+	}
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type templateCollector struct {
+	client RPC
+	// since returns the time elapsed since a call was sent, replaced by
+	// tests.
+	since func(time.Time) time.Duration
+
+	duration     *prometheus.Desc
+	height       *prometheus.Desc
+	transactions *prometheus.Desc
+	fees         *prometheus.Desc
+	sigOps       *prometheus.Desc
+	sigOpLimit   *prometheus.Desc
+	weight       *prometheus.Desc
+	weightLimit  *prometheus.Desc
+}
+
+func init() {
+	registerCollector("template", false, newTemplateCollector)
+}
+
+func newTemplateCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	return &templateCollector{
+		client: client,
+		since:  time.Since,
+		duration: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "duration_seconds"),
+			"Time the node took to answer the last getblocktemplate call.",
+			nil, nil,
+		),
+		height: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "height"),
+			"Height of the block of the last template.",
+			nil, nil,
+		),
+		transactions: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "transactions"),
+			"How many transactions besides the coinbase are in the last template.",
+			nil, nil,
+		),
+		fees: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "fees_btc"),
+			"Total fees paid by the transactions of the last template in BTC.",
+			nil, nil,
+		),
+		sigOps: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "sigops"),
+			"Signature operations cost of the transactions of the last template.",
+			nil, nil,
+		),
+		sigOpLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "sigops_limit"),
+			"Maximum signature operations cost of a block.",
+			nil, nil,
+		),
+		weight: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "weight"),
+			"Weight of the transactions of the last template.",
+			nil, nil,
+		),
+		weightLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "block_template", "weight_limit"),
+			"Maximum weight of a block.",
+			nil, nil,
+		),
+	}, nil
+}
+
+func (c *templateCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	start := time.Now()
+	template, err := c.client.GetBlockTemplate(ctx)
+	if err != nil {
+		return err
+	}
+	duration := c.since(start)
+	var fees, sigOps, weight int64
+	for _, tx := range template.Transactions {
+		fees += tx.Fee
+		sigOps += tx.SigOps
+		weight += tx.Weight
+	}
+	ch <- prometheus.MustNewConstMetric(c.duration, prometheus.GaugeValue, duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.height, prometheus.GaugeValue, float64(template.Height))
+	ch <- prometheus.MustNewConstMetric(c.transactions, prometheus.GaugeValue, float64(len(template.Transactions)))
+	ch <- prometheus.MustNewConstMetric(c.fees, prometheus.GaugeValue, float64(fees)/1e8)
+	ch <- prometheus.MustNewConstMetric(c.sigOps, prometheus.GaugeValue, float64(sigOps))
+	ch <- prometheus.MustNewConstMetric(c.weight, prometheus.GaugeValue, float64(weight))
+	// The limits are optional in BIP 22.
+	if template.SigOpLimit > 0 {
+		ch <- prometheus.MustNewConstMetric(c.sigOpLimit, prometheus.GaugeValue, float64(template.SigOpLimit))
+	}
+	if template.WeightLimit > 0 {
+		ch <- prometheus.MustNewConstMetric(c.weightLimit, prometheus.GaugeValue, float64(template.WeightLimit))
+	}
+	return nil
+}
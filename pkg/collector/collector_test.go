@@ -0,0 +1,680 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gopkg.in/yaml.v2"
+)
+
+const genesisAddress = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+
+var bestBlockHash = chainhash.Hash{1}
+
+// newFakeNode returns a connected btcd node at height 100 answering every
+// call.
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		connected:  true,
+		reconnects: 2,
+		chainInfo: &ChainInfo{
+			Chain:         "mainnet",
+			Blocks:        100,
+			Difficulty:    1.5,
+			BestBlockHash: &bestBlockHash,
+		},
+		connectionCount: 8,
+		blockHeaders: map[chainhash.Hash]*wire.BlockHeader{
+			bestBlockHash: {Timestamp: time.Unix(1700000000, 0)},
+		},
+		blockTemplate: &btcjson.GetBlockTemplateResult{
+			Height:      101,
+			SigOpLimit:  80000,
+			WeightLimit: 4000000,
+			Transactions: []btcjson.GetBlockTemplateResultTx{
+				{Fee: 1000, SigOps: 4, Weight: 561},
+				{Fee: 2500, SigOps: 8, Weight: 900},
+			},
+		},
+		mempoolInfo: &btcjson.GetMempoolInfoResult{Size: 10, Bytes: 2500},
+		miningInfo: &btcjson.GetMiningInfoResult{
+			NetworkHashPS:    4e9,
+			PooledTx:         10,
+			CurrentBlockSize: 1000,
+			CurrentBlockTx:   3,
+			Generate:         true,
+			GenProcLimit:     2,
+			HashesPerSec:     1.5e6,
+		},
+		netTotals: &btcjson.GetNetTotalsResult{TotalBytesRecv: 2048, TotalBytesSent: 1024},
+		peerInfo: []btcjson.GetPeerInfoResult{{
+			Addr:      "203.0.113.1:8333",
+			SubVer:    "/btcd:0.24.2/",
+			Version:   70016,
+			BytesSent: 100,
+			BytesRecv: 200,
+			PingTime:  1500,
+			BanScore:  5,
+		}},
+		transactions: map[string][]*btcjson.SearchRawTransactionsResult{
+			genesisAddress: {
+				{Vout: []btcjson.Vout{{
+					Value:        50,
+					ScriptPubKey: btcjson.ScriptPubKeyResult{Address: genesisAddress},
+				}}},
+				{Vin: []btcjson.VinPrevOut{{
+					PrevOut: &btcjson.PrevOut{Addresses: []string{genesisAddress}, Value: 10},
+				}}},
+			},
+		},
+	}
+}
+
+func enabled(names ...string) *Config {
+	config := &Config{Collectors: make(map[string]CollectorConfig)}
+	for _, name := range Names() {
+		state := false
+		for _, n := range names {
+			state = state || n == name
+		}
+		config.Collectors[name] = CollectorConfig{Enabled: &state}
+	}
+	return config
+}
+
+func newTestExporter(t *testing.T, client RPC, config *Config) *Exporter {
+	t.Helper()
+	return newTestExporterWithOptions(t, client, config, DefaultOptions())
+}
+
+func newTestExporterWithOptions(t *testing.T, client RPC, config *Config, opts Options) *Exporter {
+	t.Helper()
+	exporter, err := NewExporter(client, config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exporter
+}
+
+func TestExporterCollect(t *testing.T) {
+	exporter := newTestExporter(t, newFakeNode(), enabled("chain", "network"))
+	expected := `
+# HELP btcd_block_height Height of the best chain reported by the node, which decreases on a reorganization to a shorter chain.
+# TYPE btcd_block_height gauge
+btcd_block_height 100
+# HELP btcd_best_block_changes_total How many times the best block reported by the node changed since the exporter started watching it, new blocks and reorganizations alike.
+# TYPE btcd_best_block_changes_total counter
+btcd_best_block_changes_total 0
+# HELP btcd_chain_info Network the node is on, always 1.
+# TYPE btcd_chain_info gauge
+btcd_chain_info{chain="mainnet"} 1
+# HELP btcd_collector_success Whether a collector succeeded.
+# TYPE btcd_collector_success gauge
+btcd_collector_success{collector="chain"} 1
+btcd_collector_success{collector="network"} 1
+# HELP btcd_difficulty What is difficulty reported by the node.
+# TYPE btcd_difficulty gauge
+btcd_difficulty 1.5
+# HELP btcd_latest_block_timestamp Timestamp of the latest block in the chain. According to block header information.
+# TYPE btcd_latest_block_timestamp gauge
+btcd_latest_block_timestamp 1.7e+09
+# HELP btcd_network_received_bytes_total How many bytes have been received reported by btcd getnettotals.
+# TYPE btcd_network_received_bytes_total counter
+btcd_network_received_bytes_total 2048
+# HELP btcd_network_sent_bytes_total How many bytes have been sent reported by btcd getnettotals.
+# TYPE btcd_network_sent_bytes_total counter
+btcd_network_sent_bytes_total 1024
+# HELP btcd_peers How many peers are connected to the node.
+# TYPE btcd_peers gauge
+btcd_peers 8
+# HELP btcd_rpc_connected Whether the websocket connection to btcd is established.
+# TYPE btcd_rpc_connected gauge
+btcd_rpc_connected 1
+# HELP btcd_up Was the last btcd query successful, that is did at least one collector succeed.
+# TYPE btcd_up gauge
+btcd_up 1
+`
+	if err := compare(exporter, strings.NewReader(expected),
+		"btcd_block_height", "btcd_best_block_changes_total", "btcd_chain_info", "btcd_collector_success", "btcd_difficulty",
+		"btcd_latest_block_timestamp", "btcd_network_received_bytes_total",
+		"btcd_network_sent_bytes_total", "btcd_peers", "btcd_rpc_connected", "btcd_up",
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBestBlockChanges(t *testing.T) {
+	node := newFakeNode()
+	exporter := newTestExporter(t, node, enabled("chain"))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	// check gathers the metrics and compares the count of best block
+	// changes and its exemplar with the best block of the node.
+	check := func(wantChanges float64, wantHash chainhash.Hash, wantTime time.Time) {
+		t.Helper()
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, family := range families {
+			if family.GetName() != "btcd_best_block_changes_total" {
+				continue
+			}
+			counter := family.GetMetric()[0].GetCounter()
+			if got := counter.GetValue(); got != wantChanges {
+				t.Errorf("got %v changes, want %v", got, wantChanges)
+			}
+			exemplar := counter.GetExemplar()
+			if exemplar == nil {
+				t.Fatal("btcd_best_block_changes_total has no exemplar")
+			}
+			if got := exemplar.GetLabel()[0]; got.GetName() != "block_hash" || got.GetValue() != wantHash.String() {
+				t.Errorf("got exemplar label %s=%s, want block_hash=%s", got.GetName(), got.GetValue(), wantHash)
+			}
+			if got := exemplar.GetTimestamp().AsTime(); !got.Equal(wantTime) {
+				t.Errorf("got exemplar timestamp %s, want the block time %s", got, wantTime)
+			}
+			return
+		}
+		t.Fatal("btcd_best_block_changes_total is missing")
+	}
+
+	check(0, bestBlockHash, time.Unix(1700000000, 0))
+	check(0, bestBlockHash, time.Unix(1700000000, 0))
+	next := chainhash.Hash{2}
+	node.blockHeaders[next] = &wire.BlockHeader{Timestamp: time.Unix(1700000600, 0)}
+	node.chainInfo.BestBlockHash = &next
+	check(1, next, time.Unix(1700000600, 0))
+	// A reorganization back to the former best block is a change too.
+	node.chainInfo.BestBlockHash = &bestBlockHash
+	check(2, bestBlockHash, time.Unix(1700000000, 0))
+}
+
+func TestLegacyMetrics(t *testing.T) {
+	opts := DefaultOptions()
+	opts.LegacyMetrics = true
+	exporter := newTestExporterWithOptions(t, newFakeNode(), enabled("chain", "network"), opts)
+	expected := `
+# HELP btcd_block_height Height of the best chain reported by the node, which decreases on a reorganization to a shorter chain.
+# TYPE btcd_block_height gauge
+btcd_block_height 100
+# HELP btcd_blocks_total How many blocks are in the best chain reported by the node. Deprecated, use block_height.
+# TYPE btcd_blocks_total counter
+btcd_blocks_total 100
+# HELP btcd_network_received_bytes_total How many bytes have been received reported by btcd getnettotals.
+# TYPE btcd_network_received_bytes_total counter
+btcd_network_received_bytes_total 2048
+# HELP btcd_received_bytes How many bytes have been received reported by btcd getnettotals. Deprecated, use network_received_bytes_total.
+# TYPE btcd_received_bytes gauge
+btcd_received_bytes 2048
+# HELP btcd_sent_bytes How many bytes have been sent reported by btcd getnettotals. Deprecated, use network_sent_bytes_total.
+# TYPE btcd_sent_bytes counter
+btcd_sent_bytes 1024
+`
+	if err := compare(exporter, strings.NewReader(expected),
+		"btcd_block_height", "btcd_blocks_total", "btcd_network_received_bytes_total",
+		"btcd_received_bytes", "btcd_sent_bytes",
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExporterCollectorFailure(t *testing.T) {
+	node := newFakeNode()
+	node.errs = map[string]error{"getnettotals": errors.New("connection refused")}
+	exporter := newTestExporter(t, node, enabled("chain", "network"))
+	expected := `
+# HELP btcd_collector_success Whether a collector succeeded.
+# TYPE btcd_collector_success gauge
+btcd_collector_success{collector="chain"} 1
+btcd_collector_success{collector="network"} 0
+# HELP btcd_up Was the last btcd query successful, that is did at least one collector succeed.
+# TYPE btcd_up gauge
+btcd_up 1
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_collector_success", "btcd_up"); err != nil {
+		t.Error(err)
+	}
+	// Metrics obtained before the failure are kept, those of the failed
+	// call are missing.
+	if n := count(exporter, "btcd_peers"); n != 1 {
+		t.Errorf("got %d btcd_peers metrics from a failed collector, want 1", n)
+	}
+	if n := count(exporter, "btcd_network_sent_bytes_total"); n != 0 {
+		t.Errorf("got %d btcd_network_sent_bytes_total metrics after getnettotals failed, want 0", n)
+	}
+	if err := exporter.Status().Collectors["network"].Err; err == nil {
+		t.Error("status of the failed network collector has no error")
+	}
+}
+
+func TestChainCollectorHeaderFailure(t *testing.T) {
+	node := newFakeNode()
+	node.errs = map[string]error{"getblockheader": errors.New("connection refused")}
+	exporter := newTestExporter(t, node, enabled("chain"))
+	expected := `
+# HELP btcd_block_height Height of the best chain reported by the node, which decreases on a reorganization to a shorter chain.
+# TYPE btcd_block_height gauge
+btcd_block_height 100
+# HELP btcd_collector_success Whether a collector succeeded.
+# TYPE btcd_collector_success gauge
+btcd_collector_success{collector="chain"} 0
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_block_height", "btcd_collector_success"); err != nil {
+		t.Error(err)
+	}
+	if n := count(exporter, "btcd_latest_block_timestamp"); n != 0 {
+		t.Errorf("got %d btcd_latest_block_timestamp metrics without the header, want 0", n)
+	}
+}
+
+func TestExporterNodeDown(t *testing.T) {
+	err := errors.New("connection refused")
+	node := newFakeNode()
+	node.connected = false
+	node.errs = map[string]error{"getblockchaininfo": err, "getconnectioncount": err}
+	exporter := newTestExporter(t, node, enabled("chain", "network"))
+	expected := `
+# HELP btcd_rpc_connected Whether the websocket connection to btcd is established.
+# TYPE btcd_rpc_connected gauge
+btcd_rpc_connected 0
+# HELP btcd_up Was the last btcd query successful, that is did at least one collector succeed.
+# TYPE btcd_up gauge
+btcd_up 0
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_rpc_connected", "btcd_up"); err != nil {
+		t.Error(err)
+	}
+	if exporter.Status().Up {
+		t.Error("status reports the node up")
+	}
+}
+
+func TestPollingCollectorMaxAge(t *testing.T) {
+	exporter := newTestExporter(t, newFakeNode(), enabled("chain"))
+	poller := NewPollingCollector(exporter, time.Minute, time.Second, time.Minute)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(poller)
+	if n, err := testutil.GatherAndCount(reg, "btcd_exporter_poll_age_seconds"); err != nil || n != 0 {
+		t.Errorf("got %d poll ages before the first poll, error %v", n, err)
+	}
+
+	poller.poll()
+	if n, err := testutil.GatherAndCount(reg, "btcd_block_height", "btcd_exporter_poll_age_seconds"); err != nil || n != 2 {
+		t.Errorf("got %d metrics of a fresh poll, want 2, error %v", n, err)
+	}
+
+	poller.updated = poller.updated.Add(-2 * time.Minute)
+	if n, err := testutil.GatherAndCount(reg, "btcd_block_height"); err != nil || n != 0 {
+		t.Errorf("got %d block heights of a stale poll, want them withheld, error %v", n, err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		switch family.GetName() {
+		case "btcd_exporter_poll_age_seconds":
+			if age := family.GetMetric()[0].GetGauge().GetValue(); age < 120 {
+				t.Errorf("poll age is %v, want at least 120", age)
+			}
+		case "btcd_up":
+			if up := family.GetMetric()[0].GetGauge().GetValue(); up != 0 {
+				t.Errorf("btcd_up is %v for a stale poll, want 0", up)
+			}
+		}
+	}
+	if !poller.stale.Load() {
+		t.Error("stale poll not recorded")
+	}
+
+	poller.poll()
+	if poller.stale.Load() {
+		t.Error("fresh poll still recorded stale")
+	}
+	if n, err := testutil.GatherAndCount(reg, "btcd_block_height"); err != nil || n != 1 {
+		t.Errorf("got %d block heights after a fresh poll, want 1, error %v", n, err)
+	}
+}
+
+func TestExporterHTTPPostMode(t *testing.T) {
+	node := newFakeNode()
+	node.httpPostMode = true
+	exporter := newTestExporter(t, node, enabled("chain"))
+	if n := count(exporter, "btcd_rpc_connected", "btcd_rpc_reconnects_total"); n != 0 {
+		t.Errorf("got %d connection metrics in HTTP POST mode, want 0", n)
+	}
+}
+
+func TestExporterBackendCollectors(t *testing.T) {
+	for _, test := range []struct {
+		backend string
+		want    []string
+	}{
+		{BackendBtcd, []string{"address", "chain", "mempool", "network"}},
+		{BackendBitcoind, []string{"chain", "mempool", "network"}},
+	} {
+		t.Run(test.backend, func(t *testing.T) {
+			node := newFakeNode()
+			node.backend = test.backend
+			exporter := newTestExporter(t, node, enabled("address", "chain", "mempool", "network"))
+			exporter.Collect(make(chan prometheus.Metric, 1000))
+			var got []string
+			for name := range exporter.Status().Collectors {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got collectors %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExporterDescribe(t *testing.T) {
+	exporter := newTestExporter(t, newFakeNode(), enabled("chain"))
+	ch := make(chan *prometheus.Desc, 100)
+	exporter.Describe(ch)
+	close(ch)
+	names := make(map[string]bool)
+	for desc := range ch {
+		name := desc.String()
+		if names[name] {
+			t.Errorf("%s described twice", name)
+		}
+		names[name] = true
+	}
+	if len(names) == 0 {
+		t.Fatal("no metric described")
+	}
+	polled := false
+	for name := range names {
+		polled = polled || strings.Contains(name, `"btcd_exporter_poll_age_seconds"`)
+	}
+	if !polled {
+		t.Error("poll age not described")
+	}
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(exporter); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Error(err)
+	}
+}
+
+// blockingCollector counts its updates, which wait for release.
+type blockingCollector struct {
+	updates atomic.Int32
+	release chan struct{}
+}
+
+func (c *blockingCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.updates.Add(1)
+	<-c.release
+	return nil
+}
+
+func TestCachingCollectorFirstRefresh(t *testing.T) {
+	blocking := &blockingCollector{release: make(chan struct{})}
+	c := newCachingCollector("chain", blocking, time.Minute, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := collect(context.Background(), c); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let every scrape reach the cache before the refresh completes.
+	time.Sleep(50 * time.Millisecond)
+	close(blocking.release)
+	wg.Wait()
+	if n := blocking.updates.Load(); n != 1 {
+		t.Errorf("got %d refreshes for concurrent first scrapes, want 1", n)
+	}
+
+	// A scrape waiting for the first refresh gives up with its context.
+	blocking = &blockingCollector{release: make(chan struct{})}
+	defer close(blocking.release)
+	c = newCachingCollector("chain", blocking, time.Minute, 0)
+	go collect(context.Background(), c)
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := collect(ctx, c); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v waiting for the first refresh, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMempoolCollector(t *testing.T) {
+	exporter := newTestExporter(t, newFakeNode(), enabled("mempool"))
+	expected := `
+# HELP btcd_mempool_bytes Size of the mempool in bytes reported by btcd getmempoolinfo.
+# TYPE btcd_mempool_bytes gauge
+btcd_mempool_bytes 2500
+# HELP btcd_mempool_transactions How many transactions are in the mempool reported by btcd getmempoolinfo.
+# TYPE btcd_mempool_transactions gauge
+btcd_mempool_transactions 10
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_mempool_bytes", "btcd_mempool_transactions"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMiningCollector(t *testing.T) {
+	exporter := newTestExporter(t, newFakeNode(), enabled("mining"))
+	if got := count(exporter, "btcd_mining_network_hashes_per_second", "btcd_mining_pooled_transactions", "btcd_mining_current_block_bytes", "btcd_mining_current_block_transactions"); got != 4 {
+		t.Errorf("got %d mining metrics, want 4", got)
+	}
+}
+
+func TestMiningCollectorCPUMiner(t *testing.T) {
+	// Bitcoin Core has no CPU miner.
+	node := newFakeNode()
+	node.backend = BackendBitcoind
+	exporter := newTestExporter(t, node, enabled("mining"))
+	if got := count(exporter, "btcd_mining_generate", "btcd_mining_hashes_per_second", "btcd_mining_workers"); got != 0 {
+		t.Errorf("got %d CPU miner metrics of bitcoind, want 0", got)
+	}
+	exporter = newTestExporter(t, newFakeNode(), enabled("mining"))
+	expected := `
+# HELP btcd_mining_generate Whether the CPU miner of btcd is generating blocks.
+# TYPE btcd_mining_generate gauge
+btcd_mining_generate 1
+# HELP btcd_mining_hashes_per_second Hash rate of the CPU miner of btcd.
+# TYPE btcd_mining_hashes_per_second gauge
+btcd_mining_hashes_per_second 1.5e+06
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_mining_generate", "btcd_mining_hashes_per_second"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessCollector(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "node.pid")
+	if err := os.WriteFile(pidFile, []byte("26232\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name    string
+		backend string
+		process ProcessConfig
+		// fds are the open file descriptors of the process found, none
+		// if empty.
+		fds string
+	}{
+		// The process is named after the backend by default.
+		{name: "btcd", fds: "4"},
+		{name: "bitcoind", backend: BackendBitcoind},
+		{name: "pid file", process: ProcessConfig{PIDFile: pidFile}, fds: "1"},
+		{name: "process name", process: ProcessConfig{Name: "bash"}, fds: "1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			node := newFakeNode()
+			node.backend = test.backend
+			config := enabled("process")
+			config.Process = test.process
+			config.Process.ProcFS = filepath.Join("testdata", "proc")
+			exporter := newTestExporter(t, node, config)
+			expected := ""
+			if test.fds != "" {
+				expected = `
+# HELP btcd_process_open_fds Number of open file descriptors of the node process.
+# TYPE btcd_process_open_fds gauge
+btcd_process_open_fds ` + test.fds + "\n"
+			}
+			if err := compare(exporter, strings.NewReader(expected), "btcd_process_open_fds"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDiskCollector(t *testing.T) {
+	if _, err := NewExporter(newFakeNode(), enabled("disk"), DefaultOptions()); err == nil {
+		t.Error("disk collector created without a data directory")
+	}
+	config := enabled("disk")
+	config.Disk.DataDir = t.TempDir()
+	exporter := newTestExporter(t, newFakeNode(), config)
+	if got := count(exporter, "btcd_disk_data_dir_bytes", "btcd_disk_filesystem_size_bytes", "btcd_disk_filesystem_avail_bytes"); got != 3 {
+		t.Errorf("got %d disk metrics, want 3", got)
+	}
+}
+
+func TestTemplateCollector(t *testing.T) {
+	exporter := newTestExporter(t, newFakeNode(), enabled("template"))
+	expected := `
+# HELP btcd_block_template_fees_btc Total fees paid by the transactions of the last template in BTC.
+# TYPE btcd_block_template_fees_btc gauge
+btcd_block_template_fees_btc 3.5e-05
+# HELP btcd_block_template_transactions How many transactions besides the coinbase are in the last template.
+# TYPE btcd_block_template_transactions gauge
+btcd_block_template_transactions 2
+# HELP btcd_block_template_weight Weight of the transactions of the last template.
+# TYPE btcd_block_template_weight gauge
+btcd_block_template_weight 1461
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_block_template_fees_btc", "btcd_block_template_transactions", "btcd_block_template_weight"); err != nil {
+		t.Error(err)
+	}
+	if got := count(exporter, "btcd_block_template_duration_seconds"); got != 1 {
+		t.Errorf("got %d duration metrics, want 1", got)
+	}
+}
+
+func TestPeersCollector(t *testing.T) {
+	for _, test := range []struct {
+		backend string
+		ping    string
+	}{
+		// btcd reports the ping time in microseconds, Bitcoin Core in
+		// seconds.
+		{BackendBtcd, "0.0015"},
+		{BackendBitcoind, "1500"},
+	} {
+		t.Run(test.backend, func(t *testing.T) {
+			node := newFakeNode()
+			node.backend = test.backend
+			exporter := newTestExporter(t, node, enabled("peers"))
+			expected := `
+# HELP btcd_peer_ping_seconds Last ping round trip time to a peer reported by btcd getpeerinfo.
+# TYPE btcd_peer_ping_seconds gauge
+btcd_peer_ping_seconds{addr="203.0.113.1:8333"} ` + test.ping + `
+# HELP btcd_peer_info Information about a connected peer reported by btcd getpeerinfo.
+# TYPE btcd_peer_info gauge
+btcd_peer_info{addr="203.0.113.1:8333",inbound="false",subver="/btcd:0.24.2/",version="70016"} 1
+`
+			if err := compare(exporter, strings.NewReader(expected), "btcd_peer_ping_seconds", "btcd_peer_info"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAddressCollector(t *testing.T) {
+	config := enabled("address")
+	config.Addresses = []WatchedAddress{{Address: genesisAddress}}
+	exporter := newTestExporter(t, newFakeNode(), config)
+	expected := `
+# HELP btcd_address_balance_btc Balance of a watched address in BTC, including unconfirmed transactions. Requires btcd to run with --addrindex.
+# TYPE btcd_address_balance_btc gauge
+btcd_address_balance_btc{address="` + genesisAddress + `"} 40
+# HELP btcd_address_transactions How many transactions involve a watched address, including unconfirmed ones. Requires btcd to run with --addrindex.
+# TYPE btcd_address_transactions gauge
+btcd_address_transactions{address="` + genesisAddress + `"} 2
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_address_balance_btc", "btcd_address_transactions"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddressLabels(t *testing.T) {
+	const other = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+	var config Config
+	if err := yaml.UnmarshalStrict([]byte(`
+collectors:
+  address:
+    enabled: true
+addresses:
+  - `+genesisAddress+`
+  - address: `+other+`
+    labels:
+      purpose: cold-storage
+      customer: acme
+`), &config); err != nil {
+		t.Fatal(err)
+	}
+	exporter := newTestExporter(t, newFakeNode(), &config)
+	expected := `
+# HELP btcd_address_transactions How many transactions involve a watched address, including unconfirmed ones. Requires btcd to run with --addrindex.
+# TYPE btcd_address_transactions gauge
+btcd_address_transactions{address="` + genesisAddress + `",customer="",purpose=""} 2
+btcd_address_transactions{address="` + other + `",customer="acme",purpose="cold-storage"} 0
+`
+	if err := compare(exporter, strings.NewReader(expected), "btcd_address_transactions"); err != nil {
+		t.Error(err)
+	}
+
+	config.Addresses[1].Labels["address"] = "x"
+	if err := config.Validate(); err == nil {
+		t.Error("address label accepted")
+	}
+}
+
+// compare collects exporter like the exporter registers it, on a registry
+// which does not check the metrics of the collectors against the descriptions
+// of the Exporter, and compares the metrics called names with expected.
+func compare(exporter *Exporter, expected io.Reader, names ...string) error {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	return testutil.GatherAndCompare(reg, expected, names...)
+}
+
+// count collects exporter and returns the number of metrics called names.
+func count(exporter *Exporter, names ...string) int {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	n, err := testutil.GatherAndCount(reg, names...)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
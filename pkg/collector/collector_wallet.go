@@ -0,0 +1,216 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// walletRecentWindow is how far back transactions count as recent.
+	walletRecentWindow = 24 * time.Hour
+	// walletListTransactions is the number of latest transactions in which
+	// recent ones are looked for.
+	walletListTransactions = 1000
+)
+
+var (
+	// All exporters share the connection to btcwallet, which is not tied to
+	// any node. Reloading the configuration may change its settings, so
+	// clients are kept by settings until pruned.
+	walletClientsMtx sync.Mutex
+	walletClients    = make(map[RPCConfig]*Client)
+)
+
+type walletCollector struct {
+	// config identifies the shared client, which is recreated when its
+	// certificate or credentials change.
+	config             RPCConfig
+	account            string
+	balance            *prometheus.Desc
+	unspentOutputs     *prometheus.Desc
+	recentTransactions *prometheus.Desc
+}
+
+func init() {
+	registerCollector("wallet", false, newWalletCollector)
+}
+
+func newWalletCollector(client RPC, config *Config, opts Options) (Collector, error) {
+	if _, err := sharedWalletClient(config.Wallet.RPCConfig, opts); err != nil {
+		return nil, err
+	}
+	account := config.Wallet.Account
+	if account == "" {
+		account = "default"
+	}
+	return &walletCollector{
+		config:  config.Wallet.RPCConfig,
+		account: account,
+		balance: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "wallet", "balance_btc"),
+			"Balance of the wallet account in BTC reported by btcwallet getbalance and getunconfirmedbalance.",
+			[]string{"status"}, nil,
+		),
+		unspentOutputs: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "wallet", "unspent_outputs"),
+			"How many confirmed unspent outputs the wallet holds reported by btcwallet listunspent.",
+			nil, nil,
+		),
+		recentTransactions: prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, "wallet", "recent_transactions"),
+			"How many of the latest 1000 transactions of the wallet account are from the last 24 hours, by category, reported by btcwallet listtransactions.",
+			[]string{"category"}, nil,
+		),
+	}, nil
+}
+
+// sharedWalletClient returns the client of the btcwallet described by
+// config, creating it on first use.
+func sharedWalletClient(config RPCConfig, opts Options) (*Client, error) {
+	walletClientsMtx.Lock()
+	current := walletClients[config]
+	walletClientsMtx.Unlock()
+	if current != nil {
+		return current, nil
+	}
+	client, err := newWalletClient(config, opts)
+	if err != nil {
+		return nil, err
+	}
+	walletClientsMtx.Lock()
+	defer walletClientsMtx.Unlock()
+	if other := walletClients[config]; other != nil {
+		// Another collector created the client meanwhile.
+		client.Shutdown()
+		return other, nil
+	}
+	walletClients[config] = client
+	return client, nil
+}
+
+// walletClient returns the current client of the btcwallet described by
+// config, nil if there is none.
+func walletClient(config RPCConfig) *Client {
+	walletClientsMtx.Lock()
+	defer walletClientsMtx.Unlock()
+	return walletClients[config]
+}
+
+func newWalletClient(config RPCConfig, opts Options) (*Client, error) {
+	if err := config.ReadCredentials(); err != nil {
+		return nil, err
+	}
+	if config.Host == "" || config.Username == "" || config.Password == "" {
+		return nil, errors.New("host, username and password of btcwallet must be set (--wallet.host, --wallet.username and --wallet.password, or the wallet section of the config file, where username_file and password_file can be used instead)")
+	}
+	if config.TLS.CertFile == "" {
+		config.TLS.CertFile = filepath.Join(btcutil.AppDataDir("btcwallet", false), "rpc.cert")
+	}
+	config.Backend = BackendBtcd
+	client, err := NewClient(config, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	client.wallet = true
+	return client, nil
+}
+
+// RefreshWalletClients recreates the clients of btcwallet whose certificate
+// or credentials changed. The wallet collectors use the new clients from
+// their next scrape on, without the configuration being reloaded.
+func RefreshWalletClients() {
+	// The certificates and the secret stores are read without holding up
+	// the other users of the clients.
+	walletClientsMtx.Lock()
+	clients := make(map[RPCConfig]*Client, len(walletClients))
+	for config, client := range walletClients {
+		clients[config] = client
+	}
+	walletClientsMtx.Unlock()
+	for config, current := range clients {
+		if !current.CertChanged() && !current.CredentialsChanged() {
+			continue
+		}
+		slog.Info("btcwallet certificate or credentials changed, recreating its client", "host", config.Host)
+		client, err := newWalletClient(config, current.opts)
+		if err != nil {
+			slog.Error("error recreating btcwallet client", "host", config.Host, "err", err)
+			current.CertSeen()
+			continue
+		}
+		walletClientsMtx.Lock()
+		if walletClients[config] != current {
+			// The client was pruned or replaced meanwhile.
+			walletClientsMtx.Unlock()
+			client.Shutdown()
+			continue
+		}
+		walletClients[config] = client
+		walletClientsMtx.Unlock()
+		current.Shutdown()
+	}
+}
+
+// PruneWalletClients shuts down the clients of btcwallet whose settings are
+// not keep.
+func PruneWalletClients(keep RPCConfig) {
+	walletClientsMtx.Lock()
+	defer walletClientsMtx.Unlock()
+	for config, client := range walletClients {
+		if config != keep {
+			client.Shutdown()
+			delete(walletClients, config)
+		}
+	}
+}
+
+func (c *walletCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	client := walletClient(c.config)
+	if client == nil {
+		return errors.New("btcwallet client was shut down")
+	}
+	confirmed, err := Call(ctx, "getbalance", func() rpcclient.FutureGetBalanceResult {
+		return client.GetBalanceAsync(c.account)
+	})
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.balance, prometheus.GaugeValue, confirmed.ToBTC(), "confirmed")
+	unconfirmed, err := Call(ctx, "getunconfirmedbalance", func() rpcclient.FutureGetUnconfirmedBalanceResult {
+		return client.GetUnconfirmedBalanceAsync(c.account)
+	})
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.balance, prometheus.GaugeValue, unconfirmed.ToBTC(), "unconfirmed")
+	unspent, err := Call(ctx, "listunspent", client.ListUnspentAsync)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.unspentOutputs, prometheus.GaugeValue, float64(len(unspent)))
+	txs, err := Call(ctx, "listtransactions", func() rpcclient.FutureListTransactionsResult {
+		return client.ListTransactionsCountAsync(c.account, walletListTransactions)
+	})
+	if err != nil {
+		return err
+	}
+	recent := map[string]int{"receive": 0, "send": 0}
+	since := time.Now().Add(-walletRecentWindow).Unix()
+	for _, tx := range txs {
+		if tx.Time >= since {
+			recent[tx.Category]++
+		}
+	}
+	for category, count := range recent {
+		ch <- prometheus.MustNewConstMetric(c.recentTransactions, prometheus.GaugeValue, float64(count), category)
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/prometheus/common/model"
+)
+
+// Config holds the settings of the collectors. It can be embedded inline in
+// a larger YAML configuration.
+type Config struct {
+	Collectors map[string]CollectorConfig `yaml:"collectors"`
+	Addresses  []WatchedAddress           `yaml:"addresses"`
+	Deposits   DepositsConfig             `yaml:"deposits"`
+	Payments   PaymentsConfig             `yaml:"payments"`
+	Process    ProcessConfig              `yaml:"process"`
+	Disk       DiskConfig                 `yaml:"disk"`
+	Log        LogConfig                  `yaml:"log"`
+	Wallet     WalletConfig               `yaml:"wallet"`
+}
+
+// RPCConfig holds the settings used to connect to the RPC server of a node.
+type RPCConfig struct {
+	// Backend is "btcd" or "bitcoind" for Bitcoin Core.
+	Backend string `yaml:"backend"`
+	// Mode is either "ws" for websocket or "http" for HTTP POST requests.
+	Mode     string `yaml:"mode"`
+	Host     string `yaml:"host"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// UsernameFile and PasswordFile are read when Username and Password
+	// are not set.
+	UsernameFile string `yaml:"username_file"`
+	PasswordFile string `yaml:"password_file"`
+	// CookieFile is the path to the cookie file bitcoind writes its
+	// credentials to, used when no password is set.
+	CookieFile string `yaml:"cookie_file"`
+	// BtcdConfigFile is the path to the configuration file of a local
+	// btcd, from which unset connection settings are taken.
+	BtcdConfigFile string `yaml:"btcd_config_file"`
+	// Proxy is the URL of a SOCKS5 proxy to connect through, for example
+	// socks5://127.0.0.1:9050 for Tor.
+	Proxy string    `yaml:"proxy"`
+	TLS   TLSConfig `yaml:"tls"`
+	// LegacyGetInfo makes the btcd backend query the deprecated getinfo
+	// instead of getblockchaininfo and getconnectioncount, for btcd
+	// releases without the latter.
+	LegacyGetInfo bool `yaml:"legacy_getinfo"`
+	// Batch sends the calls made at the same time, as those of the
+	// collectors of a scrape, as a single JSON-RPC batch. It needs HTTP
+	// POST mode, websocket calls being pipelined already.
+	Batch bool `yaml:"batch"`
+	// Credentials is a secret store the username and password are fetched
+	// from when they are not set.
+	Credentials CredentialsConfig `yaml:"credentials"`
+}
+
+// WatchedAddress is an address watched by the address collector, with the
+// labels attached to its metrics. In YAML, it is either the address alone or
+// a mapping with address and labels.
+type WatchedAddress struct {
+	Address string            `yaml:"address"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// UnmarshalYAML accepts a plain address as well as a mapping.
+func (a *WatchedAddress) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&a.Address); err == nil {
+		return nil
+	}
+	type plain WatchedAddress
+	return unmarshal((*plain)(a))
+}
+
+// DepositsConfig holds the settings of the deposits collector.
+type DepositsConfig struct {
+	// Confirmations is the number of confirmations after which a deposit
+	// counts as credited, 6 if 0.
+	Confirmations int `yaml:"confirmations"`
+}
+
+// PaymentsConfig holds the settings of the payments collector.
+type PaymentsConfig struct {
+	// RescanFromHeight is the height from which btcd rescans the chain for
+	// the payments made before the exporter connected, none if 0.
+	RescanFromHeight int32 `yaml:"rescan_from_height"`
+}
+
+// ProcessConfig tells the process collector how to find the process of the
+// node.
+type ProcessConfig struct {
+	// PIDFile is the path of a file holding the process id of the node.
+	PIDFile string `yaml:"pid_file"`
+	// Name is the name of the process of the node, looked up when no pid
+	// file is set. It defaults to the backend, btcd or bitcoind.
+	Name string `yaml:"name"`
+	// ProcFS is where the proc filesystem is mounted, /proc by default.
+	// Mount the one of the host in a container.
+	ProcFS string `yaml:"procfs"`
+}
+
+// Validate checks that the process is found one way only.
+func (c *ProcessConfig) Validate() error {
+	if c.PIDFile != "" && c.Name != "" {
+		return fmt.Errorf("set either the pid file or the name of the node process, not both")
+	}
+	return nil
+}
+
+// DiskConfig holds the settings of the disk collector.
+type DiskConfig struct {
+	// DataDir is the data directory of the node.
+	DataDir string `yaml:"data_dir"`
+}
+
+// LogConfig holds the settings of the log collector.
+type LogConfig struct {
+	// File is the log file of the node.
+	File string `yaml:"file"`
+	// Categories are regular expressions matched against the messages of
+	// the log, by category name, in addition to the default ones.
+	Categories map[string]string `yaml:"categories"`
+}
+
+// Validate checks the patterns of the categories.
+func (c *LogConfig) Validate() error {
+	_, err := c.compileCategories()
+	return err
+}
+
+// WalletConfig holds the settings of the btcwallet RPC server queried by
+// the wallet collector.
+type WalletConfig struct {
+	RPCConfig `yaml:",inline"`
+	// Account is the wallet account to report on, "default" if empty.
+	Account string `yaml:"account"`
+}
+
+// TLSConfig holds the TLS settings of the btcd RPC connection.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	// ServerName is the name the certificate of the server is verified
+	// against, the host by default.
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// CollectorConfig holds the settings of a single collector.
+type CollectorConfig struct {
+	Enabled  *bool          `yaml:"enabled"`
+	Interval model.Duration `yaml:"interval"`
+}
+
+// Validate checks the settings of the collectors.
+func (c *Config) Validate() error {
+	for name := range c.Collectors {
+		if _, ok := factories[name]; !ok {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	if c.Deposits.Confirmations < 0 {
+		return fmt.Errorf("invalid number of deposit confirmations %d", c.Deposits.Confirmations)
+	}
+	if c.Payments.RescanFromHeight < 0 {
+		return fmt.Errorf("invalid payments rescan height %d", c.Payments.RescanFromHeight)
+	}
+	if err := c.Log.Validate(); err != nil {
+		return err
+	}
+	if err := c.Process.Validate(); err != nil {
+		return err
+	}
+	_, err := c.WatchedAddresses()
+	return err
+}
+
+// EnabledCollectors returns the names of the enabled collectors, sorted.
+// Collectors not listed in Collectors, or without an enabled setting, have
+// their default state.
+func (c *Config) EnabledCollectors() []string {
+	names := []string{}
+	for name := range factories {
+		enabled := collectorDefault[name]
+		if setting := c.Collectors[name].Enabled; setting != nil {
+			enabled = *setting
+		}
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectorInterval returns the refresh interval of the named collector, 0
+// if it is refreshed on every scrape.
+func (c *Config) collectorInterval(name string) time.Duration {
+	return time.Duration(c.Collectors[name].Interval)
+}
+
+// WatchedAddresses decodes the configured addresses and checks the names of
+// their labels.
+func (c *Config) WatchedAddresses() ([]btcutil.Address, error) {
+	addresses := make([]btcutil.Address, 0, len(c.Addresses))
+	for _, address := range c.Addresses {
+		decoded, err := decodeAddress(address.Address)
+		if err != nil {
+			return nil, err
+		}
+		for name := range address.Labels {
+			if !model.LabelName(name).IsValid() || name == "address" {
+				return nil, fmt.Errorf("invalid label name %q of address %s", name, address.Address)
+			}
+		}
+		addresses = append(addresses, decoded)
+	}
+	return addresses, nil
+}
+
+// decodeAddress decodes an address of any of the networks btcd supports.
+func decodeAddress(address string) (btcutil.Address, error) {
+	for _, params := range []*chaincfg.Params{
+		&chaincfg.MainNetParams,
+		&chaincfg.TestNet3Params,
+		&chaincfg.RegressionNetParams,
+		&chaincfg.SigNetParams,
+		&chaincfg.SimNetParams,
+	} {
+		decoded, err := btcutil.DecodeAddress(address, params)
+		if err == nil && decoded.IsForNet(params) {
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid address %q", address)
+}
+
+// Validate checks the backend, mode, proxy and secret store of c.
+func (c *RPCConfig) Validate() error {
+	if _, err := newBackend(c.Backend); err != nil {
+		return err
+	}
+	if c.LegacyGetInfo && c.Backend != "" && c.Backend != BackendBtcd {
+		return fmt.Errorf("legacy getinfo is only supported by btcd, not %s", c.Backend)
+	}
+	if c.Batch && (c.Mode == RPCModeWebsocket || c.Mode == "" && c.Backend != BackendBitcoind) {
+		return errors.New("batching RPC calls needs rpc mode http, websocket calls are pipelined already")
+	}
+	switch c.Mode {
+	case "", RPCModeWebsocket, RPCModeHTTP:
+	default:
+		return fmt.Errorf("unknown rpc mode %q", c.Mode)
+	}
+	if c.Proxy != "" {
+		if _, err := parseProxy(c.Proxy); err != nil {
+			return err
+		}
+	}
+	return c.Credentials.validate()
+}
+
+// CertFile returns the path of the TLS certificate of the RPC server, empty
+// if TLS is not used or the backend is unknown.
+func (c *RPCConfig) CertFile() string {
+	b, err := newBackend(c.Backend)
+	if err != nil {
+		return ""
+	}
+	return b.certFile(*c)
+}
+
+// ReadCredentials reads the username and password from their files, unless
+// they are set themselves. Trailing newlines are ignored. If both are still
+// unset, they are fetched from the secret store.
+func (c *RPCConfig) ReadCredentials() error {
+	for _, credential := range []struct {
+		value *string
+		file  string
+	}{
+		{&c.Username, c.UsernameFile},
+		{&c.Password, c.PasswordFile},
+	} {
+		if *credential.value != "" || credential.file == "" {
+			continue
+		}
+		content, err := ioutil.ReadFile(credential.file)
+		if err != nil {
+			return fmt.Errorf("error reading credentials: %w", err)
+		}
+		*credential.value = strings.TrimRight(string(content), "\r\n")
+	}
+	if c.Credentials.Provider != "" && c.Username == "" && c.Password == "" {
+		username, password, err := c.Credentials.fetch()
+		if err != nil {
+			return err
+		}
+		c.Username, c.Password = username, password
+	}
+	return nil
+}
+
+// ApplyBtcdConfig takes the host, credentials and certificate from the btcd
+// configuration file, if any, unless they are set.
+func (c *RPCConfig) ApplyBtcdConfig() error {
+	if c.BtcdConfigFile == "" {
+		return nil
+	}
+	btcdConfig, err := readBtcdConfig(c.BtcdConfigFile)
+	if err != nil {
+		return fmt.Errorf("error reading btcd config file: %w", err)
+	}
+	if c.Host != "" {
+		btcdConfig.Host = c.Host
+	}
+	c.Host = btcdConfig.Host
+	if c.Username == "" && c.UsernameFile == "" && c.Password == "" && c.PasswordFile == "" && c.CookieFile == "" {
+		c.Username, c.Password = btcdConfig.Username, btcdConfig.Password
+	}
+	if c.TLS.CertFile != "" {
+		btcdConfig.TLS.CertFile = c.TLS.CertFile
+	}
+	c.TLS.CertFile = btcdConfig.TLS.CertFile
+	return nil
+}
@@ -0,0 +1,392 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/prometheus/common/model"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Credential providers, see CredentialsConfig.
+const (
+	credentialsVault = "vault"
+	credentialsAWS   = "aws"
+	credentialsGCP   = "gcp"
+)
+
+// CredentialsConfig describes a secret store holding the RPC username and
+// password, as a JSON object with username and password keys.
+type CredentialsConfig struct {
+	// Provider is "vault", "aws" or "gcp", empty for none.
+	Provider string `yaml:"provider"`
+	// RefreshInterval is how long fetched credentials are used before
+	// they are fetched again.
+	RefreshInterval model.Duration `yaml:"refresh_interval"`
+	Vault           VaultConfig    `yaml:"vault"`
+	AWS             AWSConfig      `yaml:"aws"`
+	GCP             GCPConfig      `yaml:"gcp"`
+}
+
+// Vault auth methods, see VaultConfig.
+const (
+	vaultAuthToken      = "token"
+	vaultAuthKubernetes = "kubernetes"
+	vaultAuthAppRole    = "approle"
+)
+
+// defaultServiceAccountTokenFile holds the token of the service account of a
+// Kubernetes pod.
+const defaultServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultConfig locates a secret in HashiCorp Vault.
+type VaultConfig struct {
+	// Address defaults to the VAULT_ADDR environment variable.
+	Address string `yaml:"address"`
+	// Auth is how the exporter logs in: token, the default, kubernetes or
+	// approle.
+	Auth string `yaml:"auth"`
+	// TokenFile holds the Vault token of the token auth method, which
+	// defaults to the VAULT_TOKEN environment variable.
+	TokenFile string `yaml:"token_file"`
+	// Mount is the path of the kubernetes or approle auth method, which
+	// defaults to its name.
+	Mount string `yaml:"mount"`
+	// Role is the role of the kubernetes auth method, logged in to with the
+	// service account token in ServiceAccountTokenFile, by default that of
+	// the pod.
+	Role                    string `yaml:"role"`
+	ServiceAccountTokenFile string `yaml:"service_account_token_file"`
+	// RoleID and SecretIDFile, the file holding the secret ID, log in with
+	// the approle auth method.
+	RoleID       string `yaml:"role_id"`
+	SecretIDFile string `yaml:"secret_id_file"`
+	// Path is the API path of the secret below /v1/, for example
+	// secret/data/btcd for a KV version 2 secrets engine mounted at
+	// secret.
+	Path string `yaml:"path"`
+}
+
+// AWSConfig locates a secret in AWS Secrets Manager. The AWS credentials are
+// taken from the default chain of the AWS SDK: the environment, the shared
+// configuration and credentials files, SSO, web identity, and the ECS and EC2
+// instance roles.
+type AWSConfig struct {
+	// Region defaults to the AWS_REGION environment variable or the shared
+	// configuration.
+	Region   string `yaml:"region"`
+	SecretID string `yaml:"secret_id"`
+}
+
+// GCPConfig locates a secret in GCP Secret Manager. The access token is taken
+// from the Application Default Credentials: the file named by the
+// GOOGLE_APPLICATION_CREDENTIALS environment variable, those of gcloud, or
+// the service account of the instance given by the metadata server.
+type GCPConfig struct {
+	// Name is the resource name of the secret version, for example
+	// projects/my-project/secrets/btcd-rpc/versions/latest.
+	Name string `yaml:"name"`
+}
+
+// defaultCredentialsRefresh is used when no refresh interval is configured.
+const defaultCredentialsRefresh = 5 * time.Minute
+
+// gcpScope is the OAuth 2.0 scope of the tokens used with GCP Secret Manager.
+const gcpScope = "https://www.googleapis.com/auth/cloud-platform"
+
+var (
+	credentialsClient = &http.Client{Timeout: 10 * time.Second}
+	// gcpSecretManagerURL is replaced by tests.
+	gcpSecretManagerURL = "https://secretmanager.googleapis.com"
+
+	// Fetched credentials are shared by the nodes, probes and reloads
+	// using the same secret until they have to be refreshed.
+	credentialsCacheMtx sync.Mutex
+	credentialsCache    = make(map[CredentialsConfig]*cachedCredentials)
+)
+
+type cachedCredentials struct {
+	// mtx is held while the secret is fetched, so that its users wait for a
+	// single fetch without holding up those of other secrets.
+	mtx                sync.Mutex
+	username, password string
+	fetched            time.Time
+}
+
+// refreshInterval returns how long fetched credentials are used.
+func (c *CredentialsConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval > 0 {
+		return time.Duration(c.RefreshInterval)
+	}
+	return defaultCredentialsRefresh
+}
+
+func (c *CredentialsConfig) validate() error {
+	switch c.Provider {
+	case "":
+	case credentialsVault:
+		if c.Vault.Path == "" {
+			return fmt.Errorf("vault credentials need a path")
+		}
+		switch c.Vault.Auth {
+		case "", vaultAuthToken:
+		case vaultAuthKubernetes:
+			if c.Vault.Role == "" {
+				return fmt.Errorf("vault kubernetes auth needs a role")
+			}
+		case vaultAuthAppRole:
+			if c.Vault.RoleID == "" || c.Vault.SecretIDFile == "" {
+				return fmt.Errorf("vault approle auth needs a role_id and a secret_id_file")
+			}
+		default:
+			return fmt.Errorf("unknown vault auth method %q", c.Vault.Auth)
+		}
+	case credentialsAWS:
+		if c.AWS.SecretID == "" {
+			return fmt.Errorf("aws credentials need a secret_id")
+		}
+	case credentialsGCP:
+		if c.GCP.Name == "" {
+			return fmt.Errorf("gcp credentials need a name")
+		}
+	default:
+		return fmt.Errorf("unknown credentials provider %q", c.Provider)
+	}
+	return nil
+}
+
+// fetch returns the username and password held by the secret, fetching them
+// again once the refresh interval has passed.
+func (c *CredentialsConfig) fetch() (string, string, error) {
+	credentialsCacheMtx.Lock()
+	cached, ok := credentialsCache[*c]
+	if !ok {
+		cached = &cachedCredentials{}
+		credentialsCache[*c] = cached
+	}
+	credentialsCacheMtx.Unlock()
+
+	cached.mtx.Lock()
+	defer cached.mtx.Unlock()
+	if !cached.fetched.IsZero() && time.Since(cached.fetched) < c.refreshInterval() {
+		return cached.username, cached.password, nil
+	}
+	var (
+		secret []byte
+		err    error
+	)
+	switch c.Provider {
+	case credentialsVault:
+		secret, err = fetchVaultSecret(c.Vault)
+	case credentialsAWS:
+		secret, err = fetchAWSSecret(c.AWS)
+	case credentialsGCP:
+		secret, err = fetchGCPSecret(c.GCP)
+	default:
+		err = fmt.Errorf("unknown credentials provider %q", c.Provider)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error fetching credentials from %s: %w", c.Provider, err)
+	}
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(secret, &credentials); err != nil {
+		return "", "", fmt.Errorf("error parsing credentials from %s: %w", c.Provider, err)
+	}
+	cached.username, cached.password = credentials.Username, credentials.Password
+	cached.fetched = time.Now()
+	return credentials.Username, credentials.Password, nil
+}
+
+// fetchVaultSecret reads a secret of a KV secrets engine, of version 1 or 2.
+func fetchVaultSecret(config VaultConfig) ([]byte, error) {
+	address := config.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	address = strings.TrimRight(address, "/")
+	token, err := vaultToken(address, config)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, address+"/v1/"+strings.TrimLeft(config.Path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	body, err := doCredentialsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	// KV version 2 nests the secret below another data key.
+	var kv2 struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if json.Unmarshal(response.Data, &kv2) == nil && kv2.Data != nil && kv2.Metadata != nil {
+		return kv2.Data, nil
+	}
+	return response.Data, nil
+}
+
+// vaultToken returns the token the secret is read with: the configured one
+// for the token auth method, or one obtained by logging in to Vault at
+// address with the kubernetes or approle auth method.
+func vaultToken(address string, config VaultConfig) (string, error) {
+	var login map[string]string
+	switch config.Auth {
+	case "", vaultAuthToken:
+		if config.TokenFile == "" {
+			return os.Getenv("VAULT_TOKEN"), nil
+		}
+		content, err := ioutil.ReadFile(config.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	case vaultAuthKubernetes:
+		tokenFile := config.ServiceAccountTokenFile
+		if tokenFile == "" {
+			tokenFile = defaultServiceAccountTokenFile
+		}
+		jwt, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return "", err
+		}
+		login = map[string]string{"role": config.Role, "jwt": strings.TrimSpace(string(jwt))}
+	case vaultAuthAppRole:
+		secretID, err := ioutil.ReadFile(config.SecretIDFile)
+		if err != nil {
+			return "", err
+		}
+		login = map[string]string{"role_id": config.RoleID, "secret_id": strings.TrimSpace(string(secretID))}
+	default:
+		return "", fmt.Errorf("unknown vault auth method %q", config.Auth)
+	}
+	mount := config.Mount
+	if mount == "" {
+		mount = config.Auth
+	}
+	payload, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, address+"/v1/auth/"+strings.Trim(mount, "/")+"/login", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	body, err := doCredentialsRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("error logging in to vault: %w", err)
+	}
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+	if response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("no token in the vault %s login response", config.Auth)
+	}
+	return response.Auth.ClientToken, nil
+}
+
+// fetchAWSSecret calls GetSecretValue of AWS Secrets Manager with the
+// credentials of the default chain of the AWS SDK.
+func fetchAWSSecret(config AWSConfig) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialsClient.Timeout)
+	defer cancel()
+	options := []func(*awsconfig.LoadOptions) error{awsconfig.WithHTTPClient(credentialsClient)}
+	if config.Region != "" {
+		options = append(options, awsconfig.WithRegion(config.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(config.SecretID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(aws.ToString(output.SecretString)), nil
+}
+
+// fetchGCPSecret accesses a secret version of GCP Secret Manager with a token
+// of the Application Default Credentials.
+func fetchGCPSecret(config GCPConfig) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialsClient.Timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, credentialsClient)
+	credentials, err := google.FindDefaultCredentials(ctx, gcpScope)
+	if err != nil {
+		return nil, err
+	}
+	token, err := credentials.TokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, gcpSecretManagerURL+"/v1/"+config.Name+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	token.SetAuthHeader(req)
+	body, err := doCredentialsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(response.Payload.Data)
+}
+
+// doCredentialsRequest sends req and returns the body of a successful
+// response.
+func doCredentialsRequest(req *http.Request) ([]byte, error) {
+	resp, err := credentialsClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: unexpected status %s", req.Method, req.URL.Host, resp.Status)
+	}
+	return body, nil
+}
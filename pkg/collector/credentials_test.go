@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes content to a file of a temporary directory of t.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newVaultServer emulates Vault, handing out the token vault-token to logins
+// to mount with the body want, and serving a KV version 2 secret at
+// secret/data/btcd to that token.
+func newVaultServer(t *testing.T, mount string, want map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/" + mount + "/login":
+			var login map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&login); err != nil || fmt.Sprint(login) != fmt.Sprint(want) {
+				t.Errorf("got login %v, want %v", login, want)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"auth": {"client_token": "vault-token"}}`)
+		case "/v1/secret/data/btcd":
+			if r.Header.Get("X-Vault-Token") != "vault-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"data": {"data": {"username": "btcd", "password": "vaulted"}, "metadata": {"version": 1}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVaultCredentials(t *testing.T) {
+	jwtFile := writeFile(t, "token", "service-account-jwt\n")
+	secretIDFile := writeFile(t, "secret-id", "approle-secret\n")
+	tokenFile := writeFile(t, "vault-token", "vault-token\n")
+	for _, tc := range []struct {
+		name  string
+		mount string
+		login map[string]string
+		vault VaultConfig
+	}{{
+		name:  "token",
+		vault: VaultConfig{TokenFile: tokenFile},
+	}, {
+		name:  "kubernetes",
+		mount: "kubernetes",
+		login: map[string]string{"role": "btcd-exporter", "jwt": "service-account-jwt"},
+		vault: VaultConfig{Auth: vaultAuthKubernetes, Role: "btcd-exporter", ServiceAccountTokenFile: jwtFile},
+	}, {
+		name:  "approle",
+		mount: "exporters",
+		login: map[string]string{"role_id": "role", "secret_id": "approle-secret"},
+		vault: VaultConfig{Auth: vaultAuthAppRole, Mount: "exporters", RoleID: "role", SecretIDFile: secretIDFile},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newVaultServer(t, tc.mount, tc.login)
+			config := CredentialsConfig{Provider: credentialsVault, Vault: tc.vault}
+			config.Vault.Address = server.URL
+			config.Vault.Path = "secret/data/btcd"
+			if err := config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			username, password, err := config.fetch()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username != "btcd" || password != "vaulted" {
+				t.Errorf("got credentials %s/%s, want btcd/vaulted", username, password)
+			}
+		})
+	}
+}
+
+func TestVaultCredentialsInvalid(t *testing.T) {
+	for _, vault := range []VaultConfig{
+		{Path: "secret/data/btcd", Auth: "userpass"},
+		{Path: "secret/data/btcd", Auth: vaultAuthKubernetes},
+		{Path: "secret/data/btcd", Auth: vaultAuthAppRole, RoleID: "role"},
+	} {
+		config := CredentialsConfig{Provider: credentialsVault, Vault: vault}
+		if err := config.validate(); err == nil {
+			t.Errorf("%+v: got no error", vault)
+		}
+	}
+}
+
+func TestGCPCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token": "gcp-token", "token_type": "Bearer", "expires_in": 3600}`)
+		case "/v1/projects/p/secrets/btcd-rpc/versions/latest:access":
+			if r.Header.Get("Authorization") != "Bearer gcp-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			payload := base64.StdEncoding.EncodeToString([]byte(`{"username": "btcd", "password": "gcp"}`))
+			fmt.Fprintf(w, `{"payload": {"data": %q}}`, payload)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defaultURL := gcpSecretManagerURL
+	gcpSecretManagerURL = server.URL
+	defer func() { gcpSecretManagerURL = defaultURL }()
+	// The credentials of gcloud auth application-default login.
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", writeFile(t, "credentials.json", fmt.Sprintf(
+		`{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "refresh", "token_uri": %q}`,
+		server.URL+"/token",
+	)))
+
+	config := CredentialsConfig{Provider: credentialsGCP, GCP: GCPConfig{Name: "projects/p/secrets/btcd-rpc/versions/latest"}}
+	username, password, err := config.fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "btcd" || password != "gcp" {
+		t.Errorf("got credentials %s/%s, want btcd/gcp", username, password)
+	}
+}
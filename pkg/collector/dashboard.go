@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// dashboardPanel is a time series panel of the dashboard. Its queries name
+// the metrics with the btcd prefix, replaced with the metric namespace when
+// generated.
+type dashboardPanel struct {
+	title string
+	unit  string
+	// queries are PromQL expressions, each with its legend.
+	queries [][2]string
+}
+
+// dashboardRow groups the panels of a collector, or of the exporter itself
+// for an empty collector.
+type dashboardRow struct {
+	collector string
+	title     string
+	panels    []dashboardPanel
+}
+
+// selector restricts the queries of the dashboard to the instances picked in
+// Grafana.
+const selector = `instance=~"$instance"`
+
+var dashboardRows = []dashboardRow{
+	{title: "Exporter", panels: []dashboardPanel{
+		{title: "Up", unit: "none", queries: [][2]string{
+			{`btcd_up{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Failed collectors", unit: "none", queries: [][2]string{
+			{`btcd_collector_success{` + selector + `} == 0`, "{{instance}} {{node}} {{collector}}"},
+		}},
+		{title: "Collector duration", unit: "s", queries: [][2]string{
+			{`btcd_collector_duration_seconds{` + selector + `}`, "{{instance}} {{node}} {{collector}}"},
+		}},
+		{title: "RPC reconnects", unit: "none", queries: [][2]string{
+			{`increase(btcd_rpc_reconnects_total{` + selector + `}[$__range])`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "chain", title: "Chain", panels: []dashboardPanel{
+		{title: "Block height", unit: "none", queries: [][2]string{
+			{`btcd_block_height{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Latest block age", unit: "s", queries: [][2]string{
+			{`time() - btcd_latest_block_timestamp{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Difficulty", unit: "none", queries: [][2]string{
+			{`btcd_difficulty{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "network", title: "Network", panels: []dashboardPanel{
+		{title: "Peers", unit: "none", queries: [][2]string{
+			{`btcd_peers{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Traffic", unit: "Bps", queries: [][2]string{
+			{`rate(btcd_network_received_bytes_total{` + selector + `}[$__rate_interval])`, "{{instance}} {{node}} received"},
+			{`-rate(btcd_network_sent_bytes_total{` + selector + `}[$__rate_interval])`, "{{instance}} {{node}} sent"},
+		}},
+	}},
+	{collector: "peers", title: "Peers", panels: []dashboardPanel{
+		{title: "Ping", unit: "s", queries: [][2]string{
+			{`btcd_peer_ping_seconds{` + selector + `}`, "{{instance}} {{node}} {{addr}}"},
+		}},
+		{title: "Ban score", unit: "none", queries: [][2]string{
+			{`btcd_peer_ban_score{` + selector + `} > 0`, "{{instance}} {{node}} {{addr}}"},
+		}},
+	}},
+	{collector: "mempool", title: "Mempool", panels: []dashboardPanel{
+		{title: "Transactions", unit: "none", queries: [][2]string{
+			{`btcd_mempool_transactions{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Size", unit: "bytes", queries: [][2]string{
+			{`btcd_mempool_bytes{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "mining", title: "Mining", panels: []dashboardPanel{
+		{title: "Network hash rate", unit: "none", queries: [][2]string{
+			{`btcd_mining_network_hashes_per_second{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Pooled transactions", unit: "none", queries: [][2]string{
+			{`btcd_mining_pooled_transactions{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "template", title: "Block template", panels: []dashboardPanel{
+		{title: "Template duration", unit: "s", queries: [][2]string{
+			{`btcd_block_template_duration_seconds{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Template fees", unit: "none", queries: [][2]string{
+			{`btcd_block_template_fees_btc{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Template weight", unit: "percentunit", queries: [][2]string{
+			{`btcd_block_template_weight{` + selector + `} / btcd_block_template_weight_limit{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "address", title: "Addresses", panels: []dashboardPanel{
+		{title: "Balance", unit: "none", queries: [][2]string{
+			{`btcd_address_balance_btc{` + selector + `}`, "{{instance}} {{node}} {{address}}"},
+		}},
+		{title: "Transactions", unit: "none", queries: [][2]string{
+			{`btcd_address_transactions{` + selector + `}`, "{{instance}} {{node}} {{address}}"},
+		}},
+	}},
+	{collector: "deposits", title: "Deposits", panels: []dashboardPanel{
+		{title: "Pending deposits", unit: "none", queries: [][2]string{
+			{`btcd_deposit_pending{` + selector + `}`, "{{instance}} {{node}} {{address}}"},
+		}},
+		{title: "Confirmation latency, 90th percentile", unit: "s", queries: [][2]string{
+			{`histogram_quantile(0.9, sum by (le, instance, node) (rate(btcd_deposit_confirmation_latency_seconds_bucket{` + selector + `}[$__rate_interval])))`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "payments", title: "Payments", panels: []dashboardPanel{
+		{title: "Payments received", unit: "none", queries: [][2]string{
+			{`increase(btcd_payments_received_total{` + selector + `}[$__range])`, "{{instance}} {{node}} {{address}}"},
+		}},
+		{title: "Amount received", unit: "none", queries: [][2]string{
+			{`increase(btcd_payments_received_btc_total{` + selector + `}[$__range])`, "{{instance}} {{node}} {{address}}"},
+		}},
+	}},
+	{collector: "wallet", title: "Wallet", panels: []dashboardPanel{
+		{title: "Balance", unit: "none", queries: [][2]string{
+			{`btcd_wallet_balance_btc{` + selector + `}`, "{{instance}} {{node}} {{status}}"},
+		}},
+		{title: "Unspent outputs", unit: "none", queries: [][2]string{
+			{`btcd_wallet_unspent_outputs{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "process", title: "Process", panels: []dashboardPanel{
+		{title: "CPU", unit: "percentunit", queries: [][2]string{
+			{`rate(btcd_process_cpu_seconds_total{` + selector + `}[$__rate_interval])`, "{{instance}} {{node}}"},
+		}},
+		{title: "Resident memory", unit: "bytes", queries: [][2]string{
+			{`btcd_process_resident_memory_bytes{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "File descriptors", unit: "percentunit", queries: [][2]string{
+			{`btcd_process_open_fds{` + selector + `} / btcd_process_max_fds{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "disk", title: "Disk", panels: []dashboardPanel{
+		{title: "Data directory", unit: "bytes", queries: [][2]string{
+			{`btcd_disk_data_dir_bytes{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+		{title: "Filesystem available", unit: "bytes", queries: [][2]string{
+			{`btcd_disk_filesystem_avail_bytes{` + selector + `}`, "{{instance}} {{node}}"},
+		}},
+	}},
+	{collector: "log", title: "Log", panels: []dashboardPanel{
+		{title: "Events", unit: "none", queries: [][2]string{
+			{`increase(btcd_log_events_total{` + selector + `}[$__rate_interval])`, "{{instance}} {{node}} {{category}}"},
+		}},
+	}},
+}
+
+// queryMetricRegexp matches the metric names in the queries of the dashboard
+// and of the alerting rules.
+var queryMetricRegexp = regexp.MustCompile(`\bbtcd_[a-z_]+`)
+
+// Dashboard returns a Grafana dashboard of the metrics of the exporter, with
+// a row of panels for each of collectors, as JSON. Its queries use the metric
+// namespace, and the Prometheus data source and instances picked in Grafana.
+func Dashboard(namespace string, collectors []string) ([]byte, error) {
+	enabled := make(map[string]bool, len(collectors))
+	for _, name := range collectors {
+		enabled[name] = true
+	}
+	datasource := map[string]string{"type": "prometheus", "uid": "${datasource}"}
+	rename := namespaced(namespace)
+	panels := []interface{}{}
+	y := 0
+	for _, row := range dashboardRows {
+		if row.collector != "" && !enabled[row.collector] {
+			continue
+		}
+		panels = append(panels, map[string]interface{}{
+			"id":        len(panels) + 1,
+			"type":      "row",
+			"title":     row.title,
+			"collapsed": false,
+			"gridPos":   map[string]int{"h": 1, "w": 24, "x": 0, "y": y},
+		})
+		y++
+		for i, panel := range row.panels {
+			targets := make([]map[string]string, len(panel.queries))
+			for j, query := range panel.queries {
+				targets[j] = map[string]string{
+					"refId":        string(rune('A' + j)),
+					"expr":         queryMetricRegexp.ReplaceAllStringFunc(query[0], rename),
+					"legendFormat": query[1],
+				}
+			}
+			panels = append(panels, map[string]interface{}{
+				"id":          len(panels) + 1,
+				"type":        "timeseries",
+				"title":       panel.title,
+				"datasource":  datasource,
+				"gridPos":     map[string]int{"h": 8, "w": 12, "x": i % 2 * 12, "y": y + i/2*8},
+				"fieldConfig": map[string]interface{}{"defaults": map[string]string{"unit": panel.unit}, "overrides": []interface{}{}},
+				"targets":     targets,
+			})
+		}
+		y += (len(row.panels) + 1) / 2 * 8
+	}
+	dashboard := map[string]interface{}{
+		"title":         "btcd",
+		"uid":           "btcd-exporter",
+		"tags":          []string{"btcd", "bitcoin"},
+		"schemaVersion": 39,
+		"editable":      true,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]interface{}{"list": []interface{}{
+			map[string]interface{}{
+				"name":  "datasource",
+				"label": "Data source",
+				"type":  "datasource",
+				"query": "prometheus",
+			},
+			map[string]interface{}{
+				"name":       "instance",
+				"label":      "Instance",
+				"type":       "query",
+				"datasource": datasource,
+				"query":      "label_values(" + rename("btcd_up") + ", instance)",
+				"refresh":    2,
+				"multi":      true,
+				"includeAll": true,
+				"current":    map[string]interface{}{"text": "All", "value": "$__all"},
+			},
+		}},
+		"panels": panels,
+	}
+	return json.MarshalIndent(dashboard, "", "  ")
+}
+
+// namespaced returns a function replacing the btcd prefix of a metric name
+// with namespace.
+func namespaced(namespace string) func(string) string {
+	return func(name string) string {
+		return namespace + name[len("btcd"):]
+	}
+}
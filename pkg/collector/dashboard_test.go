@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var fqNameRegexp = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+// emittedMetrics returns the names of the metrics the exporter emits: those
+// of the Exporter itself, and those of the golden files of the collectors.
+func emittedMetrics(t *testing.T) map[string]bool {
+	t.Helper()
+	exporter, err := NewExporter(newFakeNode(), &Config{}, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitted := make(map[string]bool)
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		exporter.Describe(descs)
+		close(descs)
+	}()
+	for desc := range descs {
+		emitted[fqNameRegexp.FindStringSubmatch(desc.String())[1]] = true
+	}
+	for _, name := range Names() {
+		golden, err := os.ReadFile(filepath.Join("testdata", name+".prom"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(golden), "\n") {
+			if metric := queryMetricRegexp.FindString(line); metric != "" && strings.HasPrefix(line, metric) {
+				emitted[metric] = true
+			}
+		}
+	}
+	return emitted
+}
+
+// TestDashboardMetrics checks that the dashboard only queries metrics the
+// exporter emits.
+func TestDashboardMetrics(t *testing.T) {
+	emitted := emittedMetrics(t)
+	for _, row := range dashboardRows {
+		if _, ok := factories[row.collector]; row.collector != "" && !ok {
+			t.Errorf("row %q of unknown collector %q", row.title, row.collector)
+		}
+		for _, panel := range row.panels {
+			for _, query := range panel.queries {
+				for _, metric := range queryMetricRegexp.FindAllString(query[0], -1) {
+					if !emitted[metric] {
+						t.Errorf("panel %q queries %s, which is not emitted", panel.title, metric)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDashboardCollectors(t *testing.T) {
+	content, err := Dashboard("btcd", []string{"chain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dashboard struct {
+		Panels []struct {
+			Type  string `json:"type"`
+			Title string `json:"title"`
+		} `json:"panels"`
+	}
+	if err := json.Unmarshal(content, &dashboard); err != nil {
+		t.Fatal(err)
+	}
+	var rows []string
+	for _, panel := range dashboard.Panels {
+		if panel.Type == "row" {
+			rows = append(rows, panel.Title)
+		}
+	}
+	if strings.Join(rows, ",") != "Exporter,Chain" {
+		t.Errorf("expected the rows of the exporter and the chain collector, got %v", rows)
+	}
+}
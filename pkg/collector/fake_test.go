@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// fakeNode is an RPC implementation answering from canned results, so that
+// the exporter and the collectors can be tested without a node.
+type fakeNode struct {
+	backend       string
+	httpPostMode  bool
+	connected     bool
+	reconnects    uint64
+	subscriptions []SubscriptionStatus
+
+	chainInfo       *ChainInfo
+	connectionCount int64
+	blockHeaders    map[chainhash.Hash]*wire.BlockHeader
+	blockTemplate   *btcjson.GetBlockTemplateResult
+	mempoolInfo     *btcjson.GetMempoolInfoResult
+	miningInfo      *btcjson.GetMiningInfoResult
+	netTotals       *btcjson.GetNetTotalsResult
+	peerInfo        []btcjson.GetPeerInfoResult
+	// transactions are the results of searchrawtransactions, by address.
+	transactions map[string][]*btcjson.SearchRawTransactionsResult
+
+	// errs makes the calls of the RPC methods it lists fail.
+	errs map[string]error
+
+	mtx   sync.Mutex
+	calls map[string]int
+}
+
+var _ RPC = (*fakeNode)(nil)
+
+// call records a call of method and returns the error configured for it.
+func (f *fakeNode) call(method string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[method]++
+	return f.errs[method]
+}
+
+// callCount returns how many times method was called.
+func (f *fakeNode) callCount(method string) int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.calls[method]
+}
+
+func (f *fakeNode) Backend() string {
+	if f.backend == "" {
+		return BackendBtcd
+	}
+	return f.backend
+}
+
+func (f *fakeNode) HTTPPostMode() bool { return f.httpPostMode }
+func (f *fakeNode) Connected() bool    { return f.connected }
+func (f *fakeNode) Reconnects() uint64 { return f.reconnects }
+
+func (f *fakeNode) Subscriptions() []SubscriptionStatus { return f.subscriptions }
+
+func (f *fakeNode) Ready(ctx context.Context) error {
+	if !f.httpPostMode && !f.connected {
+		return fmt.Errorf("not connected")
+	}
+	return f.call("getbestblockhash")
+}
+
+func (f *fakeNode) ChainInfo(ctx context.Context) (*ChainInfo, error) {
+	if err := f.call("getblockchaininfo"); err != nil {
+		return nil, err
+	}
+	return f.chainInfo, nil
+}
+
+func (f *fakeNode) ConnectionCount(ctx context.Context) (int64, error) {
+	if err := f.call("getconnectioncount"); err != nil {
+		return 0, err
+	}
+	return f.connectionCount, nil
+}
+
+func (f *fakeNode) GetBlockHeader(ctx context.Context, hash *chainhash.Hash) (*wire.BlockHeader, error) {
+	if err := f.call("getblockheader"); err != nil {
+		return nil, err
+	}
+	header, ok := f.blockHeaders[*hash]
+	if !ok {
+		return nil, &btcjson.RPCError{Code: btcjson.ErrRPCBlockNotFound, Message: "Block not found"}
+	}
+	return header, nil
+}
+
+func (f *fakeNode) GetBlockTemplate(ctx context.Context) (*btcjson.GetBlockTemplateResult, error) {
+	if err := f.call("getblocktemplate"); err != nil {
+		return nil, err
+	}
+	return f.blockTemplate, nil
+}
+
+func (f *fakeNode) GetMempoolInfo(ctx context.Context) (*btcjson.GetMempoolInfoResult, error) {
+	if err := f.call("getmempoolinfo"); err != nil {
+		return nil, err
+	}
+	return f.mempoolInfo, nil
+}
+
+func (f *fakeNode) GetMiningInfo(ctx context.Context) (*btcjson.GetMiningInfoResult, error) {
+	if err := f.call("getmininginfo"); err != nil {
+		return nil, err
+	}
+	return f.miningInfo, nil
+}
+
+func (f *fakeNode) GetNetTotals(ctx context.Context) (*btcjson.GetNetTotalsResult, error) {
+	if err := f.call("getnettotals"); err != nil {
+		return nil, err
+	}
+	return f.netTotals, nil
+}
+
+func (f *fakeNode) GetPeerInfo(ctx context.Context) ([]btcjson.GetPeerInfoResult, error) {
+	if err := f.call("getpeerinfo"); err != nil {
+		return nil, err
+	}
+	return f.peerInfo, nil
+}
+
+func (f *fakeNode) SearchRawTransactionsVerbose(ctx context.Context, address btcutil.Address, skip, count int) ([]*btcjson.SearchRawTransactionsResult, error) {
+	if err := f.call("searchrawtransactions"); err != nil {
+		return nil, err
+	}
+	txs := f.transactions[address.EncodeAddress()]
+	if skip >= len(txs) {
+		// btcd reports an empty result page as an error.
+		return nil, &btcjson.RPCError{Code: btcjson.ErrRPCNoTxInfo, Message: "No information available about transaction"}
+	}
+	txs = txs[skip:]
+	if len(txs) > count {
+		txs = txs[:count]
+	}
+	return txs, nil
+}
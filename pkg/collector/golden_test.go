@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/atk-works/btcd_exporter/internal/btcdtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata from the current output")
+
+// uncheckedCollector turns a Collector into an unchecked prometheus.Collector,
+// collecting it as the Exporter does.
+type uncheckedCollector struct {
+	collector Collector
+}
+
+func (c uncheckedCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c uncheckedCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics, err := collect(context.Background(), c.collector)
+	if err != nil {
+		panic(err)
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// TestGolden compares the whole output of every collector, names, types,
+// help strings, labels and values, with testdata/<collector>.prom. Run
+// go test -update after a deliberate change of the metrics, and review the
+// diff of the golden files.
+func TestGolden(t *testing.T) {
+	wallet := btcdtest.NewServer(t)
+	wallet.SetResult("getbalance", 1.5)
+	wallet.SetResult("getunconfirmedbalance", 0.25)
+	wallet.SetResult("listunspent", []btcjson.ListUnspentResult{
+		{TxID: bestBlockHash.String(), Vout: 0, Amount: 1},
+		{TxID: bestBlockHash.String(), Vout: 1, Amount: 0.5},
+	})
+	now := time.Now().Unix()
+	wallet.SetResult("listtransactions", []btcjson.ListTransactionsResult{
+		{Category: "receive", Amount: 1, Time: now - 60},
+		{Category: "receive", Amount: 0.5, Time: now - 3600},
+		{Category: "send", Amount: -0.25, Time: now - 7200},
+		// Older than a day.
+		{Category: "receive", Amount: 2, Time: now - 3*86400},
+	})
+	defer PruneWalletClients(RPCConfig{})
+	logFile := filepath.Join(t.TempDir(), "btcd.log")
+	if err := ioutil.WriteFile(logFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer UseLogConfigs(nil)
+
+	config := &Config{
+		Addresses: []WatchedAddress{{Address: genesisAddress}},
+		Process:   ProcessConfig{ProcFS: filepath.Join("testdata", "proc")},
+		Disk:      DiskConfig{DataDir: filepath.Join("testdata", "datadir")},
+		Log:       LogConfig{File: logFile},
+		Wallet:    WalletConfig{RPCConfig: serverConfig(wallet)},
+	}
+	node := newFakeNode()
+	// The deposits and payments collectors follow the notifications of a
+	// websocket connection, they report no deposit or payment yet.
+	server := btcdtest.NewServer(t)
+	wsNode := newTestClient(t, serverConfig(server), false)
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			var client RPC = node
+			if name == "deposits" || name == "payments" {
+				client = wsNode
+			}
+			c, err := factories[name](client, config, DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch c := c.(type) {
+			case *templateCollector:
+				// The fake node answers in no time worth comparing.
+				c.since = func(time.Time) time.Duration { return 50 * time.Millisecond }
+			case *diskCollector:
+				c.statfs = func(string) (uint64, uint64, error) { return 1 << 40, 1 << 38, nil }
+			}
+			golden := filepath.Join("testdata", name+".prom")
+			if *update {
+				writeGolden(t, golden, uncheckedCollector{c})
+			}
+			expected, err := os.Open(golden)
+			if err != nil {
+				t.Fatalf("%v, run go test -update to create it", err)
+			}
+			defer expected.Close()
+			if err := testutil.CollectAndCompare(uncheckedCollector{c}, expected); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func writeGolden(t *testing.T, path string, c prometheus.Collector) {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLabelNames checks that LabelNames holds the labels of the metrics of
+// every collector, as written to the golden files.
+func TestLabelNames(t *testing.T) {
+	known := make(map[string]bool)
+	for _, name := range LabelNames() {
+		known[name] = true
+	}
+	files, err := filepath.Glob(filepath.Join("testdata", "*.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parser expfmt.TextParser
+		families, err := parser.TextToMetricFamilies(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		for _, family := range families {
+			for _, m := range family.GetMetric() {
+				for _, label := range m.GetLabel() {
+					if !known[label.GetName()] {
+						t.Errorf("label %q of %s missing from LabelNames", label.GetName(), family.GetName())
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+//go:build integration
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The integration tests run the collectors against a real btcd in simnet
+// mode, started from the binary named by $BTCD_BIN or found in $PATH:
+//
+//	go install github.com/btcsuite/btcd@latest
+//	go test -tags integration ./pkg/collector/
+
+// simnetNode is a btcd running in simnet mode for the duration of a test.
+type simnetNode struct {
+	config RPCConfig
+	// miningAddress receives the coinbase of the generated blocks.
+	miningAddress btcutil.Address
+	log           bytes.Buffer
+}
+
+// startSimnet starts btcd in simnet mode, with an address index, and waits
+// for its RPC server to answer.
+func startSimnet(t *testing.T) *simnetNode {
+	t.Helper()
+	bin := os.Getenv("BTCD_BIN")
+	if bin == "" {
+		var err error
+		if bin, err = exec.LookPath("btcd"); err != nil {
+			t.Skip("btcd not found, set BTCD_BIN or add it to PATH")
+		}
+	}
+	miningAddress, err := btcutil.NewAddressPubKeyHash(bytes.Repeat([]byte{1}, 20), &chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	node := &simnetNode{
+		config: RPCConfig{
+			Host:     fmt.Sprintf("127.0.0.1:%d", freePort(t)),
+			Username: "user",
+			Password: "pass",
+			TLS:      TLSConfig{CertFile: filepath.Join(dir, "rpc.cert")},
+		},
+		miningAddress: miningAddress,
+	}
+	cmd := exec.Command(bin,
+		"--simnet",
+		"--datadir="+filepath.Join(dir, "data"),
+		"--logdir="+filepath.Join(dir, "logs"),
+		"--rpclisten="+node.config.Host,
+		"--rpcuser="+node.config.Username,
+		"--rpcpass="+node.config.Password,
+		"--rpccert="+node.config.TLS.CertFile,
+		"--rpckey="+filepath.Join(dir, "rpc.key"),
+		"--miningaddr="+miningAddress.EncodeAddress(),
+		"--txindex",
+		"--addrindex",
+		"--nolisten",
+	)
+	cmd.Stdout, cmd.Stderr = &node.log, &node.log
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+		if t.Failed() {
+			t.Logf("btcd output:\n%s", node.log.String())
+		}
+	})
+
+	// btcd writes its certificate before serving RPC.
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		client, err := NewClient(node.config, false, DefaultOptions())
+		if err == nil {
+			err = client.Ready(context.Background())
+			client.Shutdown()
+			if err == nil {
+				return node
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("btcd did not start: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// generate mines blocks.
+func (n *simnetNode) generate(t *testing.T, client *Client, blocks uint32) {
+	t.Helper()
+	if _, err := client.Client.Generate(blocks); err != nil {
+		t.Fatalf("error generating %d blocks: %v", blocks, err)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// gather collects exporter and returns the metric families by name.
+func gather(t *testing.T, exporter *Exporter) map[string]*dto.MetricFamily {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// value returns the value of the only metric of the family called name.
+func value(t *testing.T, families map[string]*dto.MetricFamily, name string) float64 {
+	t.Helper()
+	family, ok := families[name]
+	if !ok || len(family.Metric) != 1 {
+		t.Fatalf("no single %s metric", name)
+	}
+	m := family.Metric[0]
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		return m.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		return m.GetGauge().GetValue()
+	}
+	t.Fatalf("%s is a %s", name, family.GetType())
+	return 0
+}
+
+func TestSimnet(t *testing.T) {
+	node := startSimnet(t)
+	client := newTestClient(t, node.config, false)
+	config := enabled("address", "chain", "mempool", "mining", "network", "peers", "template")
+	config.Addresses = []WatchedAddress{{Address: node.miningAddress.EncodeAddress()}}
+	exporter := newTestExporter(t, client, config)
+
+	families := gather(t, exporter)
+	if got := value(t, families, "btcd_up"); got != 1 {
+		t.Fatalf("btcd_up is %v", got)
+	}
+	for name, c := range exporter.Status().Collectors {
+		if c.Err != nil {
+			t.Errorf("%s collector failed: %v", name, c.Err)
+		}
+	}
+	if got := value(t, families, "btcd_block_height"); got != 0 {
+		t.Errorf("got %v blocks before mining, want 0", got)
+	}
+	chain := families["btcd_chain_info"].GetMetric()[0].GetLabel()[0].GetValue()
+	if chain != chaincfg.SimNetParams.Name {
+		t.Errorf("got chain %q, want %q", chain, chaincfg.SimNetParams.Name)
+	}
+
+	const blocks = 10
+	start := time.Now()
+	node.generate(t, client, blocks)
+	families = gather(t, exporter)
+
+	if got := value(t, families, "btcd_block_height"); got != blocks {
+		t.Errorf("got %v blocks, want %d", got, blocks)
+	}
+	latest := time.Unix(int64(value(t, families, "btcd_latest_block_timestamp")), 0)
+	if latest.Before(start.Add(-time.Minute)) || latest.After(time.Now().Add(time.Minute)) {
+		t.Errorf("latest block at %s, mined at %s", latest, start)
+	}
+	if got := value(t, families, "btcd_difficulty"); got <= 0 {
+		t.Errorf("got difficulty %v", got)
+	}
+	if got := value(t, families, "btcd_peers"); got != 0 {
+		t.Errorf("got %v peers on an isolated node", got)
+	}
+	if got := value(t, families, "btcd_mempool_transactions"); got != 0 {
+		t.Errorf("got %v transactions in the mempool", got)
+	}
+	// The blocks are generated on demand, not by the CPU miner.
+	if got := value(t, families, "btcd_mining_generate"); got != 0 {
+		t.Errorf("got btcd_mining_generate %v, want 0", got)
+	}
+	if got := value(t, families, "btcd_block_template_height"); got != blocks+1 {
+		t.Errorf("got a template at height %v, want %d", got, blocks+1)
+	}
+	// Every block pays 50 BTC to the mining address.
+	if got := value(t, families, "btcd_address_transactions"); got != blocks {
+		t.Errorf("got %v transactions of the mining address, want %d", got, blocks)
+	}
+	if got := value(t, families, "btcd_address_balance_btc"); got != blocks*50 {
+		t.Errorf("got balance %v of the mining address, want %d", got, blocks*50)
+	}
+
+	for name, want := range map[string]dto.MetricType{
+		"btcd_up":                       dto.MetricType_GAUGE,
+		"btcd_block_height":             dto.MetricType_GAUGE,
+		"btcd_difficulty":               dto.MetricType_GAUGE,
+		"btcd_latest_block_timestamp":   dto.MetricType_GAUGE,
+		"btcd_chain_info":               dto.MetricType_GAUGE,
+		"btcd_peers":                    dto.MetricType_GAUGE,
+		"btcd_network_sent_bytes_total": dto.MetricType_COUNTER,
+		"btcd_mempool_transactions":     dto.MetricType_GAUGE,
+		"btcd_mempool_bytes":            dto.MetricType_GAUGE,
+		"btcd_address_balance_btc":      dto.MetricType_GAUGE,
+		"btcd_address_transactions":     dto.MetricType_GAUGE,
+		"btcd_rpc_connected":            dto.MetricType_GAUGE,
+	} {
+		if family, ok := families[name]; !ok {
+			t.Errorf("%s missing", name)
+		} else if got := family.GetType(); got != want {
+			t.Errorf("%s is a %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSimnetHTTPPostMode(t *testing.T) {
+	node := startSimnet(t)
+	config := node.config
+	config.Mode = RPCModeHTTP
+	client := newTestClient(t, config, false)
+	exporter := newTestExporter(t, client, enabled("chain", "network"))
+	node.generate(t, client, 3)
+
+	families := gather(t, exporter)
+	if got := value(t, families, "btcd_block_height"); got != 3 {
+		t.Errorf("got %v blocks, want 3", got)
+	}
+	if _, ok := families["btcd_rpc_connected"]; ok {
+		t.Error("connection reported in HTTP POST mode")
+	}
+}
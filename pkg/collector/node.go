@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// RPC is the part of the RPC interface of a node the exporter and its
+// collectors use. Client implements it on top of rpcclient, tests substitute
+// a fake node.
+type RPC interface {
+	// Backend returns the node implementation, one of the Backend
+	// constants.
+	Backend() string
+	// HTTPPostMode reports whether calls are sent as plain HTTP POST
+	// requests rather than over a websocket connection.
+	HTTPPostMode() bool
+	// Connected reports whether the websocket connection is established.
+	Connected() bool
+	// Reconnects returns how many times the connection was reestablished
+	// after being lost.
+	Reconnects() uint64
+	// Subscriptions returns the states of the notification subscriptions
+	// of the websocket connection, sorted by name.
+	Subscriptions() []SubscriptionStatus
+	// Ready checks that the node is connected and answers.
+	Ready(ctx context.Context) error
+
+	ChainInfo(ctx context.Context) (*ChainInfo, error)
+	ConnectionCount(ctx context.Context) (int64, error)
+	GetBlockHeader(ctx context.Context, hash *chainhash.Hash) (*wire.BlockHeader, error)
+	// GetBlockTemplate returns a template of the next block, as a miner
+	// relying on the coinbase value rather than a coinbase transaction
+	// would get it.
+	GetBlockTemplate(ctx context.Context) (*btcjson.GetBlockTemplateResult, error)
+	GetMempoolInfo(ctx context.Context) (*btcjson.GetMempoolInfoResult, error)
+	GetMiningInfo(ctx context.Context) (*btcjson.GetMiningInfoResult, error)
+	GetNetTotals(ctx context.Context) (*btcjson.GetNetTotalsResult, error)
+	GetPeerInfo(ctx context.Context) ([]btcjson.GetPeerInfoResult, error)
+	// SearchRawTransactionsVerbose returns up to count transactions
+	// involving address, skipping the first skip ones, with their previous
+	// outputs.
+	SearchRawTransactionsVerbose(ctx context.Context, address btcutil.Address, skip, count int) ([]*btcjson.SearchRawTransactionsResult, error)
+}
+
+var _ RPC = (*Client)(nil)
+
+// Backend returns the node implementation the client talks to.
+func (c *Client) Backend() string {
+	return c.backendName
+}
+
+// GetBlockHeader returns the header of the block with hash, from the block
+// cache if it was asked for recently.
+func (c *Client) GetBlockHeader(ctx context.Context, hash *chainhash.Hash) (*wire.BlockHeader, error) {
+	ctx, client := c.rpc(ctx)
+	header, err := cached(ctx, c.headers, "getblockheader", *hash, func() (wire.BlockHeader, error) {
+		header, err := Call(ctx, "getblockheader", func() rpcclient.FutureGetBlockHeaderResult {
+			return client.GetBlockHeaderAsync(hash)
+		})
+		if err != nil {
+			return wire.BlockHeader{}, err
+		}
+		return *header, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &header, nil
+}
+
+// GetBlockTemplate returns a template of the next block.
+func (c *Client) GetBlockTemplate(ctx context.Context) (*btcjson.GetBlockTemplateResult, error) {
+	// btcd needs a mining address to build a coinbase transaction, Bitcoin
+	// Core the segwit rule.
+	request := &btcjson.TemplateRequest{
+		Capabilities: []string{"coinbasevalue"},
+		Rules:        []string{"segwit"},
+	}
+	ctx, client := c.rpc(ctx)
+	return Call(ctx, "getblocktemplate", func() rpcclient.FutureGetBlockTemplateResponse {
+		return client.GetBlockTemplateAsync(request)
+	})
+}
+
+// GetMempoolInfo returns the size of the mempool.
+func (c *Client) GetMempoolInfo(ctx context.Context) (*btcjson.GetMempoolInfoResult, error) {
+	// rpcclient has no wrapper for getmempoolinfo.
+	ctx, client := c.rpc(ctx)
+	raw, err := Call(ctx, "getmempoolinfo", func() rpcclient.FutureRawResult {
+		return client.RawRequestAsync("getmempoolinfo", nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var mempoolInfo btcjson.GetMempoolInfoResult
+	if err := json.Unmarshal(raw, &mempoolInfo); err != nil {
+		return nil, err
+	}
+	return &mempoolInfo, nil
+}
+
+// GetMiningInfo returns the mining statistics of the node.
+func (c *Client) GetMiningInfo(ctx context.Context) (*btcjson.GetMiningInfoResult, error) {
+	ctx, client := c.rpc(ctx)
+	return Call(ctx, "getmininginfo", client.GetMiningInfoAsync)
+}
+
+// GetNetTotals returns the network traffic of the node.
+func (c *Client) GetNetTotals(ctx context.Context) (*btcjson.GetNetTotalsResult, error) {
+	ctx, client := c.rpc(ctx)
+	return Call(ctx, "getnettotals", client.GetNetTotalsAsync)
+}
+
+// GetPeerInfo returns the peers connected to the node.
+func (c *Client) GetPeerInfo(ctx context.Context) ([]btcjson.GetPeerInfoResult, error) {
+	ctx, client := c.rpc(ctx)
+	return Call(ctx, "getpeerinfo", client.GetPeerInfoAsync)
+}
+
+// SearchRawTransactionsVerbose returns a page of the transactions involving
+// address.
+func (c *Client) SearchRawTransactionsVerbose(ctx context.Context, address btcutil.Address, skip, count int) ([]*btcjson.SearchRawTransactionsResult, error) {
+	ctx, client := c.rpc(ctx)
+	return Call(ctx, "searchrawtransactions", func() rpcclient.FutureSearchRawTransactionsVerboseResult {
+		return client.SearchRawTransactionsVerboseAsync(address, skip, count, true, false, nil)
+	})
+}
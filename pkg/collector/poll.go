@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PollingCollector collects the metrics of an Exporter in the background on
+// its own schedule, and serves the last collected values when scraped, with
+// their age. Values older than maxAge, when set, are withheld, the node being
+// reported down.
+type PollingCollector struct {
+	exporter *Exporter
+	interval time.Duration
+	timeout  time.Duration
+	maxAge   time.Duration
+
+	mtx     sync.RWMutex
+	metrics []prometheus.Metric
+	updated time.Time
+	// stale is set while the metrics are withheld, so that it is logged
+	// once rather than on every scrape.
+	stale atomic.Bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPollingCollector creates a PollingCollector polling exporter every
+// interval, each poll given timeout to complete. Run starts polling.
+func NewPollingCollector(exporter *Exporter, interval, timeout, maxAge time.Duration) *PollingCollector {
+	return &PollingCollector{
+		exporter: exporter,
+		interval: interval,
+		timeout:  timeout,
+		maxAge:   maxAge,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Run polls the exporter until Stop is called.
+func (p *PollingCollector) Run() {
+	p.poll()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.poll()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Stop ends polling. A poll in progress is not interrupted.
+func (p *PollingCollector) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+func (p *PollingCollector) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		p.exporter.CollectContext(ctx, ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	p.mtx.Lock()
+	p.metrics, p.updated = metrics, time.Now()
+	p.mtx.Unlock()
+	if p.stale.CompareAndSwap(true, false) {
+		slog.Info("serving polled metrics again")
+	}
+}
+
+func (p *PollingCollector) Describe(ch chan<- *prometheus.Desc) {
+	p.exporter.Describe(ch)
+}
+
+func (p *PollingCollector) Collect(ch chan<- prometheus.Metric) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	if p.updated.IsZero() {
+		return
+	}
+	age := time.Since(p.updated)
+	ch <- prometheus.MustNewConstMetric(p.exporter.pollAge, prometheus.GaugeValue, age.Seconds())
+	if p.maxAge > 0 && age > p.maxAge {
+		if p.stale.CompareAndSwap(false, true) {
+			slog.Warn("withholding stale metrics", "age", age.Round(time.Second), "max_age", p.maxAge)
+		}
+		ch <- prometheus.MustNewConstMetric(p.exporter.up, prometheus.GaugeValue, 0)
+		return
+	}
+	for _, metric := range p.metrics {
+		ch <- metric
+	}
+}
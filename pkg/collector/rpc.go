@@ -0,0 +1,731 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/go-socks/socks"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errRPCTimeout is the cause of the context of a call given up after the
+// RPCTimeout of its client, telling it from the end of the scrape.
+var errRPCTimeout = errors.New("RPC timeout")
+
+// RPCMetrics are the metrics about the RPC calls of the clients created with
+// the Options holding them, to be registered by the caller.
+type RPCMetrics struct {
+	timeouts  *prometheus.CounterVec
+	retries   *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	cacheHits *prometheus.CounterVec
+}
+
+// NewRPCMetrics creates the metrics about RPC calls, named after the
+// Namespace of opts. They are set as the RPCMetrics of the options the
+// clients are created with.
+func NewRPCMetrics(opts Options) *RPCMetrics {
+	m := &RPCMetrics{
+		timeouts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "exporter",
+				Name:      "rpc_timeouts_total",
+				Help:      "How many RPC calls were given up because they took too long.",
+			},
+			[]string{"method"},
+		),
+		retries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "exporter",
+				Name:      "rpc_retries_total",
+				Help:      "How many RPC calls were retried after a connection error.",
+			},
+			[]string{"method"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "exporter",
+				Name:      "rpc_errors_total",
+				Help:      "How many RPC calls failed, after retries.",
+			},
+			[]string{"method"},
+		),
+		cacheHits: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "exporter",
+				Name:      "rpc_cache_hits_total",
+				Help:      "How many RPC calls were saved by the block cache, their result never changing for a given block.",
+			},
+			[]string{"method"},
+		),
+	}
+	// The native buckets resolve the latencies finely, each at most 10%
+	// wider than the previous one, in a single series per method.
+	durationOpts := prometheus.HistogramOpts{
+		Namespace:                       opts.Namespace,
+		Subsystem:                       "exporter",
+		Name:                            "rpc_duration_seconds",
+		Help:                            "Duration of the RPC calls answered by the node, retries counted separately.",
+		NativeHistogramBucketFactor:     1.1,
+		NativeHistogramMaxBucketNumber:  160,
+		NativeHistogramMinResetDuration: time.Hour,
+	}
+	if opts.RPCClassicBuckets {
+		durationOpts.Buckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	}
+	m.duration = prometheus.NewHistogramVec(durationOpts, []string{"method"})
+	return m
+}
+
+// Describe implements prometheus.Collector.
+func (m *RPCMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.timeouts.Describe(ch)
+	m.retries.Describe(ch)
+	m.errors.Describe(ch)
+	m.duration.Describe(ch)
+	m.cacheHits.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *RPCMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.timeouts.Collect(ch)
+	m.retries.Collect(ch)
+	m.errors.Collect(ch)
+	m.duration.Collect(ch)
+	m.cacheHits.Collect(ch)
+}
+
+// The methods recording the calls do nothing on nil metrics, the calls of
+// clients created without RPCMetrics not being recorded.
+
+func (m *RPCMetrics) countTimeout(method string) {
+	if m != nil {
+		m.timeouts.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *RPCMetrics) countRetry(method string) {
+	if m != nil {
+		m.retries.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *RPCMetrics) countError(method string) {
+	if m != nil {
+		m.errors.WithLabelValues(method).Inc()
+	}
+}
+
+func (m *RPCMetrics) observeDuration(method string, duration time.Duration) {
+	if m != nil {
+		m.duration.WithLabelValues(method).Observe(duration.Seconds())
+	}
+}
+
+func (m *RPCMetrics) countCacheHit(method string) {
+	if m != nil {
+		m.cacheHits.WithLabelValues(method).Inc()
+	}
+}
+
+// RPC modes, see RPCConfig.
+const (
+	RPCModeWebsocket = "ws"
+	RPCModeHTTP      = "http"
+)
+
+// Client is a client of a btcd node which keeps track of its websocket
+// connection.
+type Client struct {
+	*rpcclient.Client
+	backend     backend
+	backendName string
+	host        string
+	opts        Options
+	// wallet is set for the clients of btcwallet, whose responses are
+	// never kept by RPCDebug.
+	wallet       bool
+	httpPostMode bool
+	// certFile is the path of the certificate the client trusts, certs its
+	// content at the time the client was created. certModTime is the
+	// modification time of the file last seen, so that the file is only read
+	// again once modified.
+	certFile    string
+	certs       []byte
+	certMtx     sync.Mutex
+	certModTime time.Time
+	// credentials is the secret store the username and password were
+	// fetched from, if any.
+	credentials        CredentialsConfig
+	username, password string
+	// tunnel is set when the TLS settings had to be customized.
+	tunnel *tlsTunnel
+	// batcher is set when the calls are sent in JSON-RPC batches.
+	batcher *rpcBatcher
+	// headers caches the headers of the latest blocks asked for.
+	headers *lruCache[chainhash.Hash, wire.BlockHeader]
+	// breaker stops the scrapes from querying the node while it is down.
+	breaker  *circuitBreaker
+	connects atomic.Uint64
+	// subscriptions follows the notifications the trackers subscribed to.
+	subscriptions subscriptions
+	shutdown      chan struct{}
+	shutdownOnce  sync.Once
+	// deposits is set once the deposits collector follows the
+	// notifications of the node.
+	deposits     atomic.Pointer[depositTracker]
+	depositsOnce sync.Once
+	// payments is set once the payments collector follows the
+	// notifications of the node.
+	payments     atomic.Pointer[paymentTracker]
+	paymentsOnce sync.Once
+}
+
+// NewClient creates a client of the node described by config. In
+// websocket mode, if connectInBackground is set, the connection is
+// established by a background goroutine retrying until it succeeds, otherwise
+// it is established immediately and failing to do so is an error. Once
+// connected, rpcclient reconnects by itself. In HTTP POST mode, every call
+// is a separate request, unless config.Batch is set.
+func NewClient(config RPCConfig, connectInBackground bool, opts Options) (*Client, error) {
+	backend, err := newBackend(config.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if config.LegacyGetInfo {
+		if _, ok := backend.(btcdBackend); !ok {
+			return nil, fmt.Errorf("legacy getinfo is only supported by btcd, not %s", config.Backend)
+		}
+		backend = btcdBackend{legacyGetInfo: true}
+	}
+	if config.Backend == "" {
+		config.Backend = BackendBtcd
+	}
+	connCfg := &rpcclient.ConnConfig{
+		Host:                config.Host,
+		User:                config.Username,
+		Pass:                config.Password,
+		CookiePath:          config.CookieFile,
+		DisableConnectOnNew: connectInBackground,
+	}
+	// The certificate is stated before being read, a modification in
+	// between is then noticed by CertChanged.
+	var certModTime time.Time
+	if info, err := os.Stat(backend.certFile(config)); err == nil {
+		certModTime = info.ModTime()
+	}
+	if err := backend.configure(config, connCfg); err != nil {
+		return nil, err
+	}
+	if config.Batch && !connCfg.HTTPPostMode {
+		return nil, errors.New("batching RPC calls needs rpc mode http, websocket calls are pipelined already")
+	}
+	c := &Client{
+		backend:      backend,
+		backendName:  config.Backend,
+		opts:         opts,
+		host:         config.Host,
+		httpPostMode: connCfg.HTTPPostMode,
+		certFile:     backend.certFile(config),
+		certs:        connCfg.Certificates,
+		certModTime:  certModTime,
+		credentials:  config.Credentials,
+		username:     config.Username,
+		password:     config.Password,
+		breaker:      newCircuitBreaker(config.Host, opts),
+		headers:      newLRUCache[chainhash.Hash, wire.BlockHeader](opts.BlockCacheSize),
+		shutdown:     make(chan struct{}),
+	}
+	dial := net.Dial
+	if config.Proxy != "" {
+		proxyURL, err := parseProxy(config.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		password, _ := proxyURL.User.Password()
+		proxy := &socks.Proxy{
+			Addr:     proxyURL.Host,
+			Username: proxyURL.User.Username(),
+			Password: password,
+		}
+		dial = proxy.Dial
+		// net/http takes the proxy as URL, the websocket dialer of
+		// rpcclient as address.
+		if connCfg.HTTPPostMode {
+			connCfg.Proxy = proxyURL.String()
+		} else {
+			connCfg.Proxy = proxy.Addr
+			connCfg.ProxyUser = proxy.Username
+			connCfg.ProxyPass = proxy.Password
+		}
+	}
+	if !connCfg.DisableTLS && (config.TLS.InsecureSkipVerify || config.TLS.ServerName != "") {
+		if c.tunnel, err = newTLSTunnel(config.Host, tlsClientConfig(config.TLS, connCfg.Certificates), dial); err != nil {
+			return nil, err
+		}
+		// The tunnel is local, it goes through the proxy itself.
+		connCfg.Host = c.tunnel.Addr()
+		connCfg.DisableTLS = true
+		connCfg.Proxy = ""
+	}
+	c.Client, err = rpcclient.New(connCfg, &rpcclient.NotificationHandlers{
+		OnClientConnected: func() {
+			if c.connects.Add(1) > 1 {
+				// The node forgot the subscriptions of the lost
+				// connection, the trackers subscribe again.
+				c.subscriptions.dropped()
+			}
+			if t := c.deposits.Load(); t != nil {
+				t.subscribe()
+			}
+			if t := c.payments.Load(); t != nil {
+				t.subscribe()
+			}
+		},
+		OnTxAcceptedVerbose: func(tx *btcjson.TxRawResult) {
+			c.subscriptions.notified(subscriptionTransactions)
+			if t := c.deposits.Load(); t != nil {
+				t.txAccepted(tx)
+			}
+		},
+		OnBlockConnected: func(hash *chainhash.Hash, height int32, _ time.Time) {
+			c.subscriptions.notified(subscriptionBlocks)
+			if t := c.deposits.Load(); t != nil {
+				t.blockChanged(hash, height, true)
+			}
+		},
+		OnRelevantTxAccepted: func(transaction []byte) {
+			c.subscriptions.notified(subscriptionTransactionFilter)
+			if t := c.payments.Load(); t != nil {
+				t.relevantTxAccepted(transaction)
+			}
+		},
+		OnFilteredBlockConnected: func(_ int32, _ *wire.BlockHeader, txs []*btcutil.Tx) {
+			c.subscriptions.notified(subscriptionBlocks)
+			if t := c.payments.Load(); t != nil {
+				t.filteredBlockConnected(txs)
+			}
+		},
+		OnRecvTx: func(tx *btcutil.Tx, _ *btcjson.BlockDetails) {
+			if t := c.payments.Load(); t != nil {
+				t.recvTx(tx)
+			}
+		},
+		OnRescanProgress: func(_ *chainhash.Hash, height int32, _ time.Time) {
+			if t := c.payments.Load(); t != nil {
+				t.rescanProgress(height, false)
+			}
+		},
+		OnRescanFinished: func(_ *chainhash.Hash, height int32, _ time.Time) {
+			if t := c.payments.Load(); t != nil {
+				t.rescanProgress(height, true)
+			}
+		},
+		OnBlockDisconnected: func(hash *chainhash.Hash, height int32, _ time.Time) {
+			c.subscriptions.notified(subscriptionBlocks)
+			if t := c.deposits.Load(); t != nil {
+				t.blockChanged(hash, height, false)
+			}
+		},
+	})
+	if err != nil {
+		if c.tunnel != nil {
+			c.tunnel.Close()
+		}
+		return nil, err
+	}
+	if config.Batch {
+		if c.batcher, err = newRPCBatcher(connCfg, opts.RPCBatchWindow, c.shutdown); err != nil {
+			c.Client.Shutdown()
+			if c.tunnel != nil {
+				c.tunnel.Close()
+			}
+			return nil, err
+		}
+	}
+	if connectInBackground && !connCfg.HTTPPostMode {
+		go c.connect(config.Host)
+	}
+	return c, nil
+}
+
+// connect establishes the websocket connection, retrying with increasing
+// backoff until it succeeds or the client is shut down.
+func (c *Client) connect(host string) {
+	for attempt := 0; ; attempt++ {
+		// Connect sleeps a few seconds itself after a failed attempt.
+		err := c.Connect(1)
+		if err == nil {
+			slog.Info("connected to btcd", "host", host)
+			return
+		}
+		backoff := time.Second << attempt
+		if backoff > time.Minute || backoff <= 0 {
+			backoff = time.Minute
+		}
+		slog.Warn("error connecting to btcd, retrying", "host", host, "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-c.shutdown:
+			return
+		}
+	}
+}
+
+// CertChanged reports whether the certificate file of the client was
+// modified and no longer holds the certificate the client was created with.
+// The client has to be recreated to trust the new certificate. The
+// modification is reported until CertSeen is called, so that it is still
+// acted upon after an attempt to recreate the client was given up.
+func (c *Client) CertChanged() bool {
+	if c.certFile == "" {
+		return false
+	}
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		// A certificate being replaced may be missing for a moment.
+		return false
+	}
+	c.certMtx.Lock()
+	defer c.certMtx.Unlock()
+	if info.ModTime().Equal(c.certModTime) {
+		return false
+	}
+	certs, err := ioutil.ReadFile(c.certFile)
+	if err != nil {
+		return false
+	}
+	if !bytes.Equal(certs, c.certs) {
+		return true
+	}
+	// Only the modification time changed, the file is not read again
+	// until modified again.
+	c.certModTime = info.ModTime()
+	return false
+}
+
+// CertSeen stops CertChanged from reporting the current certificate file,
+// so that a certificate the client cannot be recreated with is not retried
+// until modified again.
+func (c *Client) CertSeen() {
+	if c.certFile == "" {
+		return
+	}
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return
+	}
+	c.certMtx.Lock()
+	defer c.certMtx.Unlock()
+	c.certModTime = info.ModTime()
+}
+
+// CredentialsChanged reports whether the secret store the credentials of the
+// client were fetched from holds other ones now. The client has to be
+// recreated to use them.
+func (c *Client) CredentialsChanged() bool {
+	if c.credentials.Provider == "" {
+		return false
+	}
+	username, password, err := c.credentials.fetch()
+	if err != nil {
+		// The store may be unavailable for a moment.
+		slog.Warn("error checking credentials", "err", err)
+		return false
+	}
+	return username != c.username || password != c.password
+}
+
+// Connected reports whether the websocket connection is currently
+// established.
+func (c *Client) Connected() bool {
+	// Disconnected blocks while Connect is running, so it is only asked
+	// once the connection has been established.
+	return c.connects.Load() > 0 && !c.Disconnected()
+}
+
+// Reconnects returns how many times the connection was reestablished after
+// being lost.
+func (c *Client) Reconnects() uint64 {
+	connects := c.connects.Load()
+	if connects == 0 {
+		return 0
+	}
+	return connects - 1
+}
+
+// Subscriptions returns the states of the notification subscriptions of the
+// websocket connection, sorted by name.
+func (c *Client) Subscriptions() []SubscriptionStatus {
+	return c.subscriptions.snapshot(c.Connected())
+}
+
+// HTTPPostMode reports whether every call is a separate HTTP POST request,
+// rather than a message on the websocket connection.
+func (c *Client) HTTPPostMode() bool {
+	return c.httpPostMode
+}
+
+// Ready checks that the client is connected and that the node answers.
+func (c *Client) Ready(ctx context.Context) error {
+	if !c.httpPostMode && !c.Connected() {
+		return fmt.Errorf("not connected")
+	}
+	ctx, client := c.rpc(ctx)
+	_, err := Call(ctx, "getbestblockhash", client.GetBestBlockHashAsync)
+	return err
+}
+
+// rpc returns the rpcclient to send the calls of ctx with, and ctx carrying
+// the client, for Call to queue the calls into the batches of its batcher, if
+// any, and to know which node answered.
+func (c *Client) rpc(ctx context.Context) (context.Context, *rpcclient.Client) {
+	ctx = context.WithValue(ctx, clientKey{}, c)
+	if c.batcher == nil {
+		return ctx, c.Client
+	}
+	return ctx, c.batcher.client
+}
+
+type clientKey struct{}
+
+// clientFromContext returns the client the calls of ctx are made with, nil
+// if ctx does not come from Client.rpc.
+func clientFromContext(ctx context.Context) *Client {
+	c, _ := ctx.Value(clientKey{}).(*Client)
+	return c
+}
+
+// optionsFromContext returns the options of the client the calls of ctx are
+// made with, the default ones if ctx does not come from Client.rpc.
+func optionsFromContext(ctx context.Context) Options {
+	if c := clientFromContext(ctx); c != nil {
+		return c.opts
+	}
+	return DefaultOptions()
+}
+
+// debugHost returns the host of the node answering the calls of ctx, if
+// the RPCDebug of its client keeps their responses.
+func debugHost(ctx context.Context) (string, bool) {
+	c := clientFromContext(ctx)
+	if c == nil || !c.opts.RPCDebug || c.wallet {
+		return "", false
+	}
+	return c.host, true
+}
+
+// Shutdown stops connection attempts and shuts the client down.
+func (c *Client) Shutdown() {
+	c.shutdownOnce.Do(func() {
+		close(c.shutdown)
+	})
+	c.Client.Shutdown()
+	if c.batcher != nil {
+		c.batcher.Shutdown()
+	}
+	if c.tunnel != nil {
+		c.tunnel.Close()
+	}
+}
+
+// parseProxy parses the URL of a SOCKS5 proxy. Its errors show the URL with
+// the password redacted, as they end up in logs.
+func parseProxy(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		// The error of url.Parse quotes the whole URL.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if proxyURL.Scheme != "socks5" && proxyURL.Scheme != "socks5h" {
+		return nil, fmt.Errorf("unsupported proxy URL %q: only socks5:// is supported", proxyURL.Redacted())
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", proxyURL.Redacted())
+	}
+	return proxyURL, nil
+}
+
+// tlsClientConfig returns the TLS settings described by config, trusting
+// certs if there are any, and the system roots otherwise.
+func tlsClientConfig(config TLSConfig, certs []byte) *tls.Config {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if len(certs) > 0 {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(certs)
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig
+}
+
+// ChainInfo returns the state of the best chain of the node.
+func (c *Client) ChainInfo(ctx context.Context) (*ChainInfo, error) {
+	ctx, client := c.rpc(ctx)
+	return c.backend.chainInfo(ctx, client)
+}
+
+// ConnectionCount returns the number of peers connected to the node.
+func (c *Client) ConnectionCount(ctx context.Context) (int64, error) {
+	ctx, client := c.rpc(ctx)
+	return c.backend.connectionCount(ctx, client)
+}
+
+// future is implemented by the results of the asynchronous rpcclient calls.
+type future[T any] interface {
+	~chan *rpcclient.Response
+	Receive() (T, error)
+}
+
+// Call sends a call of the RPC method and waits for its result, for example
+// Call(ctx, "getbestblockhash", client.GetBestBlockHashAsync). Calls failing
+// because of a connection error are retried with exponential backoff, RPC
+// errors returned by btcd are not. When ctx carries the batcher of a client,
+// send has to call its batch client, and the call is sent in a batch.
+func Call[T any, F future[T]](ctx context.Context, method string, send func() F) (T, error) {
+	result, err := callWithRetries(ctx, method, send)
+	if err != nil {
+		optionsFromContext(ctx).RPCMetrics.countError(method)
+	}
+	return result, err
+}
+
+func callWithRetries[T any, F future[T]](ctx context.Context, method string, send func() F) (T, error) {
+	var batcher *rpcBatcher
+	if c := clientFromContext(ctx); c != nil {
+		batcher = c.batcher
+	}
+	opts := optionsFromContext(ctx)
+	for attempt := 0; ; attempt++ {
+		var (
+			result T
+			err    error
+		)
+		if batcher == nil {
+			result, err = receive(ctx, method, send(), nil)
+		} else {
+			var (
+				f     F
+				batch *rpcBatch
+			)
+			if f, batch, err = sendBatched(ctx, batcher, send); err == nil {
+				result, err = receive(ctx, method, f, batch)
+			} else {
+				err = fmt.Errorf("%s: %w", method, err)
+			}
+		}
+		if err == nil || attempt >= opts.RPCRetries || !isConnectionError(err) {
+			return result, err
+		}
+		opts.RPCMetrics.countRetry(method)
+		select {
+		case <-time.After(retryBackoff(opts.RPCRetryBackoff, attempt)):
+		case <-ctx.Done():
+			return result, err
+		}
+	}
+}
+
+// isConnectionError reports whether err is caused by the connection to btcd
+// rather than by btcd itself.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, rpcclient.ErrClientNotConnected) ||
+		errors.Is(err, rpcclient.ErrClientDisconnect) ||
+		(errors.As(err, &netErr) && !netErr.Timeout())
+}
+
+// retryBackoff returns the randomized delay before the retry following
+// attempt, counted from 0, the first retry waiting around base.
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	backoff := base << attempt
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+}
+
+// receive waits for the result of an asynchronous call of the RPC method,
+// giving up when ctx is done or the RPCTimeout of its client has passed, or
+// when batch, if the call is part of one, failed. rpcclient calls cannot be
+// cancelled, but an abandoned call does not block anything: its response is
+// dropped when it arrives.
+func receive[T any, F future[T]](ctx context.Context, method string, f F, batch *rpcBatch) (T, error) {
+	opts := optionsFromContext(ctx)
+	if timeout := opts.RPCTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, errRPCTimeout)
+		defer cancel()
+	}
+	var failed chan struct{}
+	if batch != nil {
+		failed = batch.failed
+	}
+	host, record := debugHost(ctx)
+	start := time.Now()
+	select {
+	case response := <-f:
+		duration := time.Since(start)
+		opts.RPCMetrics.observeDuration(method, duration)
+		if record {
+			recordRPCResponse(host, method, start, duration, response)
+		}
+		// Hand the response back to the future, which parses it.
+		ready := make(F, 1)
+		ready <- response
+		result, err := ready.Receive()
+		if err != nil {
+			slog.Warn("RPC call failed", "method", method, "duration", duration, "err", err)
+		} else {
+			slog.Debug("RPC call", "method", method, "duration", duration)
+		}
+		return result, err
+	case <-failed:
+		if record {
+			recordRPCResult(host, method, start, time.Since(start), nil, batch.err)
+		}
+		var zero T
+		return zero, fmt.Errorf("%s: %w", method, batch.err)
+	case <-ctx.Done():
+		// A scrape ending first is not a timeout of the call.
+		if context.Cause(ctx) == errRPCTimeout {
+			opts.RPCMetrics.countTimeout(method)
+		}
+		slog.Warn("RPC call abandoned", "method", method, "duration", time.Since(start), "err", ctx.Err())
+		if record {
+			recordRPCResult(host, method, start, time.Since(start), nil, ctx.Err())
+		}
+		var zero T
+		return zero, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// maxRPCResponseSize bounds the part of a response kept by RPCDebug, block
+// templates and peer lists reaching megabytes.
+const maxRPCResponseSize = 64 << 10
+
+// RPCResponse is the latest response of a node to a call of an RPC method.
+type RPCResponse struct {
+	// Host is the host and port of the node.
+	Host     string
+	Method   string
+	Time     time.Time
+	Duration time.Duration
+	// Result is the raw JSON result, nil for a failed call. It holds the
+	// first maxRPCResponseSize bytes of a larger one.
+	Result []byte
+	// Size is the size of the whole result.
+	Size int
+	Err  error
+}
+
+// Truncated reports whether Result holds only the start of the result.
+func (r RPCResponse) Truncated() bool {
+	return len(r.Result) < r.Size
+}
+
+// rpcResponseKey identifies the calls of a method to a node.
+type rpcResponseKey struct {
+	host, method string
+}
+
+var rpcResponses = struct {
+	mtx    sync.Mutex
+	byCall map[rpcResponseKey]*RPCResponse
+}{byCall: make(map[rpcResponseKey]*RPCResponse)}
+
+// recordRPCResponse keeps the raw result of a call of method to the node at
+// host which started at start.
+func recordRPCResponse(host, method string, start time.Time, duration time.Duration, response *rpcclient.Response) {
+	// A raw future hands back the result of any response unparsed.
+	raw := make(rpcclient.FutureRawResult, 1)
+	raw <- response
+	result, err := raw.Receive()
+	recordRPCResult(host, method, start, duration, result, err)
+}
+
+func recordRPCResult(host, method string, start time.Time, duration time.Duration, result []byte, err error) {
+	response := &RPCResponse{Host: host, Method: method, Time: start, Duration: duration, Size: len(result), Err: err}
+	if len(result) > maxRPCResponseSize {
+		result = result[:maxRPCResponseSize]
+	}
+	if result != nil {
+		response.Result = append([]byte(nil), result...)
+	}
+	rpcResponses.mtx.Lock()
+	defer rpcResponses.mtx.Unlock()
+	rpcResponses.byCall[rpcResponseKey{host, method}] = response
+}
+
+// RPCResponses returns the latest response of every node to every RPC method
+// called by the clients with RPCDebug, sorted by host and method.
+func RPCResponses() []RPCResponse {
+	rpcResponses.mtx.Lock()
+	defer rpcResponses.mtx.Unlock()
+	responses := make([]RPCResponse, 0, len(rpcResponses.byCall))
+	for _, response := range rpcResponses.byCall {
+		responses = append(responses, *response)
+	}
+	sort.Slice(responses, func(i, j int) bool {
+		if responses[i].Host != responses[j].Host {
+			return responses[i].Host < responses[j].Host
+		}
+		return responses[i].Method < responses[j].Method
+	})
+	return responses
+}
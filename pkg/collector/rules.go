@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// RulesConfig holds the thresholds of the recommended alerting rules.
+type RulesConfig struct {
+	// NoBlockFor is how old the latest block may get before alerting.
+	NoBlockFor time.Duration
+	// SyncStallFor is how long the height of a node behind the chain may
+	// stay the same before alerting.
+	SyncStallFor time.Duration
+	// MinPeers is the fewest peers a node may have before alerting.
+	MinPeers int
+}
+
+// alertingRule is a rule in the format of the Prometheus rule files.
+type alertingRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         model.Duration    `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type ruleGroup struct {
+	Name  string         `yaml:"name"`
+	Rules []alertingRule `yaml:"rules"`
+}
+
+// recommendedRule is an alerting rule, kept when its collector is enabled, or
+// always for an empty collector. Its expression names the metrics with the
+// btcd prefix, replaced with the metric namespace when generated.
+type recommendedRule struct {
+	collector string
+	rule      alertingRule
+}
+
+func recommendedRules(config RulesConfig) []recommendedRule {
+	return []recommendedRule{
+		{rule: alertingRule{
+			Alert:  "BtcdNodeDown",
+			Expr:   `btcd_up == 0`,
+			For:    model.Duration(5 * time.Minute),
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "btcd node {{ $labels.instance }} {{ $labels.node }} is down",
+				"description": "The exporter cannot query the node over RPC.",
+			},
+		}},
+		{collector: "chain", rule: alertingRule{
+			Alert:  "BtcdNoNewBlock",
+			Expr:   fmt.Sprintf(`time() - btcd_latest_block_timestamp > %.0f`, config.NoBlockFor.Seconds()),
+			For:    model.Duration(5 * time.Minute),
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "btcd node {{ $labels.instance }} {{ $labels.node }} has no new block",
+				"description": fmt.Sprintf("The latest block of the node is older than %s.", model.Duration(config.NoBlockFor)),
+			},
+		}},
+		{collector: "chain", rule: alertingRule{
+			Alert: "BtcdSyncStalled",
+			Expr: fmt.Sprintf(`time() - btcd_latest_block_timestamp > %.0f and changes(btcd_block_height[%s]) == 0`,
+				config.NoBlockFor.Seconds(), model.Duration(config.SyncStallFor)),
+			Labels: map[string]string{"severity": "critical"},
+			Annotations: map[string]string{
+				"summary":     "btcd node {{ $labels.instance }} {{ $labels.node }} stopped syncing",
+				"description": fmt.Sprintf("The node is behind the chain and its height did not change for %s.", model.Duration(config.SyncStallFor)),
+			},
+		}},
+		{collector: "network", rule: alertingRule{
+			Alert:  "BtcdFewPeers",
+			Expr:   fmt.Sprintf(`btcd_peers < %d`, config.MinPeers),
+			For:    model.Duration(15 * time.Minute),
+			Labels: map[string]string{"severity": "warning"},
+			Annotations: map[string]string{
+				"summary":     "btcd node {{ $labels.instance }} {{ $labels.node }} has few peers",
+				"description": fmt.Sprintf("The node has {{ $value }} peers, fewer than %d.", config.MinPeers),
+			},
+		}},
+	}
+}
+
+// AlertingRules returns the recommended alerting rules of the metrics of
+// collectors, with the thresholds of config, as a Prometheus rule file. The
+// rules use the metric namespace.
+func AlertingRules(namespace string, collectors []string, config RulesConfig) ([]byte, error) {
+	enabled := make(map[string]bool, len(collectors))
+	for _, name := range collectors {
+		enabled[name] = true
+	}
+	group := ruleGroup{Name: namespace, Rules: []alertingRule{}}
+	for _, recommended := range recommendedRules(config) {
+		if recommended.collector != "" && !enabled[recommended.collector] {
+			continue
+		}
+		rule := recommended.rule
+		rule.Expr = queryMetricRegexp.ReplaceAllStringFunc(rule.Expr, namespaced(namespace))
+		group.Rules = append(group.Rules, rule)
+	}
+	return yaml.Marshal(struct {
+		Groups []ruleGroup `yaml:"groups"`
+	}{[]ruleGroup{group}})
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestAlertingRules(t *testing.T) {
+	config := RulesConfig{NoBlockFor: time.Hour, SyncStallFor: 30 * time.Minute, MinPeers: 3}
+	emitted := emittedMetrics(t)
+	for _, recommended := range recommendedRules(config) {
+		if _, ok := factories[recommended.collector]; recommended.collector != "" && !ok {
+			t.Errorf("rule %s of unknown collector %q", recommended.rule.Alert, recommended.collector)
+		}
+		for _, metric := range queryMetricRegexp.FindAllString(recommended.rule.Expr, -1) {
+			if !emitted[metric] {
+				t.Errorf("rule %s queries %s, which is not emitted", recommended.rule.Alert, metric)
+			}
+		}
+	}
+
+	content, err := AlertingRules("btcd", []string{"chain"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules struct {
+		Groups []ruleGroup `yaml:"groups"`
+	}
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		t.Fatal(err)
+	}
+	var alerts []string
+	for _, rule := range rules.Groups[0].Rules {
+		alerts = append(alerts, rule.Alert)
+	}
+	if strings.Join(alerts, ",") != "BtcdNodeDown,BtcdNoNewBlock,BtcdSyncStalled" {
+		t.Errorf("expected the rules of the exporter and the chain collector, got %v", alerts)
+	}
+	expected := "time() - btcd_latest_block_timestamp > 3600 and changes(btcd_block_height[30m]) == 0"
+	if expr := rules.Groups[0].Rules[2].Expr; expr != expected {
+		t.Errorf("expected %q, got %q", expected, expr)
+	}
+}
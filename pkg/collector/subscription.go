@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Notification subscriptions of the websocket connection. btcd notifies
+// connected and disconnected blocks to the clients subscribed with
+// notifyblocks, the transactions accepted to its mempool to those subscribed
+// with notifynewtransactions, and those paying to the addresses of the
+// filter loaded with loadtxfilter. The two subscriptions to transactions are
+// independent, one may be dropped while the other is active. btcd has no
+// notifications of peers.
+const (
+	subscriptionBlocks            = "blocks"
+	subscriptionTransactions      = "transactions"
+	subscriptionTransactionFilter = "transaction_filter"
+)
+
+// SubscriptionStatus is the state of a notification subscription.
+type SubscriptionStatus struct {
+	Name string
+	// Active reports whether the node notifies the current connection.
+	Active bool
+	// Since is when the subscription was last established.
+	Since time.Time
+	// LastNotification is when a notification was last received, the zero
+	// time if none was since the exporter started.
+	LastNotification time.Time
+	// Resubscriptions is how many times the subscription was established
+	// again after being dropped.
+	Resubscriptions uint64
+}
+
+// subscriptions follows the notification subscriptions of a connection,
+// which the node drops when the connection is lost and the trackers
+// establish again once reconnected.
+type subscriptions struct {
+	mtx    sync.Mutex
+	status map[string]*SubscriptionStatus
+}
+
+// subscribed records the outcome of subscribing to the notifications name.
+func (s *subscriptions) subscribed(name string, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.status == nil {
+		s.status = make(map[string]*SubscriptionStatus)
+	}
+	status := s.status[name]
+	if status == nil {
+		status = &SubscriptionStatus{Name: name}
+		s.status[name] = status
+	}
+	if err != nil {
+		status.Active = false
+		return
+	}
+	if !status.Active && !status.Since.IsZero() {
+		status.Resubscriptions++
+	}
+	if !status.Active {
+		status.Active, status.Since = true, time.Now()
+	}
+}
+
+// notified records the reception of a notification of the subscription name.
+func (s *subscriptions) notified(name string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if status, ok := s.status[name]; ok {
+		status.LastNotification = time.Now()
+	}
+}
+
+// dropped marks all the subscriptions inactive, the connection they were
+// established on being lost.
+func (s *subscriptions) dropped() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, status := range s.status {
+		status.Active = false
+	}
+}
+
+// snapshot returns a copy of the states of the subscriptions, sorted by name.
+// They are inactive unless connected.
+func (s *subscriptions) snapshot(connected bool) []SubscriptionStatus {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	statuses := make([]SubscriptionStatus, 0, len(s.status))
+	for _, status := range s.status {
+		copied := *status
+		copied.Active = copied.Active && connected
+		statuses = append(statuses, copied)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// tlsTunnel accepts plain connections on a local address and forwards them
+// over TLS to a remote address. rpcclient offers no way to customize its TLS
+// settings, so when they have to be, it talks to the tunnel without TLS.
+type tlsTunnel struct {
+	listener net.Listener
+	remote   string
+	config   *tls.Config
+	dial     func(network, addr string) (net.Conn, error)
+
+	closeOnce sync.Once
+}
+
+// newTLSTunnel starts a tunnel to remote using config, connecting with dial.
+func newTLSTunnel(remote string, config *tls.Config, dial func(network, addr string) (net.Conn, error)) (*tlsTunnel, error) {
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(remote)
+		if err != nil {
+			return nil, err
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	t := &tlsTunnel{
+		listener: listener,
+		remote:   remote,
+		config:   config,
+		dial:     dial,
+	}
+	go t.serve()
+	return t, nil
+}
+
+// Addr returns the local address of the tunnel.
+func (t *tlsTunnel) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// Close stops accepting connections. Forwarded connections are closed by
+// their ends.
+func (t *tlsTunnel) Close() {
+	t.closeOnce.Do(func() {
+		t.listener.Close()
+	})
+}
+
+func (t *tlsTunnel) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(conn)
+	}
+}
+
+func (t *tlsTunnel) forward(conn net.Conn) {
+	defer conn.Close()
+	rawRemote, err := t.dial("tcp", t.remote)
+	if err != nil {
+		slog.Warn("error connecting through TLS tunnel", "remote", t.remote, "err", err)
+		return
+	}
+	remote := tls.Client(rawRemote, t.config)
+	defer remote.Close()
+	if err := remote.Handshake(); err != nil {
+		slog.Warn("error connecting through TLS tunnel", "remote", t.remote, "err", err)
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, remote)
+		done <- struct{}{}
+	}()
+	// Either side closing ends the forwarding.
+	<-done
+}